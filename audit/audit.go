@@ -0,0 +1,186 @@
+// Structured decision audit log, one JSON line per lookup written to each
+// of the configured sinks.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tmortimer/urlfilter/config"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit log sinks.
+const (
+	SINK_FILE   = "file"
+	SINK_SYSLOG = "syslog"
+	SINK_STDOUT = "stdout"
+)
+
+// The verdict that is sampled, matching handlers.VERDICT_ALLOWED.
+const VERDICT_ALLOWED = "allowed"
+
+// One lookup decision, written as a JSON line.
+type Record struct {
+	// When the decision was made.
+	Time time.Time `json:"time"`
+
+	// The ID of the request, as in the X-Request-ID header.
+	RequestID string `json:"requestId,omitempty"`
+
+	// Address of the client that asked for the URL.
+	Client string `json:"client"`
+
+	// The handler that answered the request.
+	Handler string `json:"handler"`
+
+	// The URL that was checked by the filter chain.
+	URL string `json:"url"`
+
+	// One of allowed, blocked or error.
+	Verdict string `json:"verdict"`
+
+	// The filter in the chain that made the decision.
+	Filter string `json:"filter,omitempty"`
+
+	// The stored entry that was found, if it isn't the URL itself.
+	Matched string `json:"matched,omitempty"`
+
+	// The category of the entry that was found, if the list records one.
+	Category string `json:"category,omitempty"`
+
+	// The policy the decision was made under, if any.
+	Policy string `json:"policy,omitempty"`
+
+	// True if the decision came from a cache rather than the authoritative list.
+	Cached bool `json:"cached"`
+
+	// The error text if an error was generated during the lookup.
+	Error string `json:"error,omitempty"`
+
+	// How the failed lookup was answered, one of open, closed or unavailable.
+	Failure string `json:"failure,omitempty"`
+
+	// Time spent checking the filter chain in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+}
+
+// Destination of the audit log. Write is called concurrently with a
+// single JSON line, without the trailing newline.
+type Sink interface {
+	// Write one line.
+	Write(line []byte) error
+
+	// Release the sink's resources.
+	Close() error
+}
+
+// Writes decisions to each sink, sampling the allowed ones.
+type Logger struct {
+	// Sinks each decision is written to.
+	sinks []Sink
+
+	// Fraction of allowed verdicts written.
+	allowedSampleRate float64
+}
+
+// Create a Logger writing to the sinks.
+func NewLogger(sinks []Sink, allowedSampleRate float64) *Logger {
+	return &Logger{sinks: sinks, allowedSampleRate: allowedSampleRate}
+}
+
+// Create a Logger from the config, nil if no sinks are configured.
+func CreateLogger(cfg config.Audit) (*Logger, error) {
+	if len(cfg.Sinks) == 0 {
+		return nil, nil
+	}
+
+	sinks := []Sink{}
+	for _, name := range cfg.Sinks {
+		var sink Sink
+		var err error
+		switch name {
+		case SINK_FILE:
+			sink, err = NewFileSink(cfg.File, int64(cfg.MaxSize)*1024*1024, cfg.MaxBackups)
+		case SINK_SYSLOG:
+			sink, err = NewSyslogSink(cfg.SyslogTag)
+		case SINK_STDOUT:
+			sink = NewWriterSink(os.Stdout)
+		default:
+			err = fmt.Errorf("%s is not a valid audit log sink.", name)
+		}
+
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return NewLogger(sinks, cfg.AllowedSampleRate), nil
+}
+
+// Write the decision to every sink, unless it's an allowed verdict that
+// wasn't sampled. Sink failures are logged, they never fail the lookup.
+func (l *Logger) Log(record *Record) {
+	if record.Verdict == VERDICT_ALLOWED && l.allowedSampleRate < 1 && rand.Float64() >= l.allowedSampleRate {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode the audit record for %s: %s.", record.URL, err)
+		return
+	}
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(line); err != nil {
+			log.Printf("Failed to write the audit record for %s: %s.", record.URL, err)
+		}
+	}
+}
+
+// Close every sink, returning the first error.
+func (l *Logger) Close() error {
+	var first error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Writes each line to an io.Writer, ie: stdout.
+type WriterSink struct {
+	// Where the lines are written.
+	writer io.Writer
+
+	// Keeps concurrent lines whole.
+	lock sync.Mutex
+}
+
+// Create a WriterSink on the writer.
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+// Write the line followed by a newline.
+func (s *WriterSink) Write(line []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Nothing to release, the writer belongs to the caller.
+func (s *WriterSink) Close() error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogWritesJSONLine(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := NewLogger([]Sink{NewWriterSink(out)}, 1)
+
+	l.Log(&Record{RequestID: "abc123", Client: "10.0.0.1", URL: "www.facebook.com", Verdict: "blocked", Filter: "Fake"})
+
+	record := &Record{}
+	if err := json.Unmarshal(bytes.TrimSuffix(out.Bytes(), []byte("\n")), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.RequestID != "abc123" || record.Client != "10.0.0.1" || record.URL != "www.facebook.com" || record.Verdict != "blocked" || record.Filter != "Fake" {
+		t.Errorf("The audit record was written as \"%s\".", out.String())
+	}
+}
+
+func TestLogSamplesAllowed(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := NewLogger([]Sink{NewWriterSink(out)}, 0)
+
+	l.Log(&Record{URL: "www.google.com", Verdict: VERDICT_ALLOWED})
+	if out.Len() != 0 {
+		t.Errorf("An allowed verdict was written with a sample rate of 0, got \"%s\".", out.String())
+	}
+
+	l.Log(&Record{URL: "www.facebook.com", Verdict: "blocked"})
+	l.Log(&Record{URL: "www.bookface.com", Verdict: "error"})
+	if lines := strings.Count(out.String(), "\n"); lines != 2 {
+		t.Errorf("%d blocked and error verdicts were written when 2 were expected.", lines)
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	s, err := NewFileSink(path, 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	// Each line fills the file, so every write after the first rotates.
+	for _, line := range []string{"first...", "second..", "third...", "fourth.."} {
+		if err := s.Write([]byte(line)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth..\n",
+		path + ".1": "third...\n",
+		path + ".2": "second..\n",
+	}
+	for file, contents := range expected {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if string(data) != contents {
+			t.Errorf("Audit log %s contained \"%s\" when \"%s\" was expected.", file, data, contents)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("More rotated audit logs were kept than configured.")
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := NewFileSink(path, 1024, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Write([]byte("new"))
+	s.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != "old\nnew\n" {
+		t.Errorf("Audit log contained \"%s\" when the new line was expected after the old one.", data)
+	}
+
+	if s.Write([]byte("closed")) == nil {
+		t.Error("Writing to a closed audit log didn't fail.")
+	}
+}
+
+func TestCreateLogger(t *testing.T) {
+	l, err := CreateLogger(config.NewAudit())
+	if err != nil || l != nil {
+		t.Errorf("An audit log without sinks was created as %v, %v.", l, err)
+	}
+
+	cfg := config.NewAudit()
+	cfg.Sinks = []string{SINK_FILE, SINK_STDOUT}
+	cfg.File = filepath.Join(t.TempDir(), "audit.log")
+	l, err = CreateLogger(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer l.Close()
+
+	if len(l.sinks) != 2 {
+		t.Errorf("%d audit log sinks were created when 2 were expected.", len(l.sinks))
+	}
+}
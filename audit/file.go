@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Appends lines to a file, rotating it once it reaches the maximum size.
+// Rotated files are renamed path.1, path.2 and so on, oldest last.
+type FileSink struct {
+	// Path of the current file.
+	path string
+
+	// Size in bytes at which the file is rotated.
+	maxSize int64
+
+	// Number of rotated files kept.
+	maxBackups int
+
+	// The current file, and how much has been written to it.
+	file *os.File
+	size int64
+
+	// Serializes writes and rotation.
+	lock sync.Mutex
+}
+
+// Create a FileSink appending to path.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write the line followed by a newline, rotating first if it would take
+// the file past the maximum size.
+func (s *FileSink) Write(line []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("The audit log %s is closed.", s.path)
+	}
+
+	line = append(line, '\n')
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close the current file.
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Open the file for appending, picking up the size of what's already there.
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Shift the rotated files along, dropping the oldest, and start a new file.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if s.maxBackups < 1 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
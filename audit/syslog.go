@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"log/syslog"
+)
+
+// Sends lines to the local syslog daemon.
+type SyslogSink struct {
+	// Connection to the syslog daemon, safe for concurrent use.
+	writer *syslog.Writer
+}
+
+// Create a SyslogSink sending info messages with the tag.
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Send the line as one message.
+func (s *SyslogSink) Write(line []byte) error {
+	return s.writer.Info(string(line))
+}
+
+// Close the connection to the syslog daemon.
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
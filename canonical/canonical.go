@@ -0,0 +1,241 @@
+// Canonicalization of URLs so the same URL written different ways is
+// stored and looked up in a single form.
+package canonical
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"strings"
+)
+
+// Default HTTP and HTTPS ports, stripped from the host. The scheme is
+// dropped from the canonical form so both are always considered default.
+var defaultPorts = map[string]bool{"80": true, "443": true}
+
+// Return the canonical form of the URL. The scheme, userinfo and fragment
+// are dropped, the host is lowercased and converted to punycode, default
+// ports are stripped, dot-segments in the path are resolved, and
+// percent-encoding is normalized. Any query parameter whose name matches
+// one of stripParams is removed. A trailing * in stripParams matches any
+// parameter starting with that prefix, ie: utm_*.
+//
+// The canonical form of EXAMPLE.com:80/a/../b?utm_source=x#top is
+// example.com/b.
+func Canonicalize(url string, stripParams []string) (string, error) {
+	url = strings.TrimSpace(url)
+
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+
+	query := ""
+	hasQuery := false
+	if i := strings.Index(url, "?"); i >= 0 {
+		query = url[i+1:]
+		hasQuery = true
+		url = url[:i]
+	}
+
+	path := ""
+	if i := strings.Index(url, "/"); i >= 0 {
+		path = url[i:]
+		url = url[:i]
+	}
+
+	host, err := canonicalHost(url)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", fmt.Errorf("URL %s has no host.", url)
+	}
+
+	canonical := host + RemoveDotSegments(normalizeEscapes(path))
+	if hasQuery {
+		query = StripParams(normalizeEscapes(query), stripParams)
+		if query != "" {
+			canonical += "?" + query
+		}
+	}
+
+	return canonical, nil
+}
+
+// Lowercase the host, drop userinfo and trailing dots, strip the default
+// port and convert internationalized hosts to punycode.
+func canonicalHost(authority string) (string, error) {
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
+	}
+
+	host, port := authority, ""
+	if i := strings.LastIndex(authority, ":"); i >= 0 && !strings.HasSuffix(authority, "]") {
+		host, port = authority[:i], authority[i+1:]
+	}
+
+	host = strings.ToLower(strings.TrimRight(unescape(host, func(byte) bool { return true }), "."))
+	if !isASCII(host) {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("Unable to convert host %s to punycode: %s", host, err)
+		}
+		host = ascii
+	}
+
+	if port != "" && !defaultPorts[port] {
+		host += ":" + port
+	}
+
+	return host, nil
+}
+
+// Resolve the . and .. segments in the path as described in RFC 3986
+// section 5.2.4. An empty path becomes /.
+func RemoveDotSegments(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// Never pop the leading empty segment that anchors the path at /.
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	resolved := strings.Join(output, "/")
+	if !strings.HasPrefix(resolved, "/") {
+		resolved = "/" + resolved
+	}
+	return resolved
+}
+
+// Remove every query parameter whose name matches one of names. A name
+// ending in * matches any parameter starting with that prefix.
+func StripParams(query string, names []string) string {
+	if len(names) == 0 || query == "" {
+		return query
+	}
+
+	params := strings.Split(query, "&")
+	kept := params[:0]
+	for _, param := range params {
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+
+		if !matchesAny(name, names) {
+			kept = append(kept, param)
+		}
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// Return true if the parameter name matches one of the names or prefixes.
+func matchesAny(name string, names []string) bool {
+	for _, match := range names {
+		if strings.HasSuffix(match, "*") {
+			if strings.HasPrefix(name, match[:len(match)-1]) {
+				return true
+			}
+		} else if name == match {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize percent-encoding. Escaped unreserved characters are decoded,
+// the remaining escapes are uppercased, and anything that can't appear
+// unescaped in a URL is escaped.
+func normalizeEscapes(s string) string {
+	return escape(unescape(s, isUnreserved))
+}
+
+// Decode the percent-encoded characters for which decode returns true.
+// Malformed escapes are left alone.
+func unescape(s string, decode func(byte) bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if decode(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Escape control characters, spaces, non-ASCII bytes and stray %.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteString(s[i : i+3])
+			i += 2
+		} else if c <= ' ' || c >= 0x7f || c == '%' || c == '"' || c == '<' || c == '>' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// RFC 3986 unreserved characters, these never need to be escaped.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
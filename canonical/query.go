@@ -0,0 +1,44 @@
+package canonical
+
+import (
+	"sort"
+	"strings"
+)
+
+// Split the URL into everything before the query string, and the query
+// parameters. The parameters are returned in the order they appear.
+func SplitQuery(url string) (string, []string) {
+	i := strings.Index(url, "?")
+	if i < 0 {
+		return url, nil
+	}
+
+	base, query := url[:i], url[i+1:]
+	if query == "" {
+		return base, nil
+	}
+	return base, strings.Split(query, "&")
+}
+
+// Join the URL and query parameters back together.
+func JoinQuery(base string, params []string) string {
+	if len(params) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// Return the URL with its query parameters sorted, so that the order the
+// parameters were written in doesn't matter when comparing URLs. Repeated
+// parameters are kept, the query is compared as a sorted multiset.
+func SortQuery(url string) string {
+	base, params := SplitQuery(url)
+	if len(params) < 2 {
+		return url
+	}
+
+	sorted := make([]string, len(params))
+	copy(sorted, params)
+	sort.Strings(sorted)
+	return JoinQuery(base, sorted)
+}
@@ -0,0 +1,39 @@
+package canonical
+
+import (
+	"testing"
+)
+
+var sortedURLs = map[string]string{
+	"example.com/a":                 "example.com/a",
+	"example.com/a?":                "example.com/a?",
+	"example.com/a?b=2":             "example.com/a?b=2",
+	"example.com/a?b=2&a=1":         "example.com/a?a=1&b=2",
+	"example.com/a?a=1&b=2":         "example.com/a?a=1&b=2",
+	"example.com/a?b=2&a=1&b=1&a=1": "example.com/a?a=1&a=1&b=1&b=2",
+}
+
+func TestSortQuery(t *testing.T) {
+	for url, expected := range sortedURLs {
+		sorted := SortQuery(url)
+		if sorted != expected {
+			t.Errorf("The sorted form of %s was %s when %s was expected.", url, sorted, expected)
+		}
+	}
+}
+
+func TestSplitJoinQuery(t *testing.T) {
+	base, params := SplitQuery("example.com/a?b=2&a=1")
+	if base != "example.com/a" || len(params) != 2 || params[0] != "b=2" || params[1] != "a=1" {
+		t.Errorf("Split example.com/a?b=2&a=1 into %s and %v.", base, params)
+	}
+
+	url := JoinQuery(base, params)
+	if url != "example.com/a?b=2&a=1" {
+		t.Errorf("Joined %s and %v into %s.", base, params, url)
+	}
+
+	if JoinQuery(base, nil) != base {
+		t.Errorf("Joining %s with no parameters gave %s.", base, JoinQuery(base, nil))
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+// Config for the admin API used to add and remove URLs at runtime.
+type Admin struct {
+	// API keys allowed to use the admin API, sent in the X-API-Key header.
+	// The admin API is disabled if there are none - default [].
+	APIKeys []string `json:"apiKeys"`
+}
+
+// Return Admin config with default values.
+func NewAdmin() Admin {
+	return Admin{
+		APIKeys: []string{},
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+// Config for the allowlist filter.
+type Allowlist struct {
+	// Where the allowlist is stored. Valid options are: redis, mysql and file - default "file".
+	Source string `json:"source"`
+
+	// Redis config, used if the source is redis.
+	Redis Redis `json:"redis"`
+
+	// Key of the Redis set holding the allowlist - default "URLFilterAllowlist".
+	RedisKey string `json:"rediskey"`
+
+	// MySQL config, used if the source is mysql. The allowlist is stored in the allowurls table.
+	MySQL MySQL `json:"mysql"`
+
+	// Path to the allowlist file, one entry per line, used if the source is file - default "".
+	File string `json:"file"`
+}
+
+// Return Allowlist config with default values.
+func NewAllowlist() Allowlist {
+	return Allowlist{
+		Source:   "file",
+		Redis:    NewRedis(),
+		RedisKey: "URLFilterAllowlist",
+		MySQL:    NewMySQL(),
+		File:     "",
+	}
+}
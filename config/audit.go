@@ -0,0 +1,36 @@
+package config
+
+// Config for the decision audit log.
+type Audit struct {
+	// Sinks the audit log is written to, any of "file", "syslog" and
+	// "stdout". Disabled if empty - default [].
+	Sinks []string `json:"sinks"`
+
+	// Path of the audit log for the file sink - default "urlfilter-audit.log".
+	File string `json:"file"`
+
+	// Size, in megabytes, at which the audit log file is rotated - default 100.
+	MaxSize int `json:"maxSize"`
+
+	// Number of rotated audit log files kept - default 5.
+	MaxBackups int `json:"maxBackups"`
+
+	// Tag of the syslog sink's messages - default "urlfilter".
+	SyslogTag string `json:"syslogTag"`
+
+	// Fraction of allowed verdicts logged, between 0 and 1. Blocked and
+	// error verdicts are always logged - default 1.
+	AllowedSampleRate float64 `json:"allowedSampleRate"`
+}
+
+// Return Audit config with default values.
+func NewAudit() Audit {
+	return Audit{
+		Sinks:             []string{},
+		File:              "urlfilter-audit.log",
+		MaxSize:           100,
+		MaxBackups:        5,
+		SyslogTag:         "urlfilter",
+		AllowedSampleRate: 1,
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+// Config for the batch lookup endpoint.
+type Batch struct {
+	// Maximum number of URLs accepted in a single batch request - default 100.
+	MaxURLs int `json:"maxURLs"`
+
+	// Number of lookups run concurrently for each batch request - default 10.
+	Workers int `json:"workers"`
+}
+
+// Return Batch config with default values.
+func NewBatch() Batch {
+	return Batch{
+		MaxURLs: 100,
+		Workers: 10,
+	}
+}
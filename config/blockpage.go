@@ -0,0 +1,25 @@
+package config
+
+// Config for the page returned when the filter endpoint blocks a URL.
+type BlockPage struct {
+	// Return the HTML block page to every requester that doesn't ask for
+	// JSON, not only to those that accept text/html - default false.
+	HTML bool `json:"html"`
+
+	// Path to an html/template file for the block page. The built-in page
+	// is used if empty - default "".
+	Template string `json:"template"`
+
+	// If set blocked URLs get a 302 to this URL instead of a 403, with the
+	// url, category and requestId query parameters added - default "".
+	RedirectURL string `json:"redirectURL"`
+}
+
+// Return BlockPage config with default values.
+func NewBlockPage() BlockPage {
+	return BlockPage{
+		HTML:        false,
+		Template:    "",
+		RedirectURL: "",
+	}
+}
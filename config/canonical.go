@@ -0,0 +1,13 @@
+package config
+
+// Config for the URL canonicalization filter.
+type Canonical struct {
+	// Query parameters stripped from URLs. A trailing * matches any
+	// parameter starting with that prefix, ie: utm_* - default [].
+	StripParams []string `json:"stripParams"`
+}
+
+// Return Canonical config with default values.
+func NewCanonical() Canonical {
+	return Canonical{}
+}
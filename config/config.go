@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/url"
 	"os"
 )
 
@@ -17,7 +20,7 @@ type Config struct {
 	Port string `json:"port"`
 
 	// Filter chain. Filters are called left to right - default ["redis"].
-	// Valid options are: redis, mysql, redismysqlbloom and fake.
+	// Valid options are: canonical, match, allowlist, redis, mysql, redismysqlbloom and fake.
 	Filters []string `json:"filters"`
 
 	// Config for Redis.
@@ -28,10 +31,67 @@ type Config struct {
 
 	// Config for Redis Bloom Filter.
 	RedisMySQLBloom RedisMySQLBloom `json:"redismysqlbloom"`
+
+	// Config for the batch lookup endpoint.
+	Batch Batch `json:"batch"`
+
+	// Config for the URL canonicalization filter.
+	Canonical Canonical `json:"canonical"`
+
+	// Config for the match filter.
+	Match Match `json:"match"`
+
+	// Config for the allowlist filter.
+	Allowlist Allowlist `json:"allowlist"`
+
+	// Blocking policies by name, selected per request by API key or the
+	// urlfilter-policy query parameter - default {}.
+	Policies map[string]Policy `json:"policies"`
+
+	// Policy used when a request doesn't select one. If empty every flagged
+	// URL is blocked - default "".
+	DefaultPolicy string `json:"defaultPolicy"`
+
+	// Config for the admin API.
+	Admin Admin `json:"admin"`
+
+	// Config for the gRPC lookup service. CheckMany uses the batch limits.
+	GRPC GRPC `json:"grpc"`
+
+	// Config for the Envoy external authorization service, served on the
+	// gRPC port.
+	ExtAuthz ExtAuthz `json:"extAuthz"`
+
+	// Config for the ICAP REQMOD service.
+	ICAP ICAP `json:"icap"`
+
+	// Config for the blocking DNS resolver.
+	DNS DNS `json:"dns"`
+
+	// Config for the forward HTTP proxy.
+	Proxy Proxy `json:"proxy"`
+
+	// Config for the page returned when the filter endpoint blocks a URL.
+	BlockPage BlockPage `json:"blockPage"`
+
+	// Config for the webhooks notified of blocked lookups.
+	Webhook Webhook `json:"webhook"`
+
+	// Config for the decision audit log.
+	Audit Audit `json:"audit"`
+
+	// Config for lookup deadlines and shutdown.
+	Timeouts Timeouts `json:"timeouts"`
+
+	// Config for answering lookups that failed.
+	Failure Failure `json:"failure"`
 }
 
 // Valid Filters to use as Cache
-var validFilters = map[string]bool{"redismysqlbloom": true, "mysql": true, "redis": true, "fake": true}
+var validFilters = map[string]bool{"canonical": true, "match": true, "allowlist": true, "redismysqlbloom": true, "mysql": true, "redis": true, "fake": true}
+
+// Filters the admin API can write to, when they're last in the chain.
+var validAdminStores = map[string]bool{"mysql": true, "redis": true}
 
 // Return Config with default values.
 func NewConfig() *Config {
@@ -42,6 +102,23 @@ func NewConfig() *Config {
 		Redis:           NewRedis(),
 		MySQL:           NewMySQL(),
 		RedisMySQLBloom: NewRedisMySQLBloom(),
+		Batch:           NewBatch(),
+		Canonical:       NewCanonical(),
+		Match:           NewMatch(),
+		Allowlist:       NewAllowlist(),
+		Policies:        map[string]Policy{},
+		DefaultPolicy:   "",
+		Admin:           NewAdmin(),
+		GRPC:            NewGRPC(),
+		ExtAuthz:        NewExtAuthz(),
+		ICAP:            NewICAP(),
+		DNS:             NewDNS(),
+		Proxy:           NewProxy(),
+		BlockPage:       NewBlockPage(),
+		Webhook:         NewWebhook(),
+		Audit:           NewAudit(),
+		Timeouts:        NewTimeouts(),
+		Failure:         NewFailure(),
 	}
 }
 
@@ -64,6 +141,88 @@ func ValidateConfig(config *Config) error {
 			return fmt.Errorf("%s is not a valid filter, the only valid options are %v", config.Filters[i], validFilters)
 		}
 	}
+
+	// The admin API writes to the store at the end of the chain.
+	if len(config.Admin.APIKeys) > 0 {
+		if len(config.Filters) == 0 || !validAdminStores[config.Filters[len(config.Filters)-1]] {
+			return fmt.Errorf("The admin API needs the filter chain to end in one of %v.", validAdminStores)
+		}
+	}
+
+	if config.Match.MaxQueryParams < 1 || config.Match.MaxQueryParams > MAX_MATCH_QUERY_PARAMS {
+		return fmt.Errorf("%d is not a valid maxQueryParams, it must be between 1 and %d.", config.Match.MaxQueryParams, MAX_MATCH_QUERY_PARAMS)
+	}
+
+	if config.Batch.MaxURLs < 1 || config.Batch.Workers < 1 {
+		return fmt.Errorf("The batch URL limit and workers must be at least 1.")
+	}
+
+	if _, ok := config.Policies[config.DefaultPolicy]; config.DefaultPolicy != "" && !ok {
+		return fmt.Errorf("The default policy %s is not one of the configured policies.", config.DefaultPolicy)
+	}
+
+	if config.ExtAuthz.Enabled && config.GRPC.Port == "" {
+		return fmt.Errorf("The Envoy ext_authz service is served on the gRPC port, which isn't set.")
+	}
+
+	if config.ExtAuthz.DeniedStatus < 100 || config.ExtAuthz.DeniedStatus > 599 {
+		return fmt.Errorf("%d is not a valid HTTP status for blocked URLs.", config.ExtAuthz.DeniedStatus)
+	}
+
+	if err := validateDNS(config); err != nil {
+		return err
+	}
+
+	if _, ok := config.Policies[config.Proxy.Policy]; config.Proxy.Policy != "" && !ok {
+		return fmt.Errorf("The proxy policy %s is not one of the configured policies.", config.Proxy.Policy)
+	}
+
+	for _, port := range config.Proxy.ConnectPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%d is not a valid port for proxy tunnels.", port)
+		}
+	}
+
+	if redirect, err := url.Parse(config.BlockPage.RedirectURL); config.BlockPage.RedirectURL != "" && (err != nil || !redirect.IsAbs()) {
+		return fmt.Errorf("The block page redirect %s is not an absolute URL.", config.BlockPage.RedirectURL)
+	}
+
+	if err := validateWebhook(config); err != nil {
+		return err
+	}
+
+	if err := validateAudit(config); err != nil {
+		return err
+	}
+
+	if config.Timeouts.Lookup < 0 {
+		return fmt.Errorf("%d is not a valid lookup deadline.", config.Timeouts.Lookup)
+	}
+
+	if config.Timeouts.Shutdown < 0 {
+		return fmt.Errorf("%d is not a valid shutdown timeout.", config.Timeouts.Shutdown)
+	}
+
+	for name, timeout := range config.Timeouts.Filters {
+		if !validFilters[name] || timeout < 0 {
+			return fmt.Errorf("%d is not a valid timeout for the %s filter.", timeout, name)
+		}
+	}
+
+	if err := validateFailure(config); err != nil {
+		return err
+	}
+
+	keys := map[string]string{}
+	for name, policy := range config.Policies {
+		for _, key := range policy.APIKeys {
+			if other, ok := keys[key]; ok {
+				return fmt.Errorf("An API key is used by both the %s and %s policies.", other, name)
+			}
+			keys[key] = name
+		}
+	}
+
 	return nil
 }
 
@@ -76,3 +235,107 @@ func ParseConfig(reader io.Reader) (*Config, error) {
 	err := ValidateConfig(config)
 	return config, err
 }
+
+// Validate the DNS resolver config, only if it's enabled.
+func validateDNS(config *Config) error {
+	if config.DNS.Port == "" {
+		return nil
+	}
+
+	if config.DNS.Upstream == "" {
+		return fmt.Errorf("The DNS resolver needs an upstream resolver.")
+	}
+
+	// TTLs are unsigned 32 bit values with the top bit clear.
+	if config.DNS.TTL < 0 || config.DNS.TTL > math.MaxInt32 {
+		return fmt.Errorf("%d is not a valid DNS TTL.", config.DNS.TTL)
+	}
+
+	if ip := net.ParseIP(config.DNS.SinkholeIPv4); config.DNS.SinkholeIPv4 != "" && (ip == nil || ip.To4() == nil) {
+		return fmt.Errorf("%s is not a valid IPv4 sinkhole address.", config.DNS.SinkholeIPv4)
+	}
+
+	if ip := net.ParseIP(config.DNS.SinkholeIPv6); config.DNS.SinkholeIPv6 != "" && (ip == nil || ip.To4() != nil) {
+		return fmt.Errorf("%s is not a valid IPv6 sinkhole address.", config.DNS.SinkholeIPv6)
+	}
+
+	if _, ok := config.Policies[config.DNS.Policy]; config.DNS.Policy != "" && !ok {
+		return fmt.Errorf("The DNS policy %s is not one of the configured policies.", config.DNS.Policy)
+	}
+
+	return nil
+}
+
+// Validate the webhook config, only if it's enabled.
+func validateWebhook(config *Config) error {
+	if len(config.Webhook.URLs) == 0 {
+		return nil
+	}
+
+	for _, webhook := range config.Webhook.URLs {
+		if target, err := url.Parse(webhook); err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return fmt.Errorf("The webhook %s is not an http or https URL.", webhook)
+		}
+	}
+
+	if config.Webhook.BatchSize < 1 || config.Webhook.QueueSize < 1 {
+		return fmt.Errorf("The webhook batch and queue sizes must be at least 1.")
+	}
+
+	return nil
+}
+
+var validAuditSinks = map[string]bool{
+	"file":   true,
+	"syslog": true,
+	"stdout": true,
+}
+
+// Validate the audit log config.
+func validateAudit(config *Config) error {
+	for _, sink := range config.Audit.Sinks {
+		if !validAuditSinks[sink] {
+			return fmt.Errorf("%s is not a valid audit log sink, the only valid options are %v", sink, validAuditSinks)
+		}
+
+		if sink == "file" && (config.Audit.File == "" || config.Audit.MaxSize < 1) {
+			return fmt.Errorf("The audit log file sink needs a file and a maximum size of at least 1MB.")
+		}
+	}
+
+	if config.Audit.AllowedSampleRate < 0 || config.Audit.AllowedSampleRate > 1 {
+		return fmt.Errorf("%g is not a valid audit log sample rate, it must be between 0 and 1.", config.Audit.AllowedSampleRate)
+	}
+
+	return nil
+}
+
+var validFailureModes = map[string]bool{
+	"open":        true,
+	"closed":      true,
+	"unavailable": true,
+}
+
+// Validate the failed lookup config. An empty mode reports failed lookups
+// as errors.
+func validateFailure(config *Config) error {
+	if config.Failure.Mode != "" && !validFailureModes[config.Failure.Mode] {
+		return fmt.Errorf("%s is not a valid failure mode, the only valid options are %v", config.Failure.Mode, validFailureModes)
+	}
+
+	for name, mode := range config.Failure.Filters {
+		if !validFilters[name] {
+			return fmt.Errorf("%s is not a valid filter for a failure mode, the only valid options are %v", name, validFilters)
+		}
+
+		if mode != "" && !validFailureModes[mode] {
+			return fmt.Errorf("%s is not a valid failure mode for the %s filter.", mode, name)
+		}
+	}
+
+	if config.Failure.RetryAfter < 0 {
+		return fmt.Errorf("%d is not a valid Retry-After.", config.Failure.RetryAfter)
+	}
+
+	return nil
+}
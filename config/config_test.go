@@ -83,6 +83,270 @@ func TestNewBloomDefaults(t *testing.T) {
 	}
 }
 
+func TestNewBatchDefaults(t *testing.T) {
+	batch := NewBatch()
+
+	if batch.MaxURLs != 100 {
+		t.Errorf("Batch.MaxURLs should be 100 but was %d.", batch.MaxURLs)
+	}
+
+	if batch.Workers != 10 {
+		t.Errorf("Batch.Workers should be 10 but was %d.", batch.Workers)
+	}
+}
+
+func TestNewCanonicalDefaults(t *testing.T) {
+	canonical := NewCanonical()
+
+	if len(canonical.StripParams) > 0 {
+		t.Errorf("Canonical.StripParams should be empty but was %v.", canonical.StripParams)
+	}
+}
+
+func TestNewMatchDefaults(t *testing.T) {
+	match := NewMatch()
+
+	if match.QuerySubsets {
+		t.Error("Match.QuerySubsets should be false but was true.")
+	}
+
+	if match.MaxQueryParams != 8 {
+		t.Errorf("Match.MaxQueryParams should be 8 but was %d.", match.MaxQueryParams)
+	}
+
+	if match.Hierarchical {
+		t.Error("Match.Hierarchical should be false but was true.")
+	}
+}
+
+func TestNewAllowlistDefaults(t *testing.T) {
+	allowlist := NewAllowlist()
+
+	if allowlist.Source != "file" {
+		t.Errorf("Allowlist.Source should be file but was %s.", allowlist.Source)
+	}
+
+	if allowlist.RedisKey != "URLFilterAllowlist" {
+		t.Errorf("Allowlist.RedisKey should be URLFilterAllowlist but was %s.", allowlist.RedisKey)
+	}
+
+	if allowlist.File != "" {
+		t.Errorf("Allowlist.File should be empty but was %s.", allowlist.File)
+	}
+
+	redis := NewRedis()
+	if !cmp.Equal(allowlist.Redis, redis) {
+		t.Error("The default allowlist config options had non-default Redis config.")
+		t.Error(cmp.Diff(allowlist.Redis, redis))
+	}
+
+	mysql := NewMySQL()
+	if !cmp.Equal(allowlist.MySQL, mysql) {
+		t.Error("The default allowlist config options had non-default MySQL config.")
+		t.Error(cmp.Diff(allowlist.MySQL, mysql))
+	}
+}
+
+func TestNewPolicyDefaults(t *testing.T) {
+	policy := NewPolicy()
+
+	if len(policy.Categories) > 0 {
+		t.Errorf("Policy.Categories should be empty but was %v.", policy.Categories)
+	}
+
+	if len(policy.APIKeys) > 0 {
+		t.Errorf("Policy.APIKeys should be empty but was %v.", policy.APIKeys)
+	}
+}
+
+func TestNewAdminDefaults(t *testing.T) {
+	admin := NewAdmin()
+
+	if len(admin.APIKeys) > 0 {
+		t.Errorf("Admin.APIKeys should be empty but was %v.", admin.APIKeys)
+	}
+}
+
+func TestNewGRPCDefaults(t *testing.T) {
+	grpc := NewGRPC()
+
+	if grpc.Port != "" {
+		t.Errorf("GRPC.Port should be empty but was %s.", grpc.Port)
+	}
+}
+
+func TestNewExtAuthzDefaults(t *testing.T) {
+	extAuthz := NewExtAuthz()
+
+	if extAuthz.Enabled {
+		t.Error("ExtAuthz.Enabled should be false but was true.")
+	}
+
+	if extAuthz.DeniedStatus != 403 {
+		t.Errorf("ExtAuthz.DeniedStatus should be 403 but was %d.", extAuthz.DeniedStatus)
+	}
+
+	if extAuthz.DeniedBody != "Blocked by urlfilter." {
+		t.Errorf("ExtAuthz.DeniedBody should be \"Blocked by urlfilter.\" but was %s.", extAuthz.DeniedBody)
+	}
+}
+
+func TestNewICAPDefaults(t *testing.T) {
+	icap := NewICAP()
+
+	if icap.Port != "" {
+		t.Errorf("ICAP.Port should be empty but was %s.", icap.Port)
+	}
+}
+
+func TestNewDNSDefaults(t *testing.T) {
+	dns := NewDNS()
+
+	if dns.Port != "" || dns.Upstream != "" {
+		t.Errorf("DNS.Port and DNS.Upstream should be empty but were %s and %s.", dns.Port, dns.Upstream)
+	}
+
+	if dns.SinkholeIPv4 != "" || dns.SinkholeIPv6 != "" {
+		t.Errorf("DNS.SinkholeIPv4 and DNS.SinkholeIPv6 should be empty but were %s and %s.", dns.SinkholeIPv4, dns.SinkholeIPv6)
+	}
+
+	if dns.TTL != 60 {
+		t.Errorf("DNS.TTL should be 60 but was %d.", dns.TTL)
+	}
+
+	if dns.Policy != "" {
+		t.Errorf("DNS.Policy should be empty but was %s.", dns.Policy)
+	}
+}
+
+func TestNewProxyDefaults(t *testing.T) {
+	proxy := NewProxy()
+
+	if proxy.Port != "" {
+		t.Errorf("Proxy.Port should be empty but was %s.", proxy.Port)
+	}
+
+	if proxy.Policy != "" {
+		t.Errorf("Proxy.Policy should be empty but was %s.", proxy.Policy)
+	}
+
+	if proxy.Host != "127.0.0.1" {
+		t.Errorf("Proxy.Host should be 127.0.0.1 but was %s.", proxy.Host)
+	}
+
+	if !cmp.Equal(proxy.ConnectPorts, []int{443}) {
+		t.Errorf("Proxy.ConnectPorts should be [443] but was %v.", proxy.ConnectPorts)
+	}
+}
+
+func TestNewBlockPageDefaults(t *testing.T) {
+	blockPage := NewBlockPage()
+
+	if blockPage.HTML {
+		t.Error("BlockPage.HTML should be false but was true.")
+	}
+
+	if blockPage.Template != "" {
+		t.Errorf("BlockPage.Template should be empty but was %s.", blockPage.Template)
+	}
+
+	if blockPage.RedirectURL != "" {
+		t.Errorf("BlockPage.RedirectURL should be empty but was %s.", blockPage.RedirectURL)
+	}
+}
+
+func TestNewWebhookDefaults(t *testing.T) {
+	webhook := NewWebhook()
+
+	if len(webhook.URLs) != 0 {
+		t.Errorf("Webhook.URLs should be empty but was %v.", webhook.URLs)
+	}
+
+	if webhook.BatchSize != 100 {
+		t.Errorf("Webhook.BatchSize should be 100 but was %d.", webhook.BatchSize)
+	}
+
+	if webhook.FlushInterval != 1000 {
+		t.Errorf("Webhook.FlushInterval should be 1000 but was %d.", webhook.FlushInterval)
+	}
+
+	if webhook.QueueSize != 10000 {
+		t.Errorf("Webhook.QueueSize should be 10000 but was %d.", webhook.QueueSize)
+	}
+
+	if webhook.MaxRetries != 3 {
+		t.Errorf("Webhook.MaxRetries should be 3 but was %d.", webhook.MaxRetries)
+	}
+
+	if webhook.RetryBackoff != 500 {
+		t.Errorf("Webhook.RetryBackoff should be 500 but was %d.", webhook.RetryBackoff)
+	}
+
+	if webhook.Timeout != 5 {
+		t.Errorf("Webhook.Timeout should be 5 but was %d.", webhook.Timeout)
+	}
+}
+
+func TestNewAuditDefaults(t *testing.T) {
+	audit := NewAudit()
+
+	if len(audit.Sinks) != 0 {
+		t.Errorf("Audit.Sinks should be empty but was %v.", audit.Sinks)
+	}
+
+	if audit.File != "urlfilter-audit.log" {
+		t.Errorf("Audit.File should be urlfilter-audit.log but was %s.", audit.File)
+	}
+
+	if audit.MaxSize != 100 {
+		t.Errorf("Audit.MaxSize should be 100 but was %d.", audit.MaxSize)
+	}
+
+	if audit.MaxBackups != 5 {
+		t.Errorf("Audit.MaxBackups should be 5 but was %d.", audit.MaxBackups)
+	}
+
+	if audit.SyslogTag != "urlfilter" {
+		t.Errorf("Audit.SyslogTag should be urlfilter but was %s.", audit.SyslogTag)
+	}
+
+	if audit.AllowedSampleRate != 1 {
+		t.Errorf("Audit.AllowedSampleRate should be 1 but was %g.", audit.AllowedSampleRate)
+	}
+}
+
+func TestNewTimeoutsDefaults(t *testing.T) {
+	timeouts := NewTimeouts()
+
+	if timeouts.Lookup != 0 {
+		t.Errorf("Timeouts.Lookup should be 0 but was %d.", timeouts.Lookup)
+	}
+
+	if len(timeouts.Filters) != 0 {
+		t.Errorf("Timeouts.Filters should be empty but was %v.", timeouts.Filters)
+	}
+
+	if timeouts.Shutdown != 10000 {
+		t.Errorf("Timeouts.Shutdown should be 10000 but was %d.", timeouts.Shutdown)
+	}
+}
+
+func TestNewFailureDefaults(t *testing.T) {
+	failure := NewFailure()
+
+	if failure.Mode != "" {
+		t.Errorf("Failure.Mode should be empty but was %s.", failure.Mode)
+	}
+
+	if failure.RetryAfter != 5 {
+		t.Errorf("Failure.RetryAfter should be 5 but was %d.", failure.RetryAfter)
+	}
+
+	if len(failure.Filters) != 0 {
+		t.Errorf("Failure.Filters should be empty but was %v.", failure.Filters)
+	}
+}
+
 func TestNewConfig(t *testing.T) {
 	config := NewConfig()
 
@@ -115,13 +379,111 @@ func TestNewConfig(t *testing.T) {
 		t.Error("The default config options had non-default Bloom config.")
 		t.Error(cmp.Diff(config.RedisMySQLBloom, bloom))
 	}
+
+	batch := NewBatch()
+	if !cmp.Equal(config.Batch, batch) {
+		t.Error("The default config options had non-default Batch config.")
+		t.Error(cmp.Diff(config.Batch, batch))
+	}
+
+	canonical := NewCanonical()
+	if !cmp.Equal(config.Canonical, canonical) {
+		t.Error("The default config options had non-default Canonical config.")
+		t.Error(cmp.Diff(config.Canonical, canonical))
+	}
+
+	match := NewMatch()
+	if !cmp.Equal(config.Match, match) {
+		t.Error("The default config options had non-default Match config.")
+		t.Error(cmp.Diff(config.Match, match))
+	}
+
+	allowlist := NewAllowlist()
+	if !cmp.Equal(config.Allowlist, allowlist) {
+		t.Error("The default config options had non-default Allowlist config.")
+		t.Error(cmp.Diff(config.Allowlist, allowlist))
+	}
+
+	if len(config.Policies) > 0 {
+		t.Errorf("The Policies should be empty but were %v.", config.Policies)
+	}
+
+	if config.DefaultPolicy != "" {
+		t.Errorf("The DefaultPolicy should be empty but was %s.", config.DefaultPolicy)
+	}
+
+	admin := NewAdmin()
+	if !cmp.Equal(config.Admin, admin) {
+		t.Error("The default config options had non-default Admin config.")
+		t.Error(cmp.Diff(config.Admin, admin))
+	}
+
+	grpc := NewGRPC()
+	if !cmp.Equal(config.GRPC, grpc) {
+		t.Error("The default config options had non-default GRPC config.")
+		t.Error(cmp.Diff(config.GRPC, grpc))
+	}
+
+	extAuthz := NewExtAuthz()
+	if !cmp.Equal(config.ExtAuthz, extAuthz) {
+		t.Error("The default config options had non-default ExtAuthz config.")
+		t.Error(cmp.Diff(config.ExtAuthz, extAuthz))
+	}
+
+	icap := NewICAP()
+	if !cmp.Equal(config.ICAP, icap) {
+		t.Error("The default config options had non-default ICAP config.")
+		t.Error(cmp.Diff(config.ICAP, icap))
+	}
+
+	dns := NewDNS()
+	if !cmp.Equal(config.DNS, dns) {
+		t.Error("The default config options had non-default DNS config.")
+		t.Error(cmp.Diff(config.DNS, dns))
+	}
+
+	proxy := NewProxy()
+	if !cmp.Equal(config.Proxy, proxy) {
+		t.Error("The default config options had non-default Proxy config.")
+		t.Error(cmp.Diff(config.Proxy, proxy))
+	}
+
+	blockPage := NewBlockPage()
+	if !cmp.Equal(config.BlockPage, blockPage) {
+		t.Error("The default config options had non-default BlockPage config.")
+		t.Error(cmp.Diff(config.BlockPage, blockPage))
+	}
+
+	webhook := NewWebhook()
+	if !cmp.Equal(config.Webhook, webhook) {
+		t.Error("The default config options had non-default Webhook config.")
+		t.Error(cmp.Diff(config.Webhook, webhook))
+	}
+
+	audit := NewAudit()
+	if !cmp.Equal(config.Audit, audit) {
+		t.Error("The default config options had non-default Audit config.")
+		t.Error(cmp.Diff(config.Audit, audit))
+	}
+
+	timeouts := NewTimeouts()
+	if !cmp.Equal(config.Timeouts, timeouts) {
+		t.Error("The default config options had non-default Timeouts config.")
+		t.Error(cmp.Diff(config.Timeouts, timeouts))
+	}
+
+	failure := NewFailure()
+	if !cmp.Equal(config.Failure, failure) {
+		t.Error("The default config options had non-default Failure config.")
+		t.Error(cmp.Diff(config.Failure, failure))
+	}
 }
 
 func TestParseConfig(t *testing.T) {
 	config := NewConfig()
 	config.Host = "google.ca"
 	config.Port = "6060"
-	config.Filters = []string{"redis", "fake"}
+	config.Filters = []string{"canonical", "redis", "mysql"}
 
 	config.Redis.Host = "google.ca"
 	config.Redis.Port = "444"
@@ -150,6 +512,74 @@ func TestParseConfig(t *testing.T) {
 	config.RedisMySQLBloom.MySQL.Username = "used"
 	config.RedisMySQLBloom.MySQL.Password = "Changeme"
 
+	config.Batch.MaxURLs = 5
+	config.Batch.Workers = 2
+
+	config.Canonical.StripParams = []string{"utm_*", "fbclid"}
+
+	config.Match.QuerySubsets = true
+	config.Match.MaxQueryParams = 3
+	config.Match.Hierarchical = true
+
+	config.Allowlist.Source = "redis"
+	config.Allowlist.Redis.Host = "google.ca"
+	config.Allowlist.RedisKey = "partners"
+	config.Allowlist.MySQL.Host = "google.ca"
+	config.Allowlist.File = "/etc/urlfilter/allowlist.txt"
+
+	config.Policies["guest"] = Policy{Categories: []string{"malware", "adult"}, APIKeys: []string{"guestkey"}}
+	config.Policies["staff"] = Policy{Categories: []string{"malware"}, APIKeys: []string{}}
+	config.DefaultPolicy = "staff"
+
+	config.Admin.APIKeys = []string{"adminkey"}
+
+	config.GRPC.Port = "9090"
+
+	config.ExtAuthz.Enabled = true
+	config.ExtAuthz.DeniedStatus = 451
+	config.ExtAuthz.DeniedBody = "Nope."
+
+	config.ICAP.Port = "1344"
+
+	config.DNS.Port = "5353"
+	config.DNS.Upstream = "8.8.8.8:53"
+	config.DNS.SinkholeIPv4 = "10.0.0.1"
+	config.DNS.SinkholeIPv6 = "fd00::1"
+	config.DNS.TTL = 30
+	config.DNS.Policy = "guest"
+
+	config.Proxy.Port = "3128"
+	config.Proxy.Host = "0.0.0.0"
+	config.Proxy.Policy = "staff"
+	config.Proxy.ConnectPorts = []int{443, 8443}
+
+	config.BlockPage.HTML = true
+	config.BlockPage.Template = "/etc/urlfilter/blocked.html"
+	config.BlockPage.RedirectURL = "https://blocked.example.com/"
+
+	config.Webhook.URLs = []string{"https://soc.example.com/hook"}
+	config.Webhook.BatchSize = 10
+	config.Webhook.FlushInterval = 200
+	config.Webhook.QueueSize = 50
+	config.Webhook.MaxRetries = 5
+	config.Webhook.RetryBackoff = 100
+	config.Webhook.Timeout = 2
+
+	config.Audit.Sinks = []string{"file", "stdout"}
+	config.Audit.File = "/var/log/urlfilter/audit.log"
+	config.Audit.MaxSize = 10
+	config.Audit.MaxBackups = 2
+	config.Audit.SyslogTag = "urlfilter-audit"
+	config.Audit.AllowedSampleRate = 0.1
+
+	config.Timeouts.Lookup = 2000
+	config.Timeouts.Filters = map[string]int{"mysql": 500, "redis": 50}
+	config.Timeouts.Shutdown = 30000
+
+	config.Failure.Mode = "closed"
+	config.Failure.RetryAfter = 30
+	config.Failure.Filters = map[string]string{"redis": "open"}
+
 	configBytes, err := json.Marshal(config)
 	if err != nil {
 		t.Fatal("Failed to create JSON string from config.Config")
@@ -181,6 +611,233 @@ func TestValidateConfigFailure(t *testing.T) {
 	}
 }
 
+func TestValidateConfigAdminStore(t *testing.T) {
+	config := NewConfig()
+	config.Admin.APIKeys = []string{"adminkey"}
+	config.Filters = []string{"redis", "fake"}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an admin API without a store to write to but didn't.")
+	}
+
+	config.Filters = []string{"redis", "mysql"}
+	if err := ValidateConfig(config); err != nil {
+		t.Errorf("Config validation failed for an admin API writing to MySQL: %s", err)
+	}
+}
+
+func TestValidateConfigUnknownDefaultPolicy(t *testing.T) {
+	config := NewConfig()
+	config.DefaultPolicy = "merp"
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown default policy but didn't.")
+	}
+}
+
+func TestValidateConfigDuplicateAPIKey(t *testing.T) {
+	config := NewConfig()
+	config.Policies["guest"] = Policy{APIKeys: []string{"key"}}
+	config.Policies["staff"] = Policy{APIKeys: []string{"key"}}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a shared API key but didn't.")
+	}
+}
+
+func TestValidateConfigExtAuthzWithoutGRPC(t *testing.T) {
+	config := NewConfig()
+	config.ExtAuthz.Enabled = true
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for ext_authz without a gRPC port but didn't.")
+	}
+}
+
+func TestValidateConfigExtAuthzDeniedStatus(t *testing.T) {
+	config := NewConfig()
+	config.ExtAuthz.DeniedStatus = 0
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an invalid denied status but didn't.")
+	}
+}
+
+func TestValidateConfigDNS(t *testing.T) {
+	config := NewConfig()
+	config.DNS.Port = "5353"
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a DNS resolver without an upstream but didn't.")
+	}
+
+	config.DNS.Upstream = "8.8.8.8:53"
+	config.DNS.SinkholeIPv4 = "fd00::1"
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an IPv6 address as the IPv4 sinkhole but didn't.")
+	}
+
+	config.DNS.SinkholeIPv4 = "10.0.0.1"
+	config.DNS.SinkholeIPv6 = "10.0.0.1"
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an IPv4 address as the IPv6 sinkhole but didn't.")
+	}
+
+	config.DNS.SinkholeIPv6 = ""
+	config.DNS.TTL = -1
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a negative DNS TTL but didn't.")
+	}
+
+	config.DNS.TTL = 60
+	config.DNS.Policy = "merp"
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown DNS policy but didn't.")
+	}
+}
+
+func TestValidateConfigUnknownProxyPolicy(t *testing.T) {
+	config := NewConfig()
+	config.Proxy.Policy = "merp"
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown proxy policy but didn't.")
+	}
+}
+
+func TestValidateConfigProxyConnectPorts(t *testing.T) {
+	config := NewConfig()
+	config.Proxy.ConnectPorts = []int{443, 0}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a proxy tunnel port of 0 but didn't.")
+	}
+}
+
+func TestValidateConfigRelativeRedirect(t *testing.T) {
+	config := NewConfig()
+	config.BlockPage.RedirectURL = "/blocked"
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a relative block page redirect but didn't.")
+	}
+}
+
+func TestValidateConfigMatch(t *testing.T) {
+	config := NewConfig()
+	config.Match.MaxQueryParams = 0
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a maxQueryParams of 0 but didn't.")
+	}
+
+	config.Match.MaxQueryParams = MAX_MATCH_QUERY_PARAMS + 1
+
+	if ValidateConfig(config) == nil {
+		t.Errorf("Config validation was supposed to fail for a maxQueryParams of %d but didn't.", config.Match.MaxQueryParams)
+	}
+}
+
+func TestValidateConfigBatch(t *testing.T) {
+	config := NewConfig()
+	config.Batch.MaxURLs = 0
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a batch URL limit of 0 but didn't.")
+	}
+
+	config.Batch.MaxURLs = 100
+	config.Batch.Workers = -1
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for -1 batch workers but didn't.")
+	}
+}
+
+func TestValidateConfigWebhook(t *testing.T) {
+	config := NewConfig()
+	config.Webhook.URLs = []string{"soc.example.com/hook"}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a webhook without a scheme but didn't.")
+	}
+
+	config.Webhook.URLs = []string{"https://soc.example.com/hook"}
+	config.Webhook.BatchSize = 0
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a webhook batch size of 0 but didn't.")
+	}
+}
+
+func TestValidateConfigAudit(t *testing.T) {
+	config := NewConfig()
+	config.Audit.Sinks = []string{"kafka"}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown audit log sink but didn't.")
+	}
+
+	config.Audit.Sinks = []string{"stdout"}
+	config.Audit.AllowedSampleRate = 1.5
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an audit log sample rate above 1 but didn't.")
+	}
+}
+
+func TestValidateConfigTimeouts(t *testing.T) {
+	config := NewConfig()
+	config.Timeouts.Lookup = -1
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a negative lookup deadline but didn't.")
+	}
+
+	config.Timeouts.Lookup = 0
+	config.Timeouts.Filters = map[string]int{"postgres": 100}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a timeout on an unknown filter but didn't.")
+	}
+
+	config.Timeouts.Filters = map[string]int{}
+	config.Timeouts.Shutdown = -1
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a negative shutdown timeout but didn't.")
+	}
+}
+
+func TestValidateConfigFailureMode(t *testing.T) {
+	config := NewConfig()
+	config.Failure.Mode = "ajar"
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown failure mode but didn't.")
+	}
+
+	config.Failure.Mode = "open"
+	config.Failure.Filters = map[string]string{"mysql": "ajar"}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for an unknown filter failure mode but didn't.")
+	}
+
+	config.Failure.Filters = map[string]string{"MySQL": "closed"}
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a failure mode keyed by an unknown filter but didn't.")
+	}
+
+	config.Failure.Filters = map[string]string{}
+	config.Failure.RetryAfter = -1
+
+	if ValidateConfig(config) == nil {
+		t.Error("Config validation was supposed to fail for a negative Retry-After but didn't.")
+	}
+}
+
 func TestParseConfigFileReturnsDefaultConfigEmptyPath(t *testing.T) {
 	config := NewConfig()
 	parsedConfig, _ := ParseConfigFile("")
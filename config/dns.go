@@ -0,0 +1,36 @@
+package config
+
+// Config for the blocking DNS resolver.
+type DNS struct {
+	// Port to bind the DNS server to over UDP and TCP, on the same host as
+	// the REST API. The DNS server is disabled if empty - default "".
+	Port string `json:"port"`
+
+	// Resolver queries for unflagged domains are forwarded to, as host:port - default "".
+	Upstream string `json:"upstream"`
+
+	// Address returned for A queries for flagged domains. If neither
+	// sinkhole address is set flagged domains get NXDOMAIN - default "".
+	SinkholeIPv4 string `json:"sinkholeIPv4"`
+
+	// Address returned for AAAA queries for flagged domains - default "".
+	SinkholeIPv6 string `json:"sinkholeIPv6"`
+
+	// TTL in seconds of sinkhole answers, up to 2147483647 - default 60.
+	TTL int `json:"ttl"`
+
+	// Policy domains are checked under, if empty the default policy - default "".
+	Policy string `json:"policy"`
+}
+
+// Return DNS config with default values.
+func NewDNS() DNS {
+	return DNS{
+		Port:         "",
+		Upstream:     "",
+		SinkholeIPv4: "",
+		SinkholeIPv6: "",
+		TTL:          60,
+		Policy:       "",
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+// Config for the Envoy external authorization service.
+type ExtAuthz struct {
+	// Serve the Envoy ext_authz Check API on the gRPC port - default false.
+	Enabled bool `json:"enabled"`
+
+	// HTTP status Envoy returns to the client for a blocked URL - default 403.
+	DeniedStatus int `json:"deniedStatus"`
+
+	// Body Envoy returns to the client for a blocked URL - default "Blocked by urlfilter.".
+	DeniedBody string `json:"deniedBody"`
+}
+
+// Return ExtAuthz config with default values.
+func NewExtAuthz() ExtAuthz {
+	return ExtAuthz{
+		Enabled:      false,
+		DeniedStatus: 403,
+		DeniedBody:   "Blocked by urlfilter.",
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+// Config for answering lookups that failed without finding the URL.
+type Failure struct {
+	// How failed lookups are answered, one of "open" (200, the URL is
+	// allowed), "closed" (403, the URL is blocked), "unavailable" (503
+	// with Retry-After) or "" (500, the error is reported) - default "".
+	Mode string `json:"mode"`
+
+	// Seconds in the Retry-After header of unavailable responses - default 5.
+	RetryAfter int `json:"retryAfter"`
+
+	// Mode used when a particular filter failed, by the filter's name in
+	// the "filters" list, ie: "mysql". Filters that aren't listed use the
+	// mode above - default {}.
+	Filters map[string]string `json:"filters"`
+}
+
+// Return Failure config with default values.
+func NewFailure() Failure {
+	return Failure{
+		Mode:       "",
+		RetryAfter: 5,
+		Filters:    map[string]string{},
+	}
+}
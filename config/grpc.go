@@ -0,0 +1,15 @@
+package config
+
+// Config for the gRPC lookup service.
+type GRPC struct {
+	// Port to bind the gRPC server to, on the same host as the REST API.
+	// The gRPC server is disabled if empty - default "".
+	Port string `json:"port"`
+}
+
+// Return GRPC config with default values.
+func NewGRPC() GRPC {
+	return GRPC{
+		Port: "",
+	}
+}
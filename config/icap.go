@@ -0,0 +1,15 @@
+package config
+
+// Config for the ICAP REQMOD service used by proxies.
+type ICAP struct {
+	// Port to bind the ICAP server to, on the same host as the REST API,
+	// conventionally 1344. The ICAP server is disabled if empty - default "".
+	Port string `json:"port"`
+}
+
+// Return ICAP config with default values.
+func NewICAP() ICAP {
+	return ICAP{
+		Port: "",
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+// The most query parameters maxQueryParams can be set to.
+const MAX_MATCH_QUERY_PARAMS = 10
+
+// Config for the match filter, which checks a URL against the stored
+// entries it could match rather than only against itself.
+type Match struct {
+	// Match stored entries whose query parameters are a subset of the
+	// requested URL's, ie: the request carries extra parameters - default false.
+	QuerySubsets bool `json:"querySubsets"`
+
+	// Requests with more query parameters than this are only matched
+	// exactly, since the number of subsets doubles with each one. Between
+	// 1 and MAX_MATCH_QUERY_PARAMS - default 8.
+	MaxQueryParams int `json:"maxQueryParams"`
+
+	// Match stored entries for any host suffix or path prefix of the requested
+	// URL, ie: evil.com/ blocks everything on evil.com and its subdomains - default false.
+	Hierarchical bool `json:"hierarchical"`
+}
+
+// Return Match config with default values.
+func NewMatch() Match {
+	return Match{
+		QuerySubsets:   false,
+		MaxQueryParams: 8,
+		Hierarchical:   false,
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+// A blocking policy, listing which categories of flagged URL are blocked
+// for the clients using it. Flagged URLs without a category are always blocked.
+type Policy struct {
+	// Categories of flagged URL that are blocked, ie: malware, phishing - default [].
+	Categories []string `json:"categories"`
+
+	// API keys that select this policy with the X-API-Key header - default [].
+	APIKeys []string `json:"apiKeys"`
+}
+
+// Return Policy config with default values.
+func NewPolicy() Policy {
+	return Policy{
+		Categories: []string{},
+		APIKeys:    []string{},
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+// Config for the forward HTTP proxy.
+type Proxy struct {
+	// Port to bind the proxy to, on Host. The proxy is disabled if
+	// empty - default "".
+	Port string `json:"port"`
+
+	// Address to bind the proxy to. Loopback, so only local clients can use
+	// the proxy, unless set otherwise - default "127.0.0.1".
+	Host string `json:"host"`
+
+	// Policy URLs are checked under, if empty the default policy - default "".
+	Policy string `json:"policy"`
+
+	// Ports CONNECT tunnels can be opened to - default [443].
+	ConnectPorts []int `json:"connectPorts"`
+}
+
+// Return Proxy config with default values.
+func NewProxy() Proxy {
+	return Proxy{
+		Port:         "",
+		Host:         "127.0.0.1",
+		Policy:       "",
+		ConnectPorts: []int{443},
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+// Config for lookup deadlines, and for how long a shutdown waits.
+type Timeouts struct {
+	// Deadline, in milliseconds, for a lookup through the whole filter
+	// chain, 0 for none - default 0.
+	Lookup int `json:"lookup"`
+
+	// Timeout, in milliseconds, of each call a filter makes to its own
+	// database, by the filter's name in the "filters" list, ie: "mysql".
+	// Filters that aren't listed are only limited by the lookup deadline - default {}.
+	Filters map[string]int `json:"filters"`
+
+	// Time, in milliseconds, the servers are given to finish the requests
+	// they're handling when urlfilter is stopped - default 10000.
+	Shutdown int `json:"shutdown"`
+}
+
+// Return Timeouts config with default values.
+func NewTimeouts() Timeouts {
+	return Timeouts{
+		Lookup:   0,
+		Filters:  map[string]int{},
+		Shutdown: 10000,
+	}
+}
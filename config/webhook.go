@@ -0,0 +1,38 @@
+package config
+
+// Config for the webhooks notified of blocked lookups.
+type Webhook struct {
+	// URLs blocked lookup events are posted to, disabled if empty - default [].
+	URLs []string `json:"urls"`
+
+	// Maximum number of events posted at a time - default 100.
+	BatchSize int `json:"batchSize"`
+
+	// The interval, in milliseconds, a partial batch waits before it's posted - default 1000.
+	FlushInterval int `json:"flushInterval"`
+
+	// Number of events waiting to be posted before new ones are dropped - default 10000.
+	QueueSize int `json:"queueSize"`
+
+	// Number of times a failed post is retried - default 3.
+	MaxRetries int `json:"maxRetries"`
+
+	// The delay, in milliseconds, before the first retry, doubled for each one after - default 500.
+	RetryBackoff int `json:"retryBackoff"`
+
+	// The timeout, in seconds, of each post - default 5.
+	Timeout int `json:"timeout"`
+}
+
+// Return Webhook config with default values.
+func NewWebhook() Webhook {
+	return Webhook{
+		URLs:          []string{},
+		BatchSize:     100,
+		FlushInterval: 1000,
+		QueueSize:     10000,
+		MaxRetries:    3,
+		RetryBackoff:  500,
+		Timeout:       5,
+	}
+}
@@ -1,14 +1,48 @@
 // DB Connectors to back DB based filters.
 package connectors
 
+import (
+	"context"
+	"errors"
+)
+
+// Returned by RemoveURL when the connector can't remove individual URLs,
+// ie: a Bloom Filter. Callers have to rebuild the store instead.
+var ErrRemoveUnsupported = errors.New("Removing URLs is not supported.")
+
 // Interface to underlying database connection pool and comand runner.
+// Commands give up and return the context's error once it's done.
 type Connector interface {
 	// Check if the URL is in the database.
-	ContainsURL(url string) (bool, error)
+	ContainsURL(ctx context.Context, url string) (bool, error)
+
+	// Check if each of the URLs is in the database, using a single round trip.
+	// The results are in the same order as the URLs.
+	ContainsURLs(ctx context.Context, urls []string) ([]bool, error)
+
+	// Check if each of the URLs is in the database using a single round trip,
+	// and return the category each was stored with. Connectors that don't
+	// store categories return empty categories.
+	FindURLs(ctx context.Context, urls []string) ([]bool, []string, error)
 
-	// Add the URL to the database. Only used if this DB is being used as a cache.
-	AddURL(url string) error
+	// Add the URL to the database with its category, which may be empty.
+	// Only used if this DB is being used as a cache.
+	AddURL(ctx context.Context, url string, category string) error
+
+	// Remove the URL from the database. Returns ErrRemoveUnsupported if the
+	// database can't remove individual URLs.
+	RemoveURL(ctx context.Context, url string) error
+
+	// Check that the database is reachable, giving up when the context is done.
+	Ping(ctx context.Context) error
+
+	// Close the connection pool. The connector can't be used afterwards.
+	Close() error
 
 	// Return the name of this connector. Used for logging.
 	Name() string
+
+	// Describe where this connector's URLs are stored, ie: host and table.
+	// Used for logging and reporting.
+	Source() string
 }
@@ -0,0 +1,119 @@
+package connectors
+
+import (
+	"bufio"
+	"context"
+	"github.com/tmortimer/urlfilter/canonical"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Holds URLs loaded from a file, one per line. Blank lines and lines
+// starting with # are skipped. Only suitable for small lists, since
+// the whole file is held in memory.
+type File struct {
+	// The URLs loaded from the file.
+	urls map[string]bool
+
+	// Guards urls, which can be added to while being read.
+	lock sync.RWMutex
+
+	// The path the URLs were loaded from.
+	path string
+}
+
+// Create a new File connector and load the URLs in the file at path.
+func NewFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	connector := &File{
+		urls: make(map[string]bool),
+		path: path,
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		connector.urls[canonical.SortQuery(line)] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return connector, nil
+}
+
+// Check if the URL was in the file. The file is held in memory, so the
+// context is never waited on.
+func (f *File) ContainsURL(ctx context.Context, url string) (bool, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.urls[canonical.SortQuery(url)], nil
+}
+
+// Check if each of the URLs was in the file.
+func (f *File) ContainsURLs(ctx context.Context, urls []string) ([]bool, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	found := make([]bool, len(urls))
+	for i, url := range urls {
+		found[i] = f.urls[canonical.SortQuery(url)]
+	}
+	return found, nil
+}
+
+// Check if each of the URLs was in the file. Files don't record categories.
+func (f *File) FindURLs(ctx context.Context, urls []string) ([]bool, []string, error) {
+	found, err := f.ContainsURLs(ctx, urls)
+	return found, make([]string, len(urls)), err
+}
+
+// Add the URL. It's only held in memory, the file is not written to, and
+// the category is ignored.
+func (f *File) AddURL(ctx context.Context, url string, category string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.urls[canonical.SortQuery(url)] = true
+	return nil
+}
+
+// Remove the URL. Like AddURL the file itself is not written to.
+func (f *File) RemoveURL(ctx context.Context, url string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.urls, canonical.SortQuery(url))
+	return nil
+}
+
+// The file is held in memory, so it's always reachable.
+func (f *File) Ping(ctx context.Context) error {
+	return nil
+}
+
+// The file is held in memory, so there's nothing to close.
+func (f *File) Close() error {
+	return nil
+}
+
+// Return the name File for logging.
+func (f *File) Name() string {
+	return "File"
+}
+
+// Return the path the URLs were loaded from.
+func (f *File) Source() string {
+	return f.path
+}
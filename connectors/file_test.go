@@ -0,0 +1,53 @@
+package connectors
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileLoadsURLs(t *testing.T) {
+	file, err := ioutil.TempFile("", "urlfilter")
+	if err != nil {
+		t.Fatalf("Unable to create a temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("# Partners\n\n  *.partner.com  \nexample.com/a?b=2&a=1\n")
+	file.Close()
+
+	conn, err := NewFile(file.Name())
+	if err != nil {
+		t.Fatalf("Creating a File connector generated an error: %s", err)
+	}
+
+	found, err := conn.ContainsURLs(context.Background(), []string{"*.partner.com", "example.com/a?a=1&b=2", "# Partners", "", "evil.com"})
+	if err != nil {
+		t.Errorf("An error was generated when none was expected: %s.", err)
+	}
+
+	expected := []bool{true, true, false, false, false}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("Lookup %d found was %t when %t was expected.", i, found[i], expected[i])
+		}
+	}
+
+	conn.AddURL(context.Background(), "evil.com", "malware")
+	if found, _ := conn.ContainsURL(context.Background(), "evil.com"); !found {
+		t.Error("URL evil.com was not found after it was added.")
+	}
+
+	conn.RemoveURL(context.Background(), "example.com/a?b=2&a=1")
+	if found, _ := conn.ContainsURL(context.Background(), "example.com/a?a=1&b=2"); found {
+		t.Error("URL example.com/a?a=1&b=2 was found after it was removed.")
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	_, err := NewFile("/does/not/exist")
+	if err == nil {
+		t.Error("Creating a File connector for a missing file did not generate an error when one was expected.")
+	}
+}
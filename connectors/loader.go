@@ -2,10 +2,14 @@ package connectors
 
 // Interface to underlying database connection pool from which a bloom filter is loaded.
 type Loader interface {
-	// Check if the URL is in the database. Returns the set of URLs and
-	// the highest ID loaded from the DB.
-	GetURLPage(start int, number int) ([]string, int, error)
+	// Get up to number URLs with IDs after the given one, in ID order.
+	// Returns the URLs and the highest ID loaded from the DB, which is
+	// after itself if there were none.
+	GetURLPage(after int, number int) ([]string, int, error)
 
 	// Get the current max ID in the DB.
 	GetMaxID() (int, error)
+
+	// Close the connection pool. The loader can't be used afterwards.
+	Close() error
 }
@@ -1,10 +1,15 @@
 package connectors
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tmortimer/urlfilter/canonical"
 	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/metrics"
 	"hash/crc32"
+	"strings"
 )
 
 const CREATE_DB string = "CREATE DATABASE IF NOT EXISTS URLFilter"
@@ -19,22 +24,64 @@ const USE_DB string = "USE URLFilter"
 //
 // With a greater understanding of the sample size, and ideally with some sample
 // data one could evaluate if it's worth using CRC64, or even something else.
+//
+// URLs are stored and compared with their query parameters sorted, so that the
+// order the parameters were written in doesn't matter.
+//
+// The url column is too long for a unique index, so each URL is stored once
+// by a unique SHA-256 of it, generated by MySQL. Adding a URL that's already
+// stored keeps the existing row.
+
+// The table holding flagged URLs.
+const URL_TABLE = "crcurls"
 
-const CREATE_URL_TABLE = "CREATE TABLE IF NOT EXISTS crcurls (" +
+// The table holding allowlisted URLs, used by the allowlist filter.
+const ALLOWLIST_TABLE = "allowurls"
+
+// The queries below are formatted with the name of the table.
+
+const CREATE_URL_TABLE = "CREATE TABLE IF NOT EXISTS %s (" +
 	"id int unsigned NOT NULL auto_increment," +
 	"url varchar(2050) NOT NULL," +
 	"url_crc int unsigned NOT NULL DEFAULT 0," +
+	"category varchar(64) NOT NULL DEFAULT ''," +
+	"url_hash binary(32) AS (UNHEX(SHA2(url, 256))) STORED," +
 	"PRIMARY KEY(id)," +
-	"INDEX(url_crc)" +
+	"INDEX(url_crc)," +
+	"UNIQUE KEY(url_hash)" +
 	")"
 
-const SELECT_URL = "SELECT EXISTS(SELECT 1 FROM crcurls WHERE url_crc=? AND url=?)"
+const SELECT_URL = "SELECT EXISTS(SELECT 1 FROM %s WHERE url_crc=? AND url=?)"
+
+const SELECT_URLS = "SELECT url, category FROM %s WHERE url_crc IN (%s)"
+
+// The most URLs checked by one SELECT_URLS, keeping well under the
+// 65,535 placeholders MySQL allows in a statement.
+const MAX_URLS_PER_SELECT = 10000
+
+const ADD_URL = "INSERT INTO %s (url_crc, url, category) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE id=id"
+
+const REMOVE_URL = "DELETE FROM %s WHERE url_crc=? AND url=?"
+
+// Tables created before categories or the unique URL hash were added need
+// the columns added.
+const SELECT_COLUMN = "SELECT COUNT(*) FROM information_schema.COLUMNS " +
+	"WHERE TABLE_SCHEMA='URLFilter' AND TABLE_NAME=? AND COLUMN_NAME=?"
+
+const ADD_CATEGORY_COLUMN = "ALTER TABLE %s ADD COLUMN category varchar(64) NOT NULL DEFAULT ''"
 
-const ADD_URL = "INSERT INTO crcurls (url_crc, url) VALUES (?, ?)"
+// Older tables may hold duplicate rows, which have to go before the unique
+// key can be added. The first row for each URL is kept.
+const REMOVE_DUPLICATE_URLS = "DELETE a FROM %[1]s a JOIN %[1]s b " +
+	"ON a.url_crc=b.url_crc AND a.url=b.url AND a.id > b.id"
 
-const SELECT_RANGE = "SELECT id, url FROM crcurls WHERE id BETWEEN ? AND ?"
+const ADD_URL_HASH_COLUMN = "ALTER TABLE %s " +
+	"ADD COLUMN url_hash binary(32) AS (UNHEX(SHA2(url, 256))) STORED, " +
+	"ADD UNIQUE KEY(url_hash)"
 
-const SELECT_MAX_ID = "SELECT IFNULL(MAX(id), 0) FROM crcurls"
+const SELECT_PAGE = "SELECT id, url FROM %s WHERE id > ? ORDER BY id LIMIT ?"
+
+const SELECT_MAX_ID = "SELECT IFNULL(MAX(id), 0) FROM %s"
 
 // Holds the MySQL connection pool and executes commands against MySQL.
 type MySQL struct {
@@ -43,18 +90,28 @@ type MySQL struct {
 
 	// MySQL specific config.
 	config config.MySQL
+
+	// The table URLs are stored in.
+	table string
 }
 
 // Create a new MySQL connector and setup the MySQL connection pool.
 func NewMySQL(config config.MySQL) (*MySQL, error) {
+	return NewMySQLTable(config, URL_TABLE)
+}
+
+// Create a new MySQL connector for URLs stored in the given table.
+func NewMySQLTable(config config.MySQL, table string) (*MySQL, error) {
 	connector := &MySQL{
 		config: config,
+		table:  table,
 	}
 
 	err := connector.ConfigureMySQL()
 	if err != nil {
 		return nil, err
 	}
+	metrics.Pools.Add(connector)
 	return connector, nil
 }
 
@@ -79,7 +136,7 @@ func (r *MySQL) ConfigureMySQL() error {
 		return err
 	}
 
-	_, err = db.Exec(CREATE_URL_TABLE)
+	_, err = db.Exec(r.query(CREATE_URL_TABLE))
 	if err != nil {
 		return err
 	}
@@ -88,15 +145,65 @@ func (r *MySQL) ConfigureMySQL() error {
 	// in the existing pool, so we actually want to open a new one
 	// and close the old one.
 	r.db, err = sql.Open("mysql", dsn+"URLFilter")
+	if err != nil {
+		return err
+	}
+
+	if err := r.AddCategoryColumn(); err != nil {
+		return err
+	}
 
+	return r.AddURLHashColumn()
+}
+
+// Return true if the table has the column.
+func (r *MySQL) hasColumn(column string) (bool, error) {
+	columns := 0
+	row := r.db.QueryRow(SELECT_COLUMN, r.table, column)
+	if err := row.Scan(&columns); err != nil {
+		return false, err
+	}
+	return columns > 0, nil
+}
+
+// Add the category column to tables created before categories were added.
+func (r *MySQL) AddCategoryColumn() error {
+	found, err := r.hasColumn("category")
+	if err != nil || found {
+		return err
+	}
+
+	_, err = r.db.Exec(r.query(ADD_CATEGORY_COLUMN))
+	return err
+}
+
+// Add the unique URL hash to tables created before it was added, removing
+// any duplicate rows first.
+func (r *MySQL) AddURLHashColumn() error {
+	found, err := r.hasColumn("url_hash")
+	if err != nil || found {
+		return err
+	}
+
+	if _, err := r.db.Exec(r.query(REMOVE_DUPLICATE_URLS)); err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(r.query(ADD_URL_HASH_COLUMN))
 	return err
 }
 
-// Check if the URL is in MySQL.
-func (r *MySQL) ContainsURL(url string) (bool, error) {
+// Format the query with the name of this connector's table.
+func (r *MySQL) query(query string) string {
+	return fmt.Sprintf(query, r.table)
+}
+
+// Check if the URL is in MySQL. The query is cancelled when the context is done.
+func (r *MySQL) ContainsURL(ctx context.Context, url string) (bool, error) {
 	exists := false
+	url = canonical.SortQuery(url)
 
-	row := r.db.QueryRow(SELECT_URL, crc32.ChecksumIEEE([]byte(url)), url)
+	row := r.db.QueryRowContext(ctx, r.query(SELECT_URL), crc32.ChecksumIEEE([]byte(url)), url)
 	if err := row.Scan(&exists); err != nil {
 		return false, err
 	}
@@ -104,41 +211,139 @@ func (r *MySQL) ContainsURL(url string) (bool, error) {
 	return exists, nil
 }
 
-// Add the URL to the MySQL. Only used if this DB is being used as a cache.
-func (r *MySQL) AddURL(url string) error {
-	_, err := r.db.Exec(ADD_URL, crc32.ChecksumIEEE([]byte(url)), url)
+// Check if each of the URLs is in MySQL with a single query.
+func (r *MySQL) ContainsURLs(ctx context.Context, urls []string) ([]bool, error) {
+	found, _, err := r.FindURLs(ctx, urls)
+	return found, err
+}
+
+// Check if each of the URLs is in MySQL, and return their categories. The
+// URLs are checked with one query per MAX_URLS_PER_SELECT of them.
+func (r *MySQL) FindURLs(ctx context.Context, urls []string) ([]bool, []string, error) {
+	found := make([]bool, len(urls))
+	categories := make([]string, len(urls))
+
+	sorted := make([]string, len(urls))
+	for i, url := range urls {
+		sorted[i] = canonical.SortQuery(url)
+	}
+
+	existing := make(map[string]string)
+	for start := 0; start < len(sorted); start += MAX_URLS_PER_SELECT {
+		end := start + MAX_URLS_PER_SELECT
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+
+		if err := r.selectURLs(ctx, sorted[start:end], existing); err != nil {
+			return found, categories, err
+		}
+	}
+
+	for i, url := range sorted {
+		categories[i], found[i] = existing[url]
+	}
+
+	return found, categories, nil
+}
+
+// Add every row matching the CRC of one of the URLs to existing, mapping
+// its URL to its category. The rows are compared against the URLs later.
+func (r *MySQL) selectURLs(ctx context.Context, urls []string, existing map[string]string) error {
+	args := make([]interface{}, len(urls))
+	for i, url := range urls {
+		args[i] = crc32.ChecksumIEEE([]byte(url))
+	}
+	placeholders := strings.Repeat("?,", len(urls))
+	query := fmt.Sprintf(SELECT_URLS, r.table, placeholders[:len(placeholders)-1])
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	url := ""
+	category := ""
+	for rows.Next() {
+		if err := rows.Scan(&url, &category); err != nil {
+			return err
+		}
+		existing[url] = category
+	}
+
+	return rows.Err()
+}
+
+// Add the URL to the MySQL with its category. A URL that's already stored
+// keeps its category.
+func (r *MySQL) AddURL(ctx context.Context, url string, category string) error {
+	url = canonical.SortQuery(url)
+	_, err := r.db.ExecContext(ctx, r.query(ADD_URL), crc32.ChecksumIEEE([]byte(url)), url, category)
+	return err
+}
+
+// Remove every row holding the URL from MySQL.
+func (r *MySQL) RemoveURL(ctx context.Context, url string) error {
+	url = canonical.SortQuery(url)
+	_, err := r.db.ExecContext(ctx, r.query(REMOVE_URL), crc32.ChecksumIEEE([]byte(url)), url)
 	return err
 }
 
+// Check that MySQL is reachable.
+func (r *MySQL) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close the MySQL connection pool.
+func (r *MySQL) Close() error {
+	return r.db.Close()
+}
+
+// Return the statistics of the MySQL connection pool.
+func (r *MySQL) PoolStats() metrics.PoolStats {
+	stats := r.db.Stats()
+	return metrics.PoolStats{
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+}
+
 // Return the name MySQL for logging.
 func (r *MySQL) Name() string {
 	return "MySQL"
 }
 
-func (r *MySQL) GetURLPage(start int, number int) ([]string, int, error) {
+// Return the host, database and table URLs are stored in.
+func (r *MySQL) Source() string {
+	return r.config.Host + ":" + r.config.Port + "/URLFilter." + r.table
+}
 
-	rows, err := r.db.Query(SELECT_RANGE, start, start+number-1)
+func (r *MySQL) GetURLPage(after int, number int) ([]string, int, error) {
+
+	rows, err := r.db.Query(r.query(SELECT_PAGE), after, number)
 	if err != nil {
-		return nil, start, err
+		return nil, after, err
 	}
 	defer rows.Close()
 
 	urls := make([]string, 0, number)
 	url := ""
-	maxID := 0
-	i := 0
+	maxID := after
 	for rows.Next() {
 		err := rows.Scan(&maxID, &url)
 		if err != nil {
-			return nil, start, err
+			return nil, after, err
 		}
 		urls = append(urls, url)
-		i++
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, start, err
+		return nil, after, err
 	}
 
 	return urls, maxID, nil
@@ -147,7 +352,7 @@ func (r *MySQL) GetURLPage(start int, number int) ([]string, int, error) {
 func (r *MySQL) GetMaxID() (int, error) {
 	maxID := 0
 
-	row := r.db.QueryRow(SELECT_MAX_ID)
+	row := r.db.QueryRow(r.query(SELECT_MAX_ID))
 	if err := row.Scan(&maxID); err != nil {
 		return 0, err
 	}
@@ -1,17 +1,32 @@
 package connectors
 
 import (
-	"fmt"
+	"context"
 	"github.com/gomodule/redigo/redis"
+	"github.com/tmortimer/urlfilter/canonical"
 	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
 	"strings"
 	"time"
 )
 
 const BF_NAME string = "URLFilter"
 
-type ContainsFunc func(url string) (bool, error)
-type AddFunc func(url string) error
+// How long to wait to connect to Redis.
+const REDIS_CONNECT_TIMEOUT = 5 * time.Second
+
+// Default key of the Redis set used by the allowlist filter.
+const ALLOWLIST_SET string = "URLFilterAllowlist"
+
+type ContainsFunc func(ctx context.Context, url string) (bool, error)
+type ContainsManyFunc func(ctx context.Context, urls []string) ([]bool, error)
+type FindManyFunc func(ctx context.Context, urls []string) ([]bool, []string, error)
+type AddFunc func(ctx context.Context, url string, category string) error
+type RemoveFunc func(ctx context.Context, url string) error
+
+// The value stored for uncategorized URLs before categories were added.
+const LEGACY_VALUE string = "\"\""
 
 // Holds the actual Redis connection pool and executes commands against Redis.
 type Redis struct {
@@ -24,8 +39,21 @@ type Redis struct {
 	// Function to check for existance of a URL.
 	contains ContainsFunc
 
+	// Function to check for existance of many URLs at once.
+	containsMany ContainsManyFunc
+
+	// Function to check for existance of many URLs at once, and return
+	// their categories. Nil if this connector doesn't store categories.
+	findMany FindManyFunc
+
 	// Function to add a URL.
 	add AddFunc
+
+	// Function to remove a URL.
+	remove RemoveFunc
+
+	// The key URLs are stored in, empty if each URL is its own key.
+	key string
 }
 
 // Create a new Redis connector and setup the Redis connection pool.
@@ -36,10 +64,13 @@ func NewRedisBase(config config.Redis) *Redis {
 	connector.pool = &redis.Pool{
 		MaxIdle:     config.MaxIdle,
 		IdleTimeout: time.Duration(config.IdleTimeout) * time.Second,
-		Dial:        func() (redis.Conn, error) { return redis.Dial("tcp", config.Host+":"+config.Port) },
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialContext(ctx, "tcp", config.Host+":"+config.Port, redis.DialConnectTimeout(REDIS_CONNECT_TIMEOUT))
+		},
 	}
 
 	connector.ConfigureRedis()
+	metrics.Pools.Add(connector)
 
 	return connector
 }
@@ -58,29 +89,123 @@ func NewRedisBloom(config config.Redis) *Redis {
 	return connector
 }
 
-// Setup the functions used to check if URLs exist, and add them.
+// Setup the functions used to check if URLs exist, add and remove them.
 // These change if this Redis connector is being used as for a
 // Bloom Filter.
 func (r *Redis) SetAccessors(bloom bool) {
 	if bloom {
-		r.contains = func(url string) (bool, error) {
-			return redis.Bool(r.Do("BF.EXISTS", BF_NAME, url))
+		r.key = BF_NAME
+		r.contains = func(ctx context.Context, url string) (bool, error) {
+			return redis.Bool(r.DoContext(ctx, "BF.EXISTS", BF_NAME, url))
 		}
-		r.add = func(url string) error {
-			_, err := r.Do("BF.ADD", BF_NAME, url)
+		r.containsMany = func(ctx context.Context, urls []string) ([]bool, error) {
+			exists, err := redis.Ints(r.DoContext(ctx, "BF.MEXISTS", redis.Args{}.Add(BF_NAME).AddFlat(urls)...))
+			if err != nil {
+				return nil, err
+			}
+			found := make([]bool, len(exists))
+			for i, exist := range exists {
+				found[i] = exist == 1
+			}
+			return found, nil
+		}
+		r.add = func(ctx context.Context, url string, category string) error {
+			_, err := r.DoContext(ctx, "BF.ADD", BF_NAME, url)
 			return err
 		}
+		r.remove = func(ctx context.Context, url string) error {
+			// Bloom Filters can't forget a URL, the filter has to be rebuilt.
+			return ErrRemoveUnsupported
+		}
 	} else {
-		r.contains = func(url string) (bool, error) {
-			return redis.Bool(r.Do("EXISTS", url))
+		r.contains = func(ctx context.Context, url string) (bool, error) {
+			return redis.Bool(r.DoContext(ctx, "EXISTS", url))
 		}
-		r.add = func(url string) error {
-			_, err := r.Do("SET", url, "\"\"")
+		r.containsMany = func(ctx context.Context, urls []string) ([]bool, error) {
+			found, _, err := r.findMany(ctx, urls)
+			return found, err
+		}
+		r.findMany = func(ctx context.Context, urls []string) ([]bool, []string, error) {
+			// MGET returns nil for each key that doesn't exist, and
+			// the category stored as the value for those that do.
+			values, err := redis.Values(r.DoContext(ctx, "MGET", redis.Args{}.AddFlat(urls)...))
+			if err != nil {
+				return nil, nil, err
+			}
+			found := make([]bool, len(values))
+			categories := make([]string, len(values))
+			for i, value := range values {
+				found[i] = value != nil
+				if category, err := redis.String(value, nil); err == nil && category != LEGACY_VALUE {
+					categories[i] = category
+				}
+			}
+			return found, categories, nil
+		}
+		r.add = func(ctx context.Context, url string, category string) error {
+			// The category is the value, the key is all that's needed to find
+			// the URL. A URL that's already stored keeps its category.
+			_, err := r.DoContext(ctx, "SET", url, category, "NX")
+			return err
+		}
+		r.remove = func(ctx context.Context, url string) error {
+			_, err := r.DoContext(ctx, "DEL", url)
 			return err
 		}
 	}
 }
 
+// Create a new Redis connector for URLs stored in the Redis set at key.
+func NewRedisSet(config config.Redis, key string) *Redis {
+	connector := NewRedisBase(config)
+	connector.SetSetAccessors(key)
+	return connector
+}
+
+// Setup the functions used to check if URLs exist, add and remove them, for
+// URLs stored as members of the Redis set at key.
+func (r *Redis) SetSetAccessors(key string) {
+	r.key = key
+	r.contains = func(ctx context.Context, url string) (bool, error) {
+		return redis.Bool(r.DoContext(ctx, "SISMEMBER", key, url))
+	}
+	r.containsMany = func(ctx context.Context, urls []string) ([]bool, error) {
+		// Pipeline the checks so they cost a single round trip.
+		conn, err := r.pool.GetContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		for _, url := range urls {
+			if err := conn.Send("SISMEMBER", key, url); err != nil {
+				return nil, err
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+
+		found := make([]bool, len(urls))
+		for i := range urls {
+			exists, err := redis.Bool(redis.ReceiveContext(conn, ctx))
+			if err != nil {
+				return nil, err
+			}
+			found[i] = exists
+		}
+		return found, nil
+	}
+	r.add = func(ctx context.Context, url string, category string) error {
+		_, err := r.DoContext(ctx, "SADD", key, url)
+		return err
+	}
+	r.remove = func(ctx context.Context, url string) error {
+		_, err := r.DoContext(ctx, "SREM", key, url)
+		return err
+	}
+}
+
 // Configure Redis based on the supplied config file.
 func (r *Redis) ConfigureRedis() {
 	for _, command := range r.config.Config {
@@ -93,7 +218,7 @@ func (r *Redis) ConfigureRedis() {
 		}
 		_, err := r.Do(cmd, args...)
 		if err != nil {
-			fmt.Printf("Failed to set the following Redis config: %s - %s.\n", command, err)
+			log.Printf("Failed to set the following Redis config: %s - %s.", command, err)
 		}
 	}
 }
@@ -106,9 +231,22 @@ func (r *Redis) Do(cmd string, keysAndArgs ...interface{}) (interface{}, error)
 	return conn.Do(cmd, keysAndArgs...)
 }
 
-// Check if the URL is in Redis.
-func (r *Redis) ContainsURL(url string) (bool, error) {
-	found, err := r.contains(url)
+// Same as Do, but gives up once the context is done. The context's
+// deadline is used as the read deadline.
+func (r *Redis) DoContext(ctx context.Context, cmd string, keysAndArgs ...interface{}) (interface{}, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return redis.DoContext(conn, ctx, cmd, keysAndArgs...)
+}
+
+// Check if the URL is in Redis. URLs are stored and compared with their
+// query parameters sorted, so that the order they were written in doesn't matter.
+func (r *Redis) ContainsURL(ctx context.Context, url string) (bool, error) {
+	found, err := r.contains(ctx, canonical.SortQuery(url))
 	if err != nil {
 		// Not sure what the state of found will be after a failed
 		// call to the Redis library, so be sure it's false.
@@ -118,13 +256,91 @@ func (r *Redis) ContainsURL(url string) (bool, error) {
 	return found, err
 }
 
+// Check if each of the URLs is in Redis with a single command.
+func (r *Redis) ContainsURLs(ctx context.Context, urls []string) ([]bool, error) {
+	if len(urls) == 0 {
+		return []bool{}, nil
+	}
+
+	sorted := make([]string, len(urls))
+	for i, url := range urls {
+		sorted[i] = canonical.SortQuery(url)
+	}
+
+	found, err := r.containsMany(ctx, sorted)
+	if err != nil {
+		return make([]bool, len(urls)), err
+	}
+
+	return found, nil
+}
+
+// Check if each of the URLs is in Redis with a single command, and return
+// their categories. Only plain Redis caches store categories, the Bloom
+// Filter and set based connectors always return empty categories.
+func (r *Redis) FindURLs(ctx context.Context, urls []string) ([]bool, []string, error) {
+	if r.findMany == nil || len(urls) == 0 {
+		found, err := r.ContainsURLs(ctx, urls)
+		return found, make([]string, len(urls)), err
+	}
+
+	sorted := make([]string, len(urls))
+	for i, url := range urls {
+		sorted[i] = canonical.SortQuery(url)
+	}
+
+	found, categories, err := r.findMany(ctx, sorted)
+	if err != nil {
+		return make([]bool, len(urls)), make([]string, len(urls)), err
+	}
+
+	return found, categories, nil
+}
+
 // Add the URL to the Redis. Only used if this DB is being used as a cache.
-func (r *Redis) AddURL(url string) error {
-	// Use "" as the value since we only care about the key.
-	return r.add(url)
+func (r *Redis) AddURL(ctx context.Context, url string, category string) error {
+	return r.add(ctx, canonical.SortQuery(url), category)
+}
+
+// Remove the URL from Redis. The Bloom Filter connector returns
+// ErrRemoveUnsupported.
+func (r *Redis) RemoveURL(ctx context.Context, url string) error {
+	return r.remove(ctx, canonical.SortQuery(url))
+}
+
+// Check that Redis is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.DoContext(ctx, "PING")
+	return err
+}
+
+// Close the Redis connection pool.
+func (r *Redis) Close() error {
+	return r.pool.Close()
+}
+
+// Return the statistics of the Redis connection pool.
+func (r *Redis) PoolStats() metrics.PoolStats {
+	stats := r.pool.Stats()
+	return metrics.PoolStats{
+		Open:         stats.ActiveCount,
+		InUse:        stats.ActiveCount - stats.IdleCount,
+		Idle:         stats.IdleCount,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
 }
 
 // Return the name Redis for logging.
 func (r *Redis) Name() string {
 	return "Redis"
 }
+
+// Return the host, and key if there is one, URLs are stored in.
+func (r *Redis) Source() string {
+	source := r.config.Host + ":" + r.config.Port
+	if r.key != "" {
+		source += "/" + r.key
+	}
+	return source
+}
@@ -0,0 +1,15 @@
+package connectors
+
+import (
+	"context"
+	"github.com/tmortimer/urlfilter/config"
+	"testing"
+)
+
+func TestRedisBloomRemoveUnsupported(t *testing.T) {
+	conn := NewRedisBloom(config.NewRedis())
+
+	if err := conn.RemoveURL(context.Background(), "evil.com"); err != ErrRemoveUnsupported {
+		t.Errorf("Removing a URL from a Bloom Filter returned %v when ErrRemoveUnsupported was expected.", err)
+	}
+}
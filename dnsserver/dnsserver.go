@@ -0,0 +1,175 @@
+// Blocking DNS resolver, answers queries for flagged domains itself and
+// forwards the rest to an upstream resolver.
+package dnsserver
+
+import (
+	"context"
+	"github.com/miekg/dns"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Name of the resolver in the request metrics.
+const DNS_HANDLER = "dns"
+
+// Answers DNS queries, checking the queried name and each of its parent
+// domains against the filter chain.
+type Server struct {
+	// The chain of filters used by this resolver to see if a domain is flagged.
+	filter filters.Filter
+
+	// The policy every domain is checked under, nil blocks everything.
+	policy *handlers.Policy
+
+	// Resolver queries for unflagged domains are forwarded to.
+	upstream string
+
+	// Address returned for A queries for flagged domains, nil if unset.
+	sinkholeIPv4 net.IP
+
+	// Address returned for AAAA queries for flagged domains, nil if unset.
+	sinkholeIPv6 net.IP
+
+	// TTL in seconds of sinkhole answers.
+	ttl uint32
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+}
+
+// Create a Server instance with the underlying filters.Filter chain. If
+// policy is nil every flagged domain is blocked, and if auditor is nil
+// decisions aren't audited.
+func NewServer(filter filters.Filter, policy *handlers.Policy, cfg config.DNS, auditor *audit.Logger) *Server {
+	return &Server{
+		filter:       filter,
+		policy:       policy,
+		upstream:     cfg.Upstream,
+		sinkholeIPv4: net.ParseIP(cfg.SinkholeIPv4),
+		sinkholeIPv6: net.ParseIP(cfg.SinkholeIPv6),
+		ttl:          uint32(cfg.TTL),
+		auditor:      auditor,
+	}
+}
+
+// Create the UDP and TCP DNS servers for the resolver on addr.
+func NewDNSServers(addr string, s *Server) []*dns.Server {
+	return []*dns.Server{
+		{Addr: addr, Net: "udp", Handler: s},
+		{Addr: addr, Net: "tcp", Handler: s},
+	}
+}
+
+// Answer the query. Flagged domains get NXDOMAIN, or the sinkhole address
+// if one is configured. If the filter chain fails the query gets SERVFAIL,
+// anything else is forwarded upstream. Queries are audited without a
+// request ID, DNS has none.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	verdict := handlers.VERDICT_ALLOWED
+	if req.Opcode == dns.OpcodeQuery && len(req.Question) == 1 {
+		response := s.check(req.Question[0].Name)
+		verdict = response.Verdict
+		if s.auditor != nil {
+			s.auditor.Log(handlers.NewAuditRecord(handlers.HostIP(w.RemoteAddr().String()), DNS_HANDLER, response, ""))
+		}
+	}
+
+	var reply *dns.Msg
+	switch verdict {
+	case handlers.VERDICT_BLOCKED:
+		reply = s.block(req)
+	case handlers.VERDICT_ERROR:
+		reply = new(dns.Msg).SetRcode(req, dns.RcodeServerFailure)
+	default:
+		reply = s.forward(w.LocalAddr().Network(), req)
+	}
+	metrics.Requests.WithLabelValues(DNS_HANDLER, verdict, dns.RcodeToString[reply.Rcode]).Inc()
+
+	if err := w.WriteMsg(reply); err != nil {
+		log.Printf("Failed to write DNS reply: %s.", err)
+	}
+}
+
+// Check the name and each of its parent domains against the filter chain
+// in one batch, ie: a.b.example.com, b.example.com and example.com.
+// The name is blocked if any of them is, and only fails if none is blocked.
+// Returns the response for the domain that decided the verdict, or for the
+// name if it's allowed.
+func (s *Server) check(name string) *handlers.FilterResponse {
+	domains := HostSuffixes(name)
+	if len(domains) == 0 {
+		return handlers.NewFilterResponse(name, nil, nil, 0, s.policy)
+	}
+
+	start := time.Now()
+	verdicts, errs := s.filter.LookupAll(context.Background(), domains)
+	duration := time.Since(start)
+
+	var failed *handlers.FilterResponse
+	for i, domain := range domains {
+		response := handlers.NewFilterResponse(domain, verdicts[i], errs[i], duration, s.policy)
+		if response.Verdict == handlers.VERDICT_BLOCKED {
+			return response
+		}
+		if response.Verdict == handlers.VERDICT_ERROR && failed == nil {
+			failed = response
+		}
+	}
+
+	if failed != nil {
+		return failed
+	}
+	return handlers.NewFilterResponse(domains[0], verdicts[0], errs[0], duration, s.policy)
+}
+
+// Build the answer for a flagged domain. Without a sinkhole address the
+// domain doesn't exist, with one the name exists but only has the
+// sinkhole's A or AAAA record.
+func (s *Server) block(req *dns.Msg) *dns.Msg {
+	reply := new(dns.Msg).SetReply(req)
+	if s.sinkholeIPv4 == nil && s.sinkholeIPv6 == nil {
+		reply.Rcode = dns.RcodeNameError
+		return reply
+	}
+
+	question := req.Question[0]
+	header := dns.RR_Header{Name: question.Name, Rrtype: question.Qtype, Class: dns.ClassINET, Ttl: s.ttl}
+	switch {
+	case question.Qtype == dns.TypeA && s.sinkholeIPv4 != nil:
+		reply.Answer = append(reply.Answer, &dns.A{Hdr: header, A: s.sinkholeIPv4})
+	case question.Qtype == dns.TypeAAAA && s.sinkholeIPv6 != nil:
+		reply.Answer = append(reply.Answer, &dns.AAAA{Hdr: header, AAAA: s.sinkholeIPv6})
+	}
+	return reply
+}
+
+// Forward the query upstream over the same transport it arrived on,
+// SERVFAIL if the upstream can't be reached.
+func (s *Server) forward(network string, req *dns.Msg) *dns.Msg {
+	client := &dns.Client{Net: network}
+	reply, _, err := client.Exchange(req, s.upstream)
+	if err != nil {
+		log.Printf("Failed to forward DNS query to %s: %s.", s.upstream, err)
+		return new(dns.Msg).SetRcode(req, dns.RcodeServerFailure)
+	}
+	return reply
+}
+
+// Return the queried name and each of its parent domains, lowercased and
+// without the trailing dot. They're the same host suffixes the other front
+// ends check with the match filter, so the top level domain is never
+// checked on its own.
+func HostSuffixes(name string) []string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return []string{}
+	}
+	return filters.Hosts(name)
+}
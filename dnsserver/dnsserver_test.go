@@ -0,0 +1,203 @@
+package dnsserver
+
+import (
+	"encoding/json"
+	"github.com/miekg/dns"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"net"
+	"testing"
+)
+
+// Address every name resolves to at the stub upstream.
+const UPSTREAM_IP = "192.0.2.1"
+
+// Start a UDP DNS server for the handler on a free port, returning its address.
+func StartTestServer(t *testing.T, handler dns.Handler) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	started := make(chan bool)
+	s := &dns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go s.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { s.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+// Start a stub upstream that answers every A query with UPSTREAM_IP.
+func StartTestUpstream(t *testing.T) string {
+	return StartTestServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reply := new(dns.Msg).SetReply(req)
+		question := req.Question[0]
+		if question.Qtype == dns.TypeA {
+			reply.Answer = append(reply.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP(UPSTREAM_IP),
+			})
+		}
+		w.WriteMsg(reply)
+	}))
+}
+
+// Start a resolver with the Fake filter in front of a stub upstream and
+// send it a query.
+func Query(t *testing.T, cfg config.DNS, policy *handlers.Policy, name string, qtype uint16) *dns.Msg {
+	if cfg.Upstream == "" {
+		cfg.Upstream = StartTestUpstream(t)
+	}
+	addr := StartTestServer(t, NewServer(filters.NewFake(), policy, cfg, nil))
+
+	req := new(dns.Msg).SetQuestion(dns.Fqdn(name), qtype)
+	reply, _, err := new(dns.Client).Exchange(req, addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return reply
+}
+
+func TestHostSuffixes(t *testing.T) {
+	suffixes := HostSuffixes("A.b.Example.com.")
+	expected := []string{"a.b.example.com", "b.example.com", "example.com"}
+
+	if len(suffixes) != len(expected) {
+		t.Fatalf("The suffixes were %v when %v were expected.", suffixes, expected)
+	}
+
+	for i := range expected {
+		if suffixes[i] != expected[i] {
+			t.Errorf("The suffixes were %v when %v were expected.", suffixes, expected)
+		}
+	}
+
+	if suffixes := HostSuffixes("a.b.c.d.e.example.com."); len(suffixes) != filters.MAX_HOST_SUFFIXES+1 || suffixes[1] != "c.d.e.example.com" {
+		t.Errorf("The suffixes of a deep name were %v.", suffixes)
+	}
+
+	if len(HostSuffixes(".")) != 0 {
+		t.Error("The root domain had suffixes.")
+	}
+}
+
+func TestForwardAllowed(t *testing.T) {
+	reply := Query(t, config.NewDNS(), nil, "www.google.com", dns.TypeA)
+
+	if reply.Rcode != dns.RcodeSuccess || len(reply.Answer) != 1 {
+		t.Fatalf("Domain \"www.google.com\" was answered with %s and %d records.", dns.RcodeToString[reply.Rcode], len(reply.Answer))
+	}
+
+	if a := reply.Answer[0].(*dns.A); a.A.String() != UPSTREAM_IP {
+		t.Errorf("Domain \"www.google.com\" resolved to %s when the upstream's %s was expected.", a.A, UPSTREAM_IP)
+	}
+}
+
+func TestBlockedNXDomain(t *testing.T) {
+	// The parent domain is flagged, so every subdomain is blocked.
+	reply := Query(t, config.NewDNS(), nil, "login.facebook.com", dns.TypeA)
+
+	if reply.Rcode != dns.RcodeNameError {
+		t.Errorf("Domain \"login.facebook.com\" was answered with %s when NXDOMAIN was expected.", dns.RcodeToString[reply.Rcode])
+	}
+}
+
+func TestBlockedSinkhole(t *testing.T) {
+	cfg := config.NewDNS()
+	cfg.SinkholeIPv4 = "10.0.0.1"
+	cfg.SinkholeIPv6 = "fd00::1"
+
+	reply := Query(t, cfg, nil, "www.facebook.com", dns.TypeA)
+	if len(reply.Answer) != 1 || reply.Answer[0].(*dns.A).A.String() != "10.0.0.1" {
+		t.Errorf("Domain \"www.facebook.com\" was not sinkholed, the answer was %v.", reply.Answer)
+	}
+
+	if reply.Answer[0].Header().Ttl != uint32(cfg.TTL) {
+		t.Errorf("The sinkhole TTL was %d when %d was expected.", reply.Answer[0].Header().Ttl, cfg.TTL)
+	}
+
+	reply = Query(t, cfg, nil, "www.facebook.com", dns.TypeAAAA)
+	if len(reply.Answer) != 1 || reply.Answer[0].(*dns.AAAA).AAAA.String() != "fd00::1" {
+		t.Errorf("Domain \"www.facebook.com\" was not sinkholed over IPv6, the answer was %v.", reply.Answer)
+	}
+
+	reply = Query(t, cfg, nil, "www.facebook.com", dns.TypeMX)
+	if reply.Rcode != dns.RcodeSuccess || len(reply.Answer) != 0 {
+		t.Errorf("Domain \"www.facebook.com\" had %d MX records when none were expected.", len(reply.Answer))
+	}
+}
+
+func TestBlockedPolicy(t *testing.T) {
+	reply := Query(t, config.NewDNS(), handlers.NewPolicy("staff", []string{"malware"}), "www.facebook.com", dns.TypeA)
+
+	if reply.Rcode != dns.RcodeSuccess || len(reply.Answer) != 1 {
+		t.Errorf("Domain \"www.facebook.com\" was answered with %s under the staff policy when it should have been forwarded.", dns.RcodeToString[reply.Rcode])
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	reply := Query(t, config.NewDNS(), nil, "www.bookface.com", dns.TypeA)
+
+	if reply.Rcode != dns.RcodeServerFailure {
+		t.Errorf("A failed lookup was answered with %s when SERVFAIL was expected.", dns.RcodeToString[reply.Rcode])
+	}
+}
+
+func TestUpstreamDown(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cfg := config.NewDNS()
+	cfg.Upstream = conn.LocalAddr().String()
+	conn.Close()
+
+	reply := Query(t, cfg, nil, "www.google.com", dns.TypeA)
+	if reply.Rcode != dns.RcodeServerFailure {
+		t.Errorf("An unreachable upstream was answered with %s when SERVFAIL was expected.", dns.RcodeToString[reply.Rcode])
+	}
+}
+
+// An audit sink that hands each line to the test once it's written, so
+// the test doesn't share a buffer with the server goroutine.
+type TestSink struct {
+	lines chan []byte
+}
+
+func NewTestSink() *TestSink {
+	return &TestSink{lines: make(chan []byte, 1)}
+}
+
+func (s *TestSink) Write(line []byte) error {
+	s.lines <- line
+	return nil
+}
+
+func (s *TestSink) Close() error {
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	sink := NewTestSink()
+	cfg := config.DNS{Upstream: StartTestUpstream(t)}
+	addr := StartTestServer(t, NewServer(filters.NewFake(), nil, cfg, audit.NewLogger([]audit.Sink{sink}, 1)))
+
+	req := new(dns.Msg).SetQuestion("a.www.facebook.com.", dns.TypeA)
+	if _, _, err := new(dns.Client).Exchange(req, addr); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	line := <-sink.lines
+	record := &audit.Record{}
+	if err := json.Unmarshal(line, record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.Verdict != handlers.VERDICT_BLOCKED || record.Client != "127.0.0.1" || record.Handler != DNS_HANDLER ||
+		record.Category != filters.FAKE_CATEGORY {
+		t.Errorf("The query was audited as \"%s\".", line)
+	}
+}
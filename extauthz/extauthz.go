@@ -0,0 +1,145 @@
+// Envoy external authorization service, so Envoy can consult the filter
+// chain before forwarding a request.
+package extauthz
+
+import (
+	"context"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Name of the service in the request metrics.
+const EXTAUTHZ_HANDLER = "extauthz"
+
+// Context extension naming the policy to use, set per route in Envoy's
+// ext_authz filter config.
+const POLICY_EXTENSION = handlers.POLICY_PARAM
+
+// Implements the Envoy ext_authz Check API on top of a filter chain.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+
+	// The chain of filters used by this service to see if a URL is flagged.
+	filter filters.Filter
+
+	// Blocking policies selected per request.
+	policies *handlers.Policies
+
+	// HTTP status Envoy returns to the client for a blocked URL.
+	deniedStatus int
+
+	// Body Envoy returns to the client for a blocked URL.
+	deniedBody string
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+}
+
+// Create a Server instance with the underlying filters.Filter chain. If
+// policies is nil every flagged URL is blocked, and if auditor is nil
+// decisions aren't audited.
+func NewServer(filter filters.Filter, policies *handlers.Policies, deniedStatus int, deniedBody string, auditor *audit.Logger) *Server {
+	return &Server{
+		filter:       filter,
+		policies:     policies,
+		deniedStatus: deniedStatus,
+		deniedBody:   deniedBody,
+		auditor:      auditor,
+	}
+}
+
+// Check the URL of the request Envoy is about to forward. A blocked URL is
+// denied with the configured status and body. If the lookup fails without
+// finding the URL the RPC fails, so Envoy's failure_mode_allow decides
+// whether the request goes through.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attributes := req.GetAttributes()
+	headers := attributes.GetRequest().GetHttp().GetHeaders()
+	key := headers[strings.ToLower(handlers.API_KEY_HEADER)]
+	policy, err := s.policies.Choose(key, attributes.GetContextExtensions()[POLICY_EXTENSION])
+	if err != nil {
+		metrics.Requests.WithLabelValues(EXTAUTHZ_HANDLER, handlers.VERDICT_NONE, codes.OK.String()).Inc()
+		return Denied(handlers.PolicyErrorStatus(err), err.Error(), ""), nil
+	}
+
+	url := RequestURL(req)
+	start := time.Now()
+	verdict, err := s.filter.Lookup(ctx, url)
+	response := handlers.NewFilterResponse(url, verdict, err, time.Since(start), policy)
+	if s.auditor != nil {
+		// Envoy sets the request's ID to its X-Request-ID header.
+		client := attributes.GetSource().GetAddress().GetSocketAddress().GetAddress()
+		requestID := handlers.CheckRequestID(attributes.GetRequest().GetHttp().GetId())
+		s.auditor.Log(handlers.NewAuditRecord(client, EXTAUTHZ_HANDLER, response, requestID))
+	}
+
+	switch response.Verdict {
+	case handlers.VERDICT_BLOCKED:
+		metrics.Requests.WithLabelValues(EXTAUTHZ_HANDLER, response.Verdict, codes.OK.String()).Inc()
+		return Denied(s.deniedStatus, s.deniedBody, response.Category), nil
+	case handlers.VERDICT_ERROR:
+		metrics.Requests.WithLabelValues(EXTAUTHZ_HANDLER, response.Verdict, codes.Unavailable.String()).Inc()
+		return nil, status.Error(codes.Unavailable, response.Error)
+	}
+
+	metrics.Requests.WithLabelValues(EXTAUTHZ_HANDLER, response.Verdict, codes.OK.String()).Inc()
+	return Allowed(), nil
+}
+
+// Build the URL checked for the request, in the same form as the REST API
+// path: the host followed by the path and query, without a scheme. The
+// URL is used verbatim, add the canonical filter to the chain to normalize it.
+func RequestURL(req *authv3.CheckRequest) string {
+	request := req.GetAttributes().GetRequest().GetHttp()
+	url := request.GetHost() + request.GetPath()
+
+	// Envoy sends the query as part of the path, but older versions may
+	// send it separately.
+	if query := request.GetQuery(); query != "" && !strings.Contains(request.GetPath(), "?") {
+		url += "?" + query
+	}
+	return url
+}
+
+// Return a response telling Envoy to forward the request.
+func Allowed() *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{},
+		},
+	}
+}
+
+// Return a response telling Envoy to reply to the client with the status
+// and body instead of forwarding the request. The category of the flagged
+// URL is passed on in the category header, if there is one.
+func Denied(httpStatus int, body string, category string) *authv3.CheckResponse {
+	denied := &authv3.DeniedHttpResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode(httpStatus)},
+		Body:   body,
+	}
+
+	if category != "" {
+		denied.Headers = []*corev3.HeaderValueOption{{
+			Header: &corev3.HeaderValue{Key: handlers.CATEGORY_HEADER, Value: category},
+		}}
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: denied,
+		},
+	}
+}
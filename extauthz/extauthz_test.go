@@ -0,0 +1,161 @@
+package extauthz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+)
+
+func NewTestRequest(host string, path string, headers map[string]string, extensions map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Host:    host,
+					Path:    path,
+					Headers: headers,
+				},
+			},
+			ContextExtensions: extensions,
+		},
+	}
+}
+
+func NewTestPolicies() *handlers.Policies {
+	return handlers.NewPolicies(map[string]config.Policy{
+		"guest": {Categories: []string{"malware", filters.FAKE_CATEGORY}, APIKeys: []string{"guestkey"}},
+		"staff": {Categories: []string{"malware"}, APIKeys: []string{"staffkey"}},
+	}, "guest")
+}
+
+func TestRequestURL(t *testing.T) {
+	req := NewTestRequest("www.google.com", "/a/b?c=1", nil, nil)
+	if url := RequestURL(req); url != "www.google.com/a/b?c=1" {
+		t.Errorf("URL \"%s\" was built when \"www.google.com/a/b?c=1\" was expected.", url)
+	}
+
+	req.Attributes.Request.Http.Path = "/a/b"
+	req.Attributes.Request.Http.Query = "c=1"
+	if url := RequestURL(req); url != "www.google.com/a/b?c=1" {
+		t.Errorf("URL \"%s\" was built from a separate query when \"www.google.com/a/b?c=1\" was expected.", url)
+	}
+}
+
+func TestCheckAllowed(t *testing.T) {
+	s := NewServer(filters.NewFake(), nil, http.StatusForbidden, "Blocked.", nil)
+
+	response, err := s.Check(context.Background(), NewTestRequest("www.google.com", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if codes.Code(response.GetStatus().GetCode()) != codes.OK || response.GetOkResponse() == nil {
+		t.Errorf("URL \"www.google.com/\" was denied when it should have been allowed.")
+	}
+}
+
+func TestCheckDenied(t *testing.T) {
+	s := NewServer(filters.NewFake(), nil, http.StatusUnavailableForLegalReasons, "Blocked.", nil)
+
+	response, err := s.Check(context.Background(), NewTestRequest("www.facebook.com", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if codes.Code(response.GetStatus().GetCode()) != codes.PermissionDenied {
+		t.Fatalf("URL \"www.facebook.com/\" was allowed when it should have been denied.")
+	}
+
+	denied := response.GetDeniedResponse()
+	if int(denied.GetStatus().GetCode()) != http.StatusUnavailableForLegalReasons {
+		t.Errorf("The denied response had status %d when %d was expected.", denied.GetStatus().GetCode(), http.StatusUnavailableForLegalReasons)
+	}
+
+	if denied.GetBody() != "Blocked." {
+		t.Errorf("The denied response had body \"%s\" when \"Blocked.\" was expected.", denied.GetBody())
+	}
+
+	if len(denied.GetHeaders()) != 1 || denied.GetHeaders()[0].GetHeader().GetValue() != filters.FAKE_CATEGORY {
+		t.Errorf("The denied response did not carry the category header, got %v.", denied.GetHeaders())
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	s := NewServer(filters.NewFake(), nil, http.StatusForbidden, "Blocked.", nil)
+
+	_, err := s.Check(context.Background(), NewTestRequest("www.bookface.com", "/", nil, nil))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("A failed lookup returned %s when Unavailable was expected.", status.Code(err))
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	s := NewServer(filters.NewFake(), NewTestPolicies(), http.StatusForbidden, "Blocked.", nil)
+
+	extensions := map[string]string{POLICY_EXTENSION: "staff"}
+	response, err := s.Check(context.Background(), NewTestRequest("www.facebook.com", "/", nil, extensions))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if codes.Code(response.GetStatus().GetCode()) != codes.OK {
+		t.Error("URL \"www.facebook.com/\" was denied under the staff policy.")
+	}
+
+	// The API key takes precedence over the route's policy.
+	headers := map[string]string{"x-api-key": "guestkey"}
+	response, err = s.Check(context.Background(), NewTestRequest("www.facebook.com", "/", headers, extensions))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if codes.Code(response.GetStatus().GetCode()) != codes.PermissionDenied {
+		t.Error("URL \"www.facebook.com/\" was allowed under the guest policy.")
+	}
+
+	headers = map[string]string{"x-api-key": "merp"}
+	response, err = s.Check(context.Background(), NewTestRequest("www.facebook.com", "/", headers, nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if int(response.GetDeniedResponse().GetStatus().GetCode()) != http.StatusUnauthorized {
+		t.Errorf("An unknown API key was denied with %d when %d was expected.", response.GetDeniedResponse().GetStatus().GetCode(), http.StatusUnauthorized)
+	}
+}
+
+func TestCheckAudit(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := NewServer(filters.NewFake(), nil, http.StatusForbidden, "Blocked.", audit.NewLogger([]audit.Sink{audit.NewWriterSink(out)}, 1))
+
+	req := NewTestRequest("www.facebook.com", "/", nil, nil)
+	req.Attributes.Request.Http.Id = "abc123"
+	req.Attributes.Source = &authv3.AttributeContext_Peer{
+		Address: &corev3.Address{Address: &corev3.Address_SocketAddress{
+			SocketAddress: &corev3.SocketAddress{Address: "10.0.0.1"},
+		}},
+	}
+	if _, err := s.Check(context.Background(), req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	record := &audit.Record{}
+	if err := json.Unmarshal(out.Bytes(), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com/" || record.Verdict != handlers.VERDICT_BLOCKED || record.Client != "10.0.0.1" ||
+		record.RequestID != "abc123" || record.Handler != EXTAUTHZ_HANDLER {
+		t.Errorf("The lookup was audited as \"%s\".", out.String())
+	}
+}
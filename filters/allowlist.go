@@ -0,0 +1,157 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"strings"
+	"time"
+)
+
+// Prefix of allowlist entries that exempt a host and all of its subdomains.
+const WILDCARD_PREFIX = "*."
+
+// Allowlist filter. URLs found in the allowlist are never blocked, the
+// rest of the chain isn't consulted. Place it ahead of the filters that
+// it should override, after the canonical filter if one is configured.
+//
+// Entries are either exact URLs, ie: partner.com/login, or a host prefixed
+// with *. which exempts the host and all of its subdomains, ie: *.partner.com.
+type Allowlist struct {
+	// Secondary filter in the filter chain.
+	next Filter
+
+	// The connector holding the allowlist.
+	conn connectors.Connector
+
+	// Timeout of each lookup in the allowlist, 0 for none.
+	timeout time.Duration
+}
+
+// Return a new allowlist filter. Each lookup in the allowlist gives up
+// after timeout, if it's set.
+func NewAllowlist(conn connectors.Connector, timeout time.Duration) *Allowlist {
+	return &Allowlist{
+		conn:    conn,
+		timeout: timeout,
+	}
+}
+
+// Add a secondary filter. Required for the allowlist filter.
+func (a *Allowlist) AddSecondaryFilter(filter Filter) error {
+	if filter == nil {
+		return errors.New("Allowlist filter can't be configured without a secondary Filter.")
+	}
+	a.next = filter
+	return nil
+}
+
+// Return the allowlist entries that would exempt the URL, the URL itself
+// followed by a wildcard entry for its host and each of the host's suffixes.
+func AllowlistEntries(url string) []string {
+	host := url
+	if i := strings.Index(url, "/"); i >= 0 {
+		host = url[:i]
+	}
+
+	entries := []string{url}
+	for _, h := range Hosts(host) {
+		entries = append(entries, WILDCARD_PREFIX+h)
+	}
+	return entries
+}
+
+// Return false if the URL is in the allowlist, otherwise check the next filter.
+// Kept for compatibility, Lookup returns the full Verdict.
+func (a *Allowlist) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := a.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns a Verdict recording which filter in the
+// chain made the decision.
+func (a *Allowlist) Lookup(ctx context.Context, url string) (*Verdict, error) {
+	verdicts, errs := a.LookupAll(ctx, []string{url})
+	return verdicts[0], errs[0]
+}
+
+// Same as Lookup, but for many URLs at once. The allowlist is checked with
+// a single round trip, and only the URLs not in it are passed on to the
+// next filter.
+func (a *Allowlist) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	start := time.Now()
+	entries := make([]string, 0, len(urls))
+	offsets := make([]int, len(urls)+1)
+	for i, url := range urls {
+		entries = append(entries, AllowlistEntries(url)...)
+		offsets[i+1] = len(entries)
+	}
+
+	connCtx, cancel := WithTimeout(ctx, a.timeout)
+	found, err := a.conn.ContainsURLs(connCtx, entries)
+	cancel()
+	if err != nil {
+		metrics.ObserveLookup(a.Name(), time.Since(start), 0, 0, len(urls))
+		// Fall back to the rest of the chain, it's safer to check
+		// the blocklists than to allow everything.
+		log.Printf("%s generated an the error %s when checking %d URLs.", a.Name(), err.Error(), len(urls))
+		return a.next.LookupAll(ctx, urls)
+	}
+
+	verdicts := make([]*Verdict, len(urls))
+	errs := make([]error, len(urls))
+	blocked := make([]int, 0, len(urls))
+	for i, url := range urls {
+		for j := offsets[i]; j < offsets[i+1]; j++ {
+			if found[j] {
+				log.Printf("URL %s allowed by %s entry %s.", url, a.Name(), entries[j])
+				verdicts[i] = NewVerdict(url, false, a.Name())
+				verdicts[i].Source = a.conn.Source()
+				if entries[j] != url {
+					verdicts[i].Matched = entries[j]
+				}
+				break
+			}
+		}
+		if verdicts[i] == nil {
+			blocked = append(blocked, i)
+		}
+	}
+
+	metrics.ObserveLookup(a.Name(), time.Since(start), len(urls)-len(blocked), len(blocked), 0)
+
+	if len(blocked) == 0 {
+		return verdicts, errs
+	}
+
+	nextURLs := make([]string, len(blocked))
+	for j, i := range blocked {
+		nextURLs[j] = urls[i]
+	}
+	nextVerdicts, nextErrs := a.next.LookupAll(ctx, nextURLs)
+	for j, i := range blocked {
+		verdicts[i], errs[i] = nextVerdicts[j], nextErrs[j]
+	}
+
+	return verdicts, errs
+}
+
+// Report the health of the allowlist followed by the rest of the chain.
+// The allowlist isn't required, the rest of the chain is checked when it fails.
+func (a *Allowlist) Status(ctx context.Context) []*Status {
+	return ChainStatus(ctx, func() *Status {
+		return NewDBStatus(ctx, a.Name(), a.conn.Source(), false, a.conn.Ping)
+	}, a.next)
+}
+
+// Close the allowlist's connection pool followed by the rest of the chain.
+func (a *Allowlist) Close() error {
+	return closeNext(a.next, a.conn.Close())
+}
+
+// Return the name of this allowlist, used for logging and reporting.
+func (a *Allowlist) Name() string {
+	return a.conn.Name() + " Allowlist"
+}
@@ -0,0 +1,88 @@
+package filters
+
+import (
+	"context"
+	"testing"
+)
+
+func NewTestAllowlist() *Allowlist {
+	conn := NewTestConnector()
+	conn.db["*.partner.com"] = true
+	conn.db["facebook.com/partner"] = true
+	allowlist := NewAllowlist(conn, 0)
+	allowlist.AddSecondaryFilter(NewFake())
+	return allowlist
+}
+
+func TestAllowlistRequiresSecondaryFilter(t *testing.T) {
+	err := NewAllowlist(NewTestConnector(), 0).AddSecondaryFilter(nil)
+	if err == nil {
+		t.Fatal("Adding a nil secondary filter did not return an error when one was expected.")
+	}
+}
+
+func TestAllowlistEntries(t *testing.T) {
+	entries := AllowlistEntries("a.partner.com/facebook")
+	expected := []string{"a.partner.com/facebook", "*.a.partner.com", "*.partner.com"}
+	if len(entries) != len(expected) {
+		t.Fatalf("The allowlist entries were %v when %v was expected.", entries, expected)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("The allowlist entries were %v when %v was expected.", entries, expected)
+		}
+	}
+}
+
+func TestAllowlistShortCircuits(t *testing.T) {
+	allowlist := NewTestAllowlist()
+
+	cases := map[string]string{
+		"partner.com/facebook":          "*.partner.com",
+		"www.partner.com/facebook/feed": "*.partner.com",
+		"facebook.com/partner":          "",
+	}
+	for url, matched := range cases {
+		verdict, err := allowlist.Lookup(context.Background(), url)
+		if err != nil {
+			t.Errorf("An error was generated when none was expected: %s.", err.Error())
+		}
+		if verdict.Found {
+			t.Errorf("URL %s was found when it was allowlisted.", url)
+		}
+		if verdict.Filter != allowlist.Name() {
+			t.Errorf("The deciding filter was %s when %s was expected.", verdict.Filter, allowlist.Name())
+		}
+		if verdict.Matched != matched {
+			t.Errorf("URL %s matched %s when %s was expected.", url, verdict.Matched, matched)
+		}
+	}
+}
+
+func TestAllowlistChecksNextFilter(t *testing.T) {
+	allowlist := NewTestAllowlist()
+
+	for _, url := range []string{"facebook.com", "notpartner.com/facebook", "facebook.com/partner/more"} {
+		found, _ := allowlist.ContainsURL(context.Background(), url)
+		if !found {
+			t.Errorf("URL %s was not found when it was not allowlisted.", url)
+		}
+	}
+
+	verdicts, _ := allowlist.LookupAll(context.Background(), []string{"partner.com/facebook", "facebook.com", "cisco.com"})
+	if verdicts[0].Found || !verdicts[1].Found || verdicts[2].Found {
+		t.Errorf("The verdicts %v, %v and %v were not as expected.", verdicts[0], verdicts[1], verdicts[2])
+	}
+	if verdicts[2].Filter != "Fake" {
+		t.Errorf("The deciding filter was %s when Fake was expected.", verdicts[2].Filter)
+	}
+}
+
+func TestAllowlistErrorChecksNextFilter(t *testing.T) {
+	allowlist := NewTestAllowlist()
+
+	found, _ := allowlist.ContainsURL(context.Background(), "facebook.com/merp")
+	if !found {
+		t.Error("URL facebook.com/merp was not found when the allowlist generated an error.")
+	}
+}
@@ -1,9 +1,12 @@
 package filters
 
 import (
+	"context"
 	"errors"
 	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/metrics"
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -32,19 +35,36 @@ type Bloom struct {
 	lastIdLoaded int
 
 	// The number of URLs loaded into the Bloom Filter.
-	numURLs int
+	numURLs int64
 
 	// Store whether the bloom filter is ready or not
 	ready int32
 
 	// Timer for refreshing the Bloom Filter and picking up new entries.
 	ticker *time.Ticker
+
+	// Closed to stop the background loading task.
+	done chan struct{}
+
+	// Closed once the background loading task has returned.
+	stopped chan struct{}
+
+	// Makes sure the background loading task is only stopped once.
+	stopOnce sync.Once
+
+	// When the Bloom Filter was last loaded, in Unix nanoseconds.
+	lastLoad int64
+
+	// Timeout of each lookup in the Bloom Filter, 0 for none.
+	timeout time.Duration
 }
 
-// Return a new database filter.
-func NewBloom(conn connectors.Connector, loader connectors.Loader, pageLoadSize int, pageLoadInterval int) *Bloom {
+// Return a new database filter. Each lookup in the Bloom Filter gives up
+// after timeout, if it's set.
+func NewBloom(conn connectors.Connector, loader connectors.Loader, pageLoadSize int, pageLoadInterval int, timeout time.Duration) *Bloom {
 	bloom := &Bloom{
 		conn:             conn,
+		timeout:          timeout,
 		loader:           loader,
 		pageLoadSize:     pageLoadSize,
 		pageLoadInterval: time.Duration(pageLoadInterval),
@@ -52,14 +72,22 @@ func NewBloom(conn connectors.Connector, loader connectors.Loader, pageLoadSize
 		numURLs:          0,
 		ready:            0,
 		ticker:           time.NewTicker(time.Duration(pageLoadInterval) * time.Minute),
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
 	}
 
 	go func() {
+		defer close(bloom.stopped)
 		bloom.Load()
 		atomic.StoreInt32(&(bloom.ready), 1)
 
-		for _ = range bloom.ticker.C {
-			bloom.Load()
+		for {
+			select {
+			case <-bloom.ticker.C:
+				bloom.Load()
+			case <-bloom.done:
+				return
+			}
 		}
 	}()
 
@@ -68,33 +96,58 @@ func NewBloom(conn connectors.Connector, loader connectors.Loader, pageLoadSize
 
 // Load the bloom filter from the backing data store provided by the loader.
 func (b *Bloom) Load() {
+	start := time.Now()
 	maxID, err := b.loader.GetMaxID()
 	if err != nil {
 		log.Printf("Failed to load Bloom Filter %s.", err)
+		metrics.BloomLoadFailures.WithLabelValues(b.Name()).Inc()
 		return
 	}
 
 	count := 0
 	for b.lastIdLoaded < maxID {
-		urls, lastIdLoaded, err := b.loader.GetURLPage(b.lastIdLoaded+1, b.pageLoadSize)
+		// Loading stopped, keep what's loaded so far.
+		select {
+		case <-b.done:
+			log.Printf("The Bloom Filter stopped loading at ID %d.", b.lastIdLoaded)
+			return
+		default:
+		}
+
+		urls, lastIdLoaded, err := b.loader.GetURLPage(b.lastIdLoaded, b.pageLoadSize)
 		if err != nil {
 			log.Printf("Failed to load Bloom Filter %s.", err)
+			metrics.BloomLoadFailures.WithLabelValues(b.Name()).Inc()
 			return
 		}
+		// The rest of the URLs up to maxID were deleted.
+		if len(urls) == 0 {
+			break
+		}
 		for _, url := range urls {
-			b.conn.AddURL(url)
+			b.conn.AddURL(context.Background(), url, "")
 		}
 		count += len(urls)
 		b.lastIdLoaded = lastIdLoaded
 	}
 
-	b.numURLs += count
-	log.Printf("The Bloom Filter loaded %d urls for a total of %d.", count, b.numURLs)
+	total := atomic.AddInt64(&(b.numURLs), int64(count))
+	now := time.Now()
+	atomic.StoreInt64(&(b.lastLoad), now.UnixNano())
+	metrics.BloomURLs.WithLabelValues(b.Name()).Set(float64(total))
+	metrics.BloomLastLoad.WithLabelValues(b.Name()).Set(float64(now.UnixNano()) / float64(time.Second))
+	metrics.BloomLastLoadDuration.WithLabelValues(b.Name()).Set(now.Sub(start).Seconds())
+	log.Printf("The Bloom Filter loaded %d urls for a total of %d.", count, total)
 }
 
-// Stop the Bloom Filter's background loading task.
+// Stop the Bloom Filter's background loading task, waiting for a load
+// that's already running to finish the page it's loading.
 func (b *Bloom) StopLoading() {
-	b.ticker.Stop()
+	b.stopOnce.Do(func() {
+		b.ticker.Stop()
+		close(b.done)
+	})
+	<-b.stopped
 }
 
 // Add a secondary filter. Required for Bloom Filters.
@@ -112,23 +165,133 @@ func (b *Bloom) AddSecondaryFilter(filter Filter) error {
 // it's not found then we can return right away as a negative
 // result is final.
 // If the Bloom Filter has not yet been loaded, skip it.
-func (b *Bloom) ContainsURL(url string) (bool, error) {
+// Kept for compatibility, Lookup returns the full Verdict.
+func (b *Bloom) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := b.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns a Verdict recording which filter in the
+// chain made the decision.
+func (b *Bloom) Lookup(ctx context.Context, url string) (*Verdict, error) {
 	if atomic.LoadInt32(&(b.ready)) == 0 {
 		log.Printf("%s Bloom Filter is not yet loaded, checking the next filter.", b.conn.Name())
-		return b.next.ContainsURL(url)
+		return b.next.Lookup(ctx, url)
 	}
 
-	found, err := b.conn.ContainsURL(url)
+	start := time.Now()
+	connCtx, cancel := WithTimeout(ctx, b.timeout)
+	found, err := b.conn.ContainsURL(connCtx, url)
+	cancel()
+	metrics.ObserveFound(b.Name(), start, []bool{found}, err)
 	if found || err != nil {
 		if err == nil {
 			log.Printf("URL %s found in %s Bloom Filter, checking the next filter.", url, b.conn.Name())
 		} else {
 			log.Printf("%s Bloom Filter generated an error, %s, when checking for %s.", b.conn.Name(), err.Error(), url)
 		}
-		return b.next.ContainsURL(url)
+		return b.next.Lookup(ctx, url)
 	}
 
 	// Not found. Nothing to see here.
 	log.Printf("URL %s not found in %s Bloom Filter.", url, b.conn.Name())
-	return false, nil
+	return b.NewVerdict(url), nil
+}
+
+// Same as Lookup, but for many URLs at once. The Bloom Filter is checked
+// with a single round trip, and only the URLs that were found are passed
+// on to the next filter.
+func (b *Bloom) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	if atomic.LoadInt32(&(b.ready)) == 0 {
+		log.Printf("%s Bloom Filter is not yet loaded, checking the next filter.", b.conn.Name())
+		return b.next.LookupAll(ctx, urls)
+	}
+
+	start := time.Now()
+	connCtx, cancel := WithTimeout(ctx, b.timeout)
+	found, err := b.conn.ContainsURLs(connCtx, urls)
+	cancel()
+	metrics.ObserveFound(b.Name(), start, found, err)
+	if err != nil {
+		log.Printf("%s Bloom Filter generated an error, %s, when checking for %d URLs.", b.conn.Name(), err.Error(), len(urls))
+		return b.next.LookupAll(ctx, urls)
+	}
+
+	verdicts := make([]*Verdict, len(urls))
+	errs := make([]error, len(urls))
+	possible := make([]int, 0, len(urls))
+	for i, url := range urls {
+		if found[i] {
+			possible = append(possible, i)
+		} else {
+			verdicts[i] = b.NewVerdict(url)
+		}
+	}
+
+	if len(possible) == 0 {
+		return verdicts, errs
+	}
+
+	// Could be false positives, check the next filter.
+	log.Printf("%d URLs found in %s Bloom Filter, checking the next filter.", len(possible), b.conn.Name())
+	nextURLs := make([]string, len(possible))
+	for j, i := range possible {
+		nextURLs[j] = urls[i]
+	}
+	nextVerdicts, nextErrs := b.next.LookupAll(ctx, nextURLs)
+
+	for j, i := range possible {
+		verdicts[i], errs[i] = nextVerdicts[j], nextErrs[j]
+	}
+
+	return verdicts, errs
+}
+
+// Create a Verdict for a URL that's not in the Bloom Filter. The Verdict
+// holds until the next load might pick the URL up.
+func (b *Bloom) NewVerdict(url string) *Verdict {
+	verdict := NewVerdict(url, false, b.Name())
+	verdict.Source = b.conn.Source()
+
+	lastLoad := time.Unix(0, atomic.LoadInt64(&(b.lastLoad)))
+	ttl := b.pageLoadInterval*time.Minute - time.Since(lastLoad)
+	if ttl > 0 {
+		verdict.TTL = ttl
+	}
+	return verdict
+}
+
+// Report the health and load state of the Bloom Filter followed by the rest
+// of the chain. The Bloom Filter is never required, lookups skip it until
+// it's loaded and when it fails.
+func (b *Bloom) Status(ctx context.Context) []*Status {
+	return ChainStatus(ctx, func() *Status {
+		status := NewDBStatus(ctx, b.Name(), b.conn.Source(), false, b.conn.Ping)
+		status.Bloom = &BloomStatus{
+			Loaded: atomic.LoadInt32(&(b.ready)) == 1,
+			URLs:   atomic.LoadInt64(&(b.numURLs)),
+		}
+		if lastLoad := atomic.LoadInt64(&(b.lastLoad)); lastLoad != 0 {
+			status.Bloom.LastLoad = time.Unix(0, lastLoad)
+		}
+		status.Ready = status.Ready && status.Bloom.Loaded
+		return status
+	}, b.next)
+}
+
+// Stop loading the Bloom Filter, then close its connection pool and the
+// loader's, followed by the rest of the chain.
+func (b *Bloom) Close() error {
+	b.StopLoading()
+
+	err := b.conn.Close()
+	if loaderErr := b.loader.Close(); err == nil {
+		err = loaderErr
+	}
+	return closeNext(b.next, err)
+}
+
+// Return the name of this Bloom Filter, used for logging and reporting.
+func (b *Bloom) Name() string {
+	return b.conn.Name() + " Bloom Filter"
 }
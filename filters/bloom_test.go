@@ -1,6 +1,7 @@
 package filters
 
 import (
+	"context"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -21,13 +22,12 @@ var updatedURLs = []string{
 }
 
 func NewBloomFilter() *Bloom {
-	connector := &TestConnector{}
-	connector.db = make(map[string]bool)
+	connector := NewTestConnector()
 
 	loader := NewTestLoader()
 	loader.AddURLs(urls)
 
-	bloom := NewBloom(connector, loader, 1, 1)
+	bloom := NewBloom(connector, loader, 1, 1, 0)
 	for atomic.LoadInt32(&(bloom.ready)) == 0 {
 		time.Sleep(1 * time.Second)
 	}
@@ -52,7 +52,7 @@ func TestLoadsExistingURLS(t *testing.T) {
 	bloom := NewBloomFilterNoBackgroundLoading()
 	_ = bloom.AddSecondaryFilter(NewFake())
 	for _, url := range urls {
-		found, _ := bloom.conn.ContainsURL(url)
+		found, _ := bloom.conn.ContainsURL(context.Background(), url)
 		if !found {
 			t.Errorf("URL %s was not found in the Bloom Filter when it was supposed to be.", url)
 		}
@@ -63,7 +63,7 @@ func TestLoadsNewURLS(t *testing.T) {
 	bloom := NewBloomFilter()
 	_ = bloom.AddSecondaryFilter(NewFake())
 	for _, url := range updatedURLs {
-		found, _ := bloom.conn.ContainsURL(url)
+		found, _ := bloom.conn.ContainsURL(context.Background(), url)
 		if found {
 			t.Errorf("URL %s was found in the Bloom Filter when it was not supposed to be.", url)
 		}
@@ -74,7 +74,7 @@ func TestLoadsNewURLS(t *testing.T) {
 	time.Sleep(61 * time.Second)
 
 	for _, url := range updatedURLs {
-		found, _ := bloom.conn.ContainsURL(url)
+		found, _ := bloom.conn.ContainsURL(context.Background(), url)
 		if !found {
 			t.Errorf("URL %s was not found in the Bloom Filter when it was supposed to be.", url)
 		}
@@ -82,11 +82,40 @@ func TestLoadsNewURLS(t *testing.T) {
 	bloom.StopLoading()
 }
 
+func TestLoadsPastDeletedURLs(t *testing.T) {
+	bloom := NewBloomFilterNoBackgroundLoading()
+	// The background loader has exited, only the test loads from here on.
+	bloom.done = make(chan struct{})
+	loader := bloom.loader.(*TestLoader)
+	loader.AddURLs(updatedURLs)
+	delete(loader.db, len(urls)+1)
+	delete(loader.db, len(urls)+2)
+
+	bloom.Load()
+
+	for _, url := range updatedURLs[2:] {
+		found, _ := bloom.conn.ContainsURL(context.Background(), url)
+		if !found {
+			t.Errorf("URL %s was not found in the Bloom Filter when it was supposed to be.", url)
+		}
+	}
+
+	if bloom.lastIdLoaded != loader.maxID {
+		t.Errorf("The Bloom Filter loaded up to ID %d when %d was expected.", bloom.lastIdLoaded, loader.maxID)
+	}
+
+	// Nothing new to load, the last ID loaded must not go backwards.
+	bloom.Load()
+	if bloom.lastIdLoaded != loader.maxID {
+		t.Errorf("The Bloom Filter reloaded to ID %d when %d was expected.", bloom.lastIdLoaded, loader.maxID)
+	}
+}
+
 func TestFalsePositive(t *testing.T) {
 	url := urls[3]
 	bloom := NewBloomFilterNoBackgroundLoading()
 	_ = bloom.AddSecondaryFilter(NewFake())
-	found, _ := bloom.ContainsURL(url)
+	found, _ := bloom.ContainsURL(context.Background(), url)
 	if found {
 		t.Errorf("URL %s was found in the filter chain when it was not supposed to be.", url)
 	}
@@ -96,7 +125,7 @@ func TestPositive(t *testing.T) {
 	url := urls[2]
 	bloom := NewBloomFilterNoBackgroundLoading()
 	_ = bloom.AddSecondaryFilter(NewFake())
-	found, _ := bloom.ContainsURL(url)
+	found, _ := bloom.ContainsURL(context.Background(), url)
 	if !found {
 		t.Errorf("URL %s was not found in the filter chain when it was supposed to be.", url)
 	}
@@ -106,7 +135,7 @@ func TestNegative(t *testing.T) {
 	url := "chickens.com/facebook"
 	bloom := NewBloomFilterNoBackgroundLoading()
 	_ = bloom.AddSecondaryFilter(NewFake())
-	found, _ := bloom.ContainsURL(url)
+	found, _ := bloom.ContainsURL(context.Background(), url)
 	if found {
 		t.Errorf("URL %s was found in the filter chain when it was not supposed to be.", url)
 	}
@@ -116,8 +145,131 @@ func TestErrorChecksNextFilter(t *testing.T) {
 	url := "facebook.com/merp"
 	bloom := NewBloomFilterNoBackgroundLoading()
 	_ = bloom.AddSecondaryFilter(NewFake())
-	found, _ := bloom.ContainsURL(url)
+	found, _ := bloom.ContainsURL(context.Background(), url)
 	if !found {
 		t.Errorf("URL %s was not found in the filter chain when it was supposed to be.", url)
 	}
 }
+
+func TestNegativeNamesBloomFilter(t *testing.T) {
+	url := "chickens.com/facebook"
+	bloom := NewBloomFilterNoBackgroundLoading()
+	_ = bloom.AddSecondaryFilter(NewFake())
+	verdict, _ := bloom.Lookup(context.Background(), url)
+	if verdict.Filter != bloom.Name() {
+		t.Errorf("The deciding filter was %s when %s was expected.", verdict.Filter, bloom.Name())
+	}
+}
+
+func TestLookupAllChecksNextFilterForPositives(t *testing.T) {
+	lookup := []string{urls[2], urls[3], "chickens.com/facebook"}
+	bloom := NewBloomFilterNoBackgroundLoading()
+	_ = bloom.AddSecondaryFilter(NewFake())
+
+	verdicts, errs := bloom.LookupAll(context.Background(), lookup)
+
+	expected := []bool{true, false, false}
+	filters := []string{"Fake", "Fake", bloom.Name()}
+	for i, url := range lookup {
+		if errs[i] != nil {
+			t.Errorf("An error was generated for %s when none was expected: %s.", url, errs[i])
+		}
+		if verdicts[i].Found != expected[i] {
+			t.Errorf("URL %s found was %t when %t was expected.", url, verdicts[i].Found, expected[i])
+		}
+		if verdicts[i].Filter != filters[i] {
+			t.Errorf("The deciding filter for %s was %s when %s was expected.", url, verdicts[i].Filter, filters[i])
+		}
+	}
+}
+
+func TestNegativeHasTTLUntilNextLoad(t *testing.T) {
+	bloom := NewBloomFilterNoBackgroundLoading()
+	_ = bloom.AddSecondaryFilter(NewFake())
+	verdict, _ := bloom.Lookup(context.Background(), "chickens.com/facebook")
+	if verdict.TTL <= 0 || verdict.TTL > time.Minute {
+		t.Errorf("The TTL was %s when up to one minute was expected.", verdict.TTL)
+	}
+	if verdict.Source != "test" {
+		t.Errorf("The source was %s when test was expected.", verdict.Source)
+	}
+}
+
+func TestStatusReportsLoadState(t *testing.T) {
+	bloom := NewBloomFilterNoBackgroundLoading()
+	_ = bloom.AddSecondaryFilter(NewFake())
+
+	statuses := bloom.Status(context.Background())
+	if len(statuses) != 2 || statuses[0].Bloom == nil {
+		t.Fatalf("The Bloom Filter did not report its load state: %v.", statuses)
+	}
+
+	status := statuses[0]
+	if !status.Ready || !status.Bloom.Loaded || status.Required {
+		t.Errorf("The Bloom Filter status was %v when loaded, ready and not required was expected.", status)
+	}
+
+	if status.Bloom.URLs != int64(len(urls)) {
+		t.Errorf("The Bloom Filter reported %d URLs when %d were expected.", status.Bloom.URLs, len(urls))
+	}
+
+	if status.Bloom.LastLoad.IsZero() {
+		t.Error("The Bloom Filter did not report when it was last loaded.")
+	}
+}
+
+func TestCloseStopsLoading(t *testing.T) {
+	bloom := NewBloomFilter()
+	_ = bloom.AddSecondaryFilter(NewFake())
+
+	if err := bloom.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !bloom.conn.(*TestConnector).closed || !bloom.loader.(*TestLoader).closed {
+		t.Error("Closing the Bloom Filter didn't close its connector and loader.")
+	}
+
+	select {
+	case <-bloom.done:
+	default:
+		t.Error("Closing the Bloom Filter didn't stop the background loading.")
+	}
+
+	// Stopping again is harmless.
+	bloom.StopLoading()
+}
+
+func TestCloseWaitsForLoad(t *testing.T) {
+	loader := NewTestLoader()
+	loader.AddURLs(urls)
+	loader.block = make(chan struct{})
+	bloom := NewBloom(NewTestConnector(), loader, 1, 1, 0)
+
+	// Let the first page load, so the second is loading when it's closed.
+	loader.block <- struct{}{}
+	closed := make(chan error, 1)
+	go func() {
+		closed <- bloom.Close()
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("The Bloom Filter closed while it was loading a page.")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(loader.block)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The Bloom Filter didn't close once its page was loaded.")
+	}
+
+	if !loader.closed || bloom.lastIdLoaded != 2 {
+		t.Errorf("The Bloom Filter closed after loading up to ID %d when it should have stopped at ID 2.", bloom.lastIdLoaded)
+	}
+}
@@ -0,0 +1,86 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"github.com/tmortimer/urlfilter/canonical"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"time"
+)
+
+// Canonicalizes URLs before passing them on to the next filter, so that
+// the different ways of writing the same URL all match a single stored
+// entry. This should be the first filter in the chain, and it can not be
+// the last.
+type Canonical struct {
+	// Secondary filter in the filter chain.
+	next Filter
+
+	// Query parameters stripped from URLs, ie: utm_*.
+	stripParams []string
+}
+
+// Return a new canonicalization filter.
+func NewCanonical(stripParams []string) *Canonical {
+	return &Canonical{
+		stripParams: stripParams,
+	}
+}
+
+// Add a secondary filter. Required for the canonicalization filter.
+func (c *Canonical) AddSecondaryFilter(filter Filter) error {
+	if filter == nil {
+		return errors.New("Canonical filter can't be configured without a secondary Filter.")
+	}
+	c.next = filter
+	return nil
+}
+
+// Return the canonical form of the URL. If the URL can't be canonicalized
+// it's passed along as is, the rest of the chain may still know about it.
+func (c *Canonical) Canonicalize(url string) string {
+	canonicalURL, err := canonical.Canonicalize(url, c.stripParams)
+	if err != nil {
+		log.Printf("Unable to canonicalize URL %s, checking it as is: %s", url, err)
+		return url
+	}
+	return canonicalURL
+}
+
+// Check the next filter for the canonical form of the URL. Kept for
+// compatibility, Lookup returns the full Verdict.
+func (c *Canonical) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := c.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns the next filter's Verdict, which
+// records the canonical form of the URL that was checked.
+func (c *Canonical) Lookup(ctx context.Context, url string) (*Verdict, error) {
+	start := time.Now()
+	url = c.Canonicalize(url)
+	metrics.FilterDuration.WithLabelValues("Canonical").Observe(time.Since(start).Seconds())
+	return c.next.Lookup(ctx, url)
+}
+
+// Same as Lookup, but for many URLs at once.
+func (c *Canonical) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	start := time.Now()
+	canonicalURLs := make([]string, len(urls))
+	for i, url := range urls {
+		canonicalURLs[i] = c.Canonicalize(url)
+	}
+	metrics.FilterDuration.WithLabelValues("Canonical").Observe(time.Since(start).Seconds())
+	return c.next.LookupAll(ctx, canonicalURLs)
+}
+
+// Report the health of the chain. Canonicalization has nothing to depend on.
+func (c *Canonical) Status(ctx context.Context) []*Status {
+	return append([]*Status{NewStatus("Canonical")}, c.next.Status(ctx)...)
+}
+
+// Close the rest of the chain. Canonicalization holds nothing to release.
+func (c *Canonical) Close() error {
+	return closeNext(c.next, nil)
+}
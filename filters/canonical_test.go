@@ -0,0 +1,54 @@
+package filters
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCanonicalRequiresSecondaryFilter(t *testing.T) {
+	err := NewCanonical(nil).AddSecondaryFilter(nil)
+	if err == nil {
+		t.Fatal("Adding a nil secondary filter did not return an error when one was expected.")
+	}
+}
+
+func TestCanonicalChecksCanonicalURL(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["example.com/b"] = true
+	db := NewDB(conn, 0)
+	c := NewCanonical([]string{"utm_*"})
+	c.AddSecondaryFilter(db)
+
+	for _, url := range []string{"EXAMPLE.com:80/a/../b", "example.com/b?utm_source=x", "http://example.com/b#top"} {
+		verdict, err := c.Lookup(context.Background(), url)
+		if err != nil {
+			t.Errorf("An error was generated when none was expected: %s.", err.Error())
+		}
+		if !verdict.Found {
+			t.Errorf("URL \"%s\" was not returned by the filter.", url)
+		}
+		if verdict.URL != "example.com/b" {
+			t.Errorf("The URL checked was %s when example.com/b was expected.", verdict.URL)
+		}
+
+		found, _ := c.ContainsURL(context.Background(), url)
+		if !found {
+			t.Errorf("URL \"%s\" was not returned by the filter.", url)
+		}
+	}
+
+	verdicts, _ := c.LookupAll(context.Background(), []string{"Example.com/b", "example.com/c"})
+	if !verdicts[0].Found || verdicts[1].Found {
+		t.Errorf("The verdicts %v and %v were not as expected.", verdicts[0], verdicts[1])
+	}
+}
+
+func TestCanonicalPassesBadURLThrough(t *testing.T) {
+	c := NewCanonical(nil)
+	c.AddSecondaryFilter(NewFake())
+
+	verdict, _ := c.Lookup(context.Background(), "/facebook")
+	if verdict.URL != "/facebook" {
+		t.Errorf("The URL checked was %s when /facebook was expected.", verdict.URL)
+	}
+}
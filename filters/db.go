@@ -1,8 +1,11 @@
 package filters
 
 import (
+	"context"
 	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/metrics"
 	"log"
+	"time"
 )
 
 // Database based filter. Depending on config can be used as a cache.
@@ -13,12 +16,17 @@ type DB struct {
 
 	// The underlying DB connection pool.
 	conn connectors.Connector
+
+	// Timeout of each call to the database, 0 for none.
+	timeout time.Duration
 }
 
-// Return a new database filter.
-func NewDB(conn connectors.Connector) *DB {
+// Return a new database filter. Each call to the database gives up after
+// timeout, if it's set.
+func NewDB(conn connectors.Connector, timeout time.Duration) *DB {
 	return &DB{
-		conn: conn,
+		conn:    conn,
+		timeout: timeout,
 	}
 }
 
@@ -28,38 +36,138 @@ func (d *DB) AddSecondaryFilter(filter Filter) error {
 	return nil
 }
 
+// Create a Verdict decided by this database. If there are more filters in
+// the chain this is a cache, and a URL found here is a cache hit.
+func (d *DB) NewVerdict(url string, found bool, category string) *Verdict {
+	verdict := NewVerdict(url, found, d.conn.Name())
+	verdict.Category = category
+	verdict.Source = d.conn.Source()
+	verdict.Cached = found && d.next != nil
+	return verdict
+}
+
 // Return true if the URL is found in the Database. If it's not then return false
 // if there are no further filters in the chain, otherwise call the next filter.
 // If the database generates an error and this is only a cache we can continue down the
 // filter chain, since each subsequent level should have better information.
-func (d *DB) ContainsURL(url string) (bool, error) {
+// Kept for compatibility, Lookup returns the full Verdict.
+func (d *DB) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := d.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns a Verdict recording which filter in the
+// chain made the decision.
+func (d *DB) Lookup(ctx context.Context, url string) (*Verdict, error) {
 	//TOM error information is lost here on subsequent steps.
-	found, err := d.conn.ContainsURL(url)
+	start := time.Now()
+	found, categories, err := d.find(ctx, []string{url})
+	metrics.ObserveFound(d.conn.Name(), start, found, err)
 	if err != nil {
 		log.Printf("%s generated an the error %s when checking for %s.", d.conn.Name(), err.Error(), url)
 	}
 
-	if found || d.next == nil {
-		if found && d.next != nil {
+	if found[0] || d.next == nil {
+		if found[0] && d.next != nil {
 			log.Printf("URL %s found in %s cache.", url, d.conn.Name())
-		} else if found && d.next == nil {
+		} else if found[0] && d.next == nil {
 			log.Printf("URL %s found in %s.", url, d.conn.Name())
 		}
 
-		return found, err
+		return d.NewVerdict(url, found[0], categories[0]), err
 	}
 
 	// Not found in the cache, try the next filter.
-	found, err = d.next.ContainsURL(url)
+	verdict, err := d.next.Lookup(ctx, url)
 
-	if found {
+	if verdict.Found {
 		// Add it to the cache.
 		log.Printf("Adding URL %s to %s cache.", url, d.conn.Name())
-		err = d.conn.AddURL(url)
+		err = d.add(ctx, url, verdict.Category)
 		if err != nil {
 			log.Printf("%s generated an the error %s when adding %s.", d.conn.Name(), err.Error(), url)
 		}
 	}
 
-	return found, err
+	return verdict, err
+}
+
+// Same as Lookup, but for many URLs at once. The cache is checked with
+// a single round trip, and only the URLs that weren't found are passed
+// on to the next filter.
+func (d *DB) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	verdicts := make([]*Verdict, len(urls))
+	errs := make([]error, len(urls))
+
+	start := time.Now()
+	found, categories, err := d.find(ctx, urls)
+	metrics.ObserveFound(d.conn.Name(), start, found, err)
+	if err != nil {
+		log.Printf("%s generated an the error %s when checking for %d URLs.", d.conn.Name(), err.Error(), len(urls))
+	}
+
+	missing := make([]int, 0, len(urls))
+	for i, url := range urls {
+		if found[i] || d.next == nil {
+			verdicts[i] = d.NewVerdict(url, found[i], categories[i])
+			errs[i] = err
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return verdicts, errs
+	}
+
+	// Not found in the cache, try the next filter.
+	nextURLs := make([]string, len(missing))
+	for j, i := range missing {
+		nextURLs[j] = urls[i]
+	}
+	nextVerdicts, nextErrs := d.next.LookupAll(ctx, nextURLs)
+
+	for j, i := range missing {
+		verdicts[i], errs[i] = nextVerdicts[j], nextErrs[j]
+
+		if verdicts[i].Found {
+			// Add it to the cache.
+			log.Printf("Adding URL %s to %s cache.", urls[i], d.conn.Name())
+			err = d.add(ctx, urls[i], verdicts[i].Category)
+			if err != nil {
+				log.Printf("%s generated an the error %s when adding %s.", d.conn.Name(), err.Error(), urls[i])
+				errs[i] = err
+			}
+		}
+	}
+
+	return verdicts, errs
+}
+
+// Find the URLs in the database, giving up after the timeout.
+func (d *DB) find(ctx context.Context, urls []string) ([]bool, []string, error) {
+	ctx, cancel := WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.conn.FindURLs(ctx, urls)
+}
+
+// Add the URL to the database, giving up after the timeout.
+func (d *DB) add(ctx context.Context, url string, category string) error {
+	ctx, cancel := WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.conn.AddURL(ctx, url, category)
+}
+
+// Report the health of the database followed by the rest of the chain. The
+// database is only required if it's the last filter, caches are skipped
+// when they fail.
+func (d *DB) Status(ctx context.Context) []*Status {
+	return ChainStatus(ctx, func() *Status {
+		return NewDBStatus(ctx, d.conn.Name(), d.conn.Source(), d.next == nil, d.conn.Ping)
+	}, d.next)
+}
+
+// Close the database's connection pool followed by the rest of the chain.
+func (d *DB) Close() error {
+	return closeNext(d.next, d.conn.Close())
 }
@@ -1,11 +1,15 @@
 package filters
 
 import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tmortimer/urlfilter/metrics"
 	"testing"
+	"time"
 )
 
 func TestSetsSecondaryFilter(t *testing.T) {
-	db := NewDB(NewTestConnector())
+	db := NewDB(NewTestConnector(), 0)
 
 	db.AddSecondaryFilter(NewFake())
 }
@@ -14,9 +18,9 @@ func TestContainsURLFound(t *testing.T) {
 	url := "facebook.com"
 	conn := NewTestConnector()
 	conn.db[url] = true
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -28,9 +32,9 @@ func TestContainsURLFound(t *testing.T) {
 
 func TestContainsURLNotFound(t *testing.T) {
 	url := "facebook.com"
-	db := NewDB(NewTestConnector())
+	db := NewDB(NewTestConnector(), 0)
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if found {
 		t.Errorf("URL \"%s\" was incorrectly returned by the filter.", url)
@@ -42,9 +46,9 @@ func TestContainsURLNotFound(t *testing.T) {
 
 func TestContainsURLError(t *testing.T) {
 	url := "facebook.com/merp"
-	db := NewDB(NewTestConnector())
+	db := NewDB(NewTestConnector(), 0)
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if found {
 		t.Errorf("URL \"%s\" was incorrectly returned by the filter.", url)
@@ -56,9 +60,9 @@ func TestContainsURLError(t *testing.T) {
 
 func TestContainsURLErrorFound(t *testing.T) {
 	url := "facebook.com/derp"
-	db := NewDB(NewTestConnector())
+	db := NewDB(NewTestConnector(), 0)
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -72,10 +76,10 @@ func TestContainsURLFoundWSecondary(t *testing.T) {
 	url := "werpwerp.com"
 	conn := NewTestConnector()
 	conn.db[url] = true
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -87,10 +91,10 @@ func TestContainsURLFoundWSecondary(t *testing.T) {
 
 func TestContainsURLNotFoundWNotFoundSecondary(t *testing.T) {
 	url := "werpwerp.com"
-	db := NewDB(NewTestConnector())
+	db := NewDB(NewTestConnector(), 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if found {
 		t.Errorf("URL \"%s\" was incorrectly returned by the filter.", url)
@@ -103,10 +107,10 @@ func TestContainsURLNotFoundWNotFoundSecondary(t *testing.T) {
 func TestContainsURLNotFoundWFoundSecondary(t *testing.T) {
 	url := "facebook.com"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -124,10 +128,10 @@ func TestContainsURLNotFoundWFoundSecondary(t *testing.T) {
 func TestContainsURLNotFoundErrorWFoundSecondary(t *testing.T) {
 	url := "facebook.com/merp"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, _ := db.ContainsURL(url)
+	found, _ := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -147,10 +151,10 @@ func TestContainsURLNotFoundErrorWFoundSecondary(t *testing.T) {
 func TestContainsURLNotFoundErrorWFoundSecondaryError(t *testing.T) {
 	url := "facebook.com/derp"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -164,10 +168,10 @@ func TestContainsURLNotFoundErrorWFoundSecondaryError(t *testing.T) {
 func TestContainsURLNotFoundErrorWErrorInSecondary(t *testing.T) {
 	url := "bookface.com/merp"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if found {
 		t.Errorf("URL \"%s\" was incorrectly returned by the filter.", url)
@@ -180,10 +184,10 @@ func TestContainsURLNotFoundErrorWErrorInSecondary(t *testing.T) {
 func TestContainsURLNotFoundWErrorInSecondary(t *testing.T) {
 	url := "bookface.com"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if found {
 		t.Errorf("URL \"%s\" was incorrectly returned by the filter.", url)
@@ -201,10 +205,10 @@ func TestContainsURLNotFoundWErrorInSecondary(t *testing.T) {
 func TestContainsURLNotFoundWFoundSecondaryErrorInSecondary(t *testing.T) {
 	url := "faceface.com"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, _ := db.ContainsURL(url)
+	found, _ := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -224,10 +228,10 @@ func TestContainsURLNotFoundWFoundSecondaryErrorInSecondary(t *testing.T) {
 func TestContainsURLNotFoundWFoundSecondaryErrorAddingToCache(t *testing.T) {
 	url := "facebook.com/perm"
 	conn := NewTestConnector()
-	db := NewDB(conn)
+	db := NewDB(conn, 0)
 	db.AddSecondaryFilter(NewFake())
 
-	found, err := db.ContainsURL(url)
+	found, err := db.ContainsURL(context.Background(), url)
 
 	if !found {
 		t.Errorf("URL \"%s\" was not returned by the filter.", url)
@@ -241,3 +245,237 @@ func TestContainsURLNotFoundWFoundSecondaryErrorAddingToCache(t *testing.T) {
 		t.Errorf("URL \"%s\" added to the cache when it was not supposed to be.", url)
 	}
 }
+
+func TestLookupNamesDecidingFilter(t *testing.T) {
+	url := "facebook.com"
+	db := NewDB(NewTestConnector(), 0)
+	db.AddSecondaryFilter(NewFake())
+
+	verdict, err := db.Lookup(context.Background(), url)
+
+	if err != nil {
+		t.Errorf("An error was generated when none was expected: %s.", err.Error())
+	}
+	if !verdict.Found {
+		t.Errorf("URL \"%s\" was not returned by the filter.", url)
+	}
+	if verdict.Filter != "Fake" {
+		t.Errorf("The deciding filter was %s when Fake was expected.", verdict.Filter)
+	}
+
+	// Now it's cached.
+	verdict, _ = db.Lookup(context.Background(), url)
+	if verdict.Filter != "Test" {
+		t.Errorf("The deciding filter was %s when Test was expected.", verdict.Filter)
+	}
+}
+
+func TestLookupAll(t *testing.T) {
+	urls := []string{"werpwerp.com", "facebook.com", "cached.com", "bookface.com", "facebook.com/perm"}
+	conn := NewTestConnector()
+	conn.db["cached.com"] = true
+	db := NewDB(conn, 0)
+	db.AddSecondaryFilter(NewFake())
+
+	verdicts, errs := db.LookupAll(context.Background(), urls)
+
+	expected := []bool{false, true, true, false, true}
+	expectedErrs := []bool{false, false, false, true, true}
+	for i, url := range urls {
+		if verdicts[i].Found != expected[i] {
+			t.Errorf("URL \"%s\" found was %t when %t was expected.", url, verdicts[i].Found, expected[i])
+		}
+		if (errs[i] != nil) != expectedErrs[i] {
+			t.Errorf("URL \"%s\" error was %v when an error expected was %t.", url, errs[i], expectedErrs[i])
+		}
+	}
+
+	if verdicts[2].Filter != "Test" {
+		t.Errorf("The deciding filter was %s when Test was expected.", verdicts[2].Filter)
+	}
+
+	// Should be added to the cache now
+	if !conn.db["facebook.com"] {
+		t.Error("URL \"facebook.com\" was not added to the cache.")
+	}
+}
+
+func TestLookupAllErrorChecksNextFilter(t *testing.T) {
+	urls := []string{"facebook.com/merp", "werpwerp.com"}
+	db := NewDB(NewTestConnector(), 0)
+	db.AddSecondaryFilter(NewFake())
+
+	verdicts, errs := db.LookupAll(context.Background(), urls)
+
+	if !verdicts[0].Found || verdicts[1].Found {
+		t.Errorf("The verdicts %v and %v were not as expected.", verdicts[0], verdicts[1])
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("Errors were returned when none were expected: %v.", errs)
+	}
+}
+
+func TestLookupReportsCacheHit(t *testing.T) {
+	url := "facebook.com"
+	db := NewDB(NewTestConnector(), 0)
+	db.AddSecondaryFilter(NewFake())
+
+	verdict, _ := db.Lookup(context.Background(), url)
+	if verdict.Cached {
+		t.Errorf("URL \"%s\" was reported as a cache hit before it was cached.", url)
+	}
+	if verdict.Source != "fake" {
+		t.Errorf("The source was %s when fake was expected.", verdict.Source)
+	}
+
+	verdict, _ = db.Lookup(context.Background(), url)
+	if !verdict.Cached {
+		t.Errorf("URL \"%s\" was not reported as a cache hit.", url)
+	}
+	if verdict.Source != "test" {
+		t.Errorf("The source was %s when test was expected.", verdict.Source)
+	}
+}
+
+func TestLookupAuthoritativeNotCached(t *testing.T) {
+	url := "facebook.com"
+	conn := NewTestConnector()
+	conn.db[url] = true
+	db := NewDB(conn, 0)
+
+	verdict, _ := db.Lookup(context.Background(), url)
+	if verdict.Cached {
+		t.Errorf("URL \"%s\" was reported as a cache hit by the last filter in the chain.", url)
+	}
+}
+
+func TestLookupCategory(t *testing.T) {
+	url := "evil.com"
+	conn := NewTestConnector()
+	conn.AddURL(context.Background(), url, "malware")
+	db := NewDB(conn, 0)
+
+	verdict, _ := db.Lookup(context.Background(), url)
+	if verdict.Category != "malware" {
+		t.Errorf("URL \"%s\" had category %s when malware was expected.", url, verdict.Category)
+	}
+
+	verdicts, _ := db.LookupAll(context.Background(), []string{url, "good.com"})
+	if verdicts[0].Category != "malware" || verdicts[1].Category != "" {
+		t.Errorf("URL \"%s\" had category %s when malware was expected.", url, verdicts[0].Category)
+	}
+}
+
+func TestLookupCachesCategory(t *testing.T) {
+	url := "facebook.com"
+	conn := NewTestConnector()
+	db := NewDB(conn, 0)
+	db.AddSecondaryFilter(NewFake())
+
+	db.Lookup(context.Background(), url)
+	if conn.categories[url] != FAKE_CATEGORY {
+		t.Errorf("URL \"%s\" was cached with category %s when %s was expected.", url, conn.categories[url], FAKE_CATEGORY)
+	}
+
+	verdict, _ := db.Lookup(context.Background(), url)
+	if !verdict.Cached || verdict.Category != FAKE_CATEGORY {
+		t.Errorf("URL \"%s\" was not returned from the cache with category %s.", url, FAKE_CATEGORY)
+	}
+}
+
+func TestStatusRequiresLastDB(t *testing.T) {
+	conn := NewTestConnector()
+	conn.down = true
+	db := NewDB(conn, 0)
+
+	statuses := db.Status(context.Background())
+	if len(statuses) != 1 || statuses[0].Ready || !statuses[0].Required || statuses[0].Error == "" {
+		t.Errorf("The status of a down database was %v when not ready and required was expected.", statuses[0])
+	}
+
+	if Ready(statuses) {
+		t.Error("The chain was ready when the last database was down.")
+	}
+}
+
+func TestStatusCacheNotRequired(t *testing.T) {
+	conn := NewTestConnector()
+	conn.down = true
+	db := NewDB(conn, 0)
+	db.AddSecondaryFilter(NewFake())
+
+	statuses := db.Status(context.Background())
+	if len(statuses) != 2 || statuses[0].Required || statuses[1].Filter != "Fake" {
+		t.Errorf("The statuses of a cache in front of the Fake filter were %v.", statuses)
+	}
+
+	if !Ready(statuses) {
+		t.Error("The chain was not ready when only the cache was down.")
+	}
+}
+
+func TestStatusChecksChainConcurrently(t *testing.T) {
+	cache := NewTestConnector()
+	cache.pingDelay = 100 * time.Millisecond
+	conn := NewTestConnector()
+	conn.pingDelay = 100 * time.Millisecond
+	db := NewDB(cache, 0)
+	db.AddSecondaryFilter(NewDB(conn, 0))
+
+	start := time.Now()
+	statuses := db.Status(context.Background())
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("Checking two databases took %s when they were supposed to be checked at the same time.", elapsed)
+	}
+
+	if !Ready(statuses) || len(statuses) != 2 {
+		t.Errorf("The statuses of two ready databases were %v.", statuses)
+	}
+}
+
+func TestStatusGivesUpAtDeadline(t *testing.T) {
+	conn := NewTestConnector()
+	conn.pingDelay = time.Minute
+	db := NewDB(conn, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	statuses := db.Status(ctx)
+	if statuses[0].Ready || statuses[0].Error == "" {
+		t.Errorf("The status of a database that didn't answer in time was %v when not ready was expected.", statuses[0])
+	}
+}
+
+func TestLookupCountsHits(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["evil.com"] = true
+	db := NewDB(conn, 0)
+
+	hits := testutil.ToFloat64(metrics.FilterLookups.WithLabelValues(conn.Name(), metrics.RESULT_HIT))
+	misses := testutil.ToFloat64(metrics.FilterLookups.WithLabelValues(conn.Name(), metrics.RESULT_MISS))
+
+	db.LookupAll(context.Background(), []string{"evil.com", "good.com", "fine.com"})
+
+	if value := testutil.ToFloat64(metrics.FilterLookups.WithLabelValues(conn.Name(), metrics.RESULT_HIT)); value != hits+1 {
+		t.Errorf("The hit count was %f when %f was expected.", value, hits+1)
+	}
+	if value := testutil.ToFloat64(metrics.FilterLookups.WithLabelValues(conn.Name(), metrics.RESULT_MISS)); value != misses+2 {
+		t.Errorf("The miss count was %f when %f was expected.", value, misses+2)
+	}
+}
+
+func TestCloseClosesChain(t *testing.T) {
+	cache := NewTestConnector()
+	conn := NewTestConnector()
+	db := NewDB(cache, 0)
+	_ = db.AddSecondaryFilter(NewDB(conn, 0))
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !cache.closed || !conn.closed {
+		t.Error("Closing the chain didn't close every database.")
+	}
+}
@@ -0,0 +1,67 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Puts a deadline on every lookup through the rest of the chain, so that
+// a slow database can't hold up the caller indefinitely. Created by the
+// FilterFactory at the front of the chain if a lookup deadline is set.
+type Deadline struct {
+	// Secondary filter in the filter chain.
+	next Filter
+
+	// How long a lookup through the rest of the chain may take.
+	timeout time.Duration
+}
+
+// Return a new deadline filter.
+func NewDeadline(timeout time.Duration) *Deadline {
+	return &Deadline{
+		timeout: timeout,
+	}
+}
+
+// Add a secondary filter. Required for the deadline filter.
+func (d *Deadline) AddSecondaryFilter(filter Filter) error {
+	if filter == nil {
+		return errors.New("Deadline filter can't be configured without a secondary Filter.")
+	}
+	d.next = filter
+	return nil
+}
+
+// Check the next filter for the URL before the deadline. Kept for
+// compatibility, Lookup returns the full Verdict.
+func (d *Deadline) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := d.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns the next filter's Verdict.
+func (d *Deadline) Lookup(ctx context.Context, url string) (*Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.next.Lookup(ctx, url)
+}
+
+// Same as Lookup, but for many URLs at once. The deadline covers the
+// whole batch.
+func (d *Deadline) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.next.LookupAll(ctx, urls)
+}
+
+// Report the health of the chain, the deadline itself isn't a filter that
+// can fail.
+func (d *Deadline) Status(ctx context.Context) []*Status {
+	return d.next.Status(ctx)
+}
+
+// Close the rest of the chain, the deadline holds nothing to release.
+func (d *Deadline) Close() error {
+	return closeNext(d.next, nil)
+}
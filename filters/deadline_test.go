@@ -0,0 +1,70 @@
+package filters
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeadlineRequiresSecondaryFilter(t *testing.T) {
+	if NewDeadline(time.Second).AddSecondaryFilter(nil) == nil {
+		t.Error("The Deadline filter was configured without a secondary Filter.")
+	}
+}
+
+func TestDeadlinePassesThrough(t *testing.T) {
+	d := NewDeadline(time.Second)
+	d.AddSecondaryFilter(NewFake())
+
+	verdict, err := d.Lookup(context.Background(), "facebook.com")
+	if err != nil || !verdict.Found || verdict.Filter != "Fake" {
+		t.Errorf("URL \"facebook.com\" returned %v, %v through the Deadline filter.", verdict, err)
+	}
+
+	if statuses := d.Status(context.Background()); len(statuses) != 1 || statuses[0].Filter != "Fake" {
+		t.Errorf("The Deadline filter reported statuses %v.", statuses)
+	}
+}
+
+func TestDeadlineExpires(t *testing.T) {
+	d := NewDeadline(10 * time.Millisecond)
+	d.AddSecondaryFilter(NewDB(NewTestConnector(), 0))
+
+	start := time.Now()
+	verdict, err := d.Lookup(context.Background(), "slow.com")
+	if err != context.DeadlineExceeded || verdict.Found {
+		t.Errorf("URL \"slow.com\" returned %v, %v when the deadline was expected to pass.", verdict, err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("The lookup took %s after a 10ms deadline.", time.Since(start))
+	}
+
+	verdicts, errs := d.LookupAll(context.Background(), []string{"slow.com", "other.com"})
+	for i := range verdicts {
+		if errs[i] != context.DeadlineExceeded {
+			t.Errorf("URL %d of the batch returned %v when the deadline was expected to pass.", i, errs[i])
+		}
+	}
+}
+
+func TestDBTimeout(t *testing.T) {
+	db := NewDB(NewTestConnector(), 10*time.Millisecond)
+	db.AddSecondaryFilter(NewFake())
+
+	// The cache gives up, but the next filter still has the caller's context.
+	verdict, err := db.Lookup(context.Background(), "slowfacebook.com")
+	if err != nil || !verdict.Found || verdict.Filter != "Fake" {
+		t.Errorf("URL \"slowfacebook.com\" returned %v, %v when the next filter was expected to answer.", verdict, err)
+	}
+}
+
+func TestLookupCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	verdict, err := NewFake().Lookup(ctx, "facebook.com")
+	if err != context.Canceled || verdict.Found {
+		t.Errorf("URL \"facebook.com\" returned %v, %v after the caller went away.", verdict, err)
+	}
+}
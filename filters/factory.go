@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"github.com/tmortimer/urlfilter/config"
 	"github.com/tmortimer/urlfilter/connectors"
+	"log"
+	"time"
 )
 
 // Generage a chain of URL filter caches and then a final url
-// store based on the provided config.
+// store based on the provided config. If a filter can't be created the
+// ones already created are closed.
 func FilterFactory(config *config.Config) (Filter, error) {
 	list := config.Filters
 	var filter Filter = nil
@@ -16,33 +19,112 @@ func FilterFactory(config *config.Config) (Filter, error) {
 		current, err := CreateFilter(list[i], config)
 
 		if err != nil {
-			return nil, err
+			return nil, closeChain(filter, err)
 		}
 
 		err = current.AddSecondaryFilter(filter)
 		if err != nil {
-			return nil, err
+			return nil, closeChain(current, closeChain(filter, err))
 		}
 
 		filter = current
 	}
 
+	// The deadline covers the whole chain, so it goes in front.
+	if config.Timeouts.Lookup > 0 && filter != nil {
+		deadline := NewDeadline(time.Duration(config.Timeouts.Lookup) * time.Millisecond)
+		if err := deadline.AddSecondaryFilter(filter); err != nil {
+			return nil, closeChain(filter, err)
+		}
+		filter = deadline
+	}
+
 	return filter, nil
 }
 
+// Close the part of a chain that was created before err, so its connection
+// pools and Bloom Filter loaders don't outlive it. Returns err.
+func closeChain(filter Filter, err error) error {
+	if filter == nil {
+		return err
+	}
+
+	if closeErr := filter.Close(); closeErr != nil {
+		log.Printf("Failed to close the partial filter chain: %s.", closeErr)
+	}
+	return err
+}
+
+// Return the configured timeout of the named filter's database calls, 0
+// if it doesn't have one.
+func FilterTimeout(name string, config *config.Config) time.Duration {
+	return time.Duration(config.Timeouts.Filters[name]) * time.Millisecond
+}
+
+// Return the form of the URL the configured chain looks up, so that URLs
+// written outside the chain, ie: by the loader or the admin API, are found
+// by it. Only chains with the canonical filter canonicalize, connectors
+// sort the query themselves.
+func StoredURL(url string, config *config.Config) string {
+	if canonical := ChainCanonical(config); canonical != nil {
+		return canonical.Canonicalize(url)
+	}
+	return url
+}
+
+// Return the canonical filter the configured chain uses, nil if the chain
+// doesn't canonicalize.
+func ChainCanonical(config *config.Config) *Canonical {
+	for _, name := range config.Filters {
+		if name == "canonical" {
+			return NewCanonical(config.Canonical.StripParams)
+		}
+	}
+	return nil
+}
+
+// Return the name the filter reports in Verdicts, ie: MySQL for mysql, so
+// config keyed by the names in the "filters" list can be matched to lookups.
+func FilterName(name string, config *config.Config) string {
+	switch name {
+	case "fake":
+		return "Fake"
+	case "canonical":
+		return "Canonical"
+	case "match":
+		return "Match"
+	case "allowlist":
+		sources := map[string]string{"redis": "Redis", "mysql": "MySQL", "file": "File"}
+		return sources[config.Allowlist.Source] + " Allowlist"
+	case "redis":
+		return "Redis"
+	case "mysql":
+		return "MySQL"
+	case "redismysqlbloom":
+		return "Redis Bloom Filter"
+	}
+	return name
+}
+
 // Create each filter in the filter chain.
 func CreateFilter(name string, config *config.Config) (Filter, error) {
 	switch name {
 	case "fake":
 		return NewFake(), nil
+	case "canonical":
+		return NewCanonical(config.Canonical.StripParams), nil
+	case "match":
+		return NewMatch(config.Match.QuerySubsets, config.Match.MaxQueryParams, config.Match.Hierarchical), nil
+	case "allowlist":
+		return CreateAllowlist(config)
 	case "redis":
-		return NewDB(connectors.NewRedis(config.Redis)), nil
+		return NewDB(connectors.NewRedis(config.Redis), FilterTimeout(name, config)), nil
 	case "mysql":
 		connector, err := connectors.NewMySQL(config.MySQL)
 		if err != nil {
 			return nil, err
 		}
-		return NewDB(connector), nil
+		return NewDB(connector, FilterTimeout(name, config)), nil
 	case "redismysqlbloom":
 		loader, err := connectors.NewMySQL(config.RedisMySQLBloom.MySQL)
 		if err != nil {
@@ -50,8 +132,32 @@ func CreateFilter(name string, config *config.Config) (Filter, error) {
 		}
 		return NewBloom(
 			connectors.NewRedisBloom(config.RedisMySQLBloom.Redis), loader,
-			config.RedisMySQLBloom.PageLoadSize, config.RedisMySQLBloom.PageLoadInterval), nil
+			config.RedisMySQLBloom.PageLoadSize, config.RedisMySQLBloom.PageLoadInterval,
+			FilterTimeout(name, config)), nil
 	}
 
 	return nil, fmt.Errorf("Unknown filter %s", name)
 }
+
+// Create the allowlist filter with the connector for its configured source.
+func CreateAllowlist(config *config.Config) (Filter, error) {
+	timeout := FilterTimeout("allowlist", config)
+	switch config.Allowlist.Source {
+	case "redis":
+		return NewAllowlist(connectors.NewRedisSet(config.Allowlist.Redis, config.Allowlist.RedisKey), timeout), nil
+	case "mysql":
+		connector, err := connectors.NewMySQLTable(config.Allowlist.MySQL, connectors.ALLOWLIST_TABLE)
+		if err != nil {
+			return nil, err
+		}
+		return NewAllowlist(connector, timeout), nil
+	case "file":
+		connector, err := connectors.NewFile(config.Allowlist.File)
+		if err != nil {
+			return nil, err
+		}
+		return NewAllowlist(connector, timeout), nil
+	}
+
+	return nil, fmt.Errorf("Unknown allowlist source %s", config.Allowlist.Source)
+}
@@ -1,9 +1,11 @@
 package filters
 
 import (
+	"context"
 	"github.com/tmortimer/urlfilter/config"
 	"github.com/tmortimer/urlfilter/connectors"
 	"testing"
+	"time"
 )
 
 //TOM test the TypeOf these filters
@@ -22,6 +24,77 @@ func TestCreateFakeFilterSuccess(t *testing.T) {
 	}
 }
 
+func TestCreateCanonicalFilterSuccess(t *testing.T) {
+	config := config.NewConfig()
+	config.Canonical.StripParams = []string{"utm_*"}
+	filter, err := CreateFilter("canonical", config)
+
+	if err != nil {
+		t.Fatalf("Creating a Canonical filter generated an error: %s", err)
+	}
+
+	c, ok := filter.(*Canonical)
+	if !ok {
+		t.Fatalf("A filter other than Canonical was created.")
+	}
+
+	if len(c.stripParams) != 1 || c.stripParams[0] != "utm_*" {
+		t.Errorf("The Canonical filter was created with strip params %v.", c.stripParams)
+	}
+}
+
+func TestCreateMatchFilterSuccess(t *testing.T) {
+	config := config.NewConfig()
+	config.Match.QuerySubsets = true
+	config.Match.Hierarchical = true
+	filter, err := CreateFilter("match", config)
+
+	if err != nil {
+		t.Fatalf("Creating a Match filter generated an error: %s", err)
+	}
+
+	m, ok := filter.(*Match)
+	if !ok {
+		t.Fatalf("A filter other than Match was created.")
+	}
+
+	if !m.querySubsets || m.maxQueryParams != 8 || !m.hierarchical {
+		t.Errorf("The Match filter was created with querySubsets %t, maxQueryParams %d and hierarchical %t.", m.querySubsets, m.maxQueryParams, m.hierarchical)
+	}
+}
+
+func TestCreateAllowlistFilterSuccess(t *testing.T) {
+	config := config.NewConfig()
+	config.Allowlist.Source = "redis"
+	filter, err := CreateFilter("allowlist", config)
+
+	if err != nil {
+		t.Fatalf("Creating an Allowlist filter generated an error: %s", err)
+	}
+
+	allowlist, ok := filter.(*Allowlist)
+	if !ok {
+		t.Fatalf("A filter other than Allowlist was created.")
+	}
+
+	_, ok = allowlist.conn.(*connectors.Redis)
+	if !ok {
+		t.Fatalf("A connector other than Redis was created.")
+	}
+}
+
+func TestCreateAllowlistFilterFailure(t *testing.T) {
+	config := config.NewConfig()
+	for _, source := range []string{"file", "mysql", "wzzl"} {
+		config.Allowlist.Source = source
+		_, err := CreateFilter("allowlist", config)
+
+		if err == nil {
+			t.Errorf("Creating a %s Allowlist filter did not generate an error when one was expected.", source)
+		}
+	}
+}
+
 func TestCreateRedisFilterSuccess(t *testing.T) {
 	config := config.NewConfig()
 	filter, err := CreateFilter("redis", config)
@@ -106,3 +179,109 @@ func TestFilterFactoryFailure(t *testing.T) {
 		t.Errorf("Trying to create a filter chain with a filter type that does not exist failed to generate an error.")
 	}
 }
+
+func TestFilterFactoryFailureClosesChain(t *testing.T) {
+	config := config.NewConfig()
+	config.Filters = []string{"wzzl", "fake", "canonical"}
+	_, err := FilterFactory(config)
+	if err == nil {
+		t.Errorf("Trying to create a filter chain ending in the canonical filter failed to generate an error.")
+	}
+
+	config.Filters = []string{"wzzl", "canonical", "redis"}
+	_, err = FilterFactory(config)
+	if err == nil {
+		t.Errorf("Trying to create a filter chain with a filter type that does not exist failed to generate an error.")
+	}
+}
+
+func TestFilterFactoryDeadline(t *testing.T) {
+	config := config.NewConfig()
+	config.Filters = []string{"fake"}
+	config.Timeouts.Lookup = 250
+
+	filter, err := FilterFactory(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	d, ok := filter.(*Deadline)
+	if !ok {
+		t.Fatal("The filter chain wasn't wrapped in a Deadline filter.")
+	}
+
+	if d.timeout != 250*time.Millisecond {
+		t.Errorf("The Deadline filter was created with a %s timeout.", d.timeout)
+	}
+
+	if _, ok := d.next.(*Fake); !ok {
+		t.Error("The Deadline filter didn't wrap the filter chain.")
+	}
+}
+
+func TestFilterTimeout(t *testing.T) {
+	config := config.NewConfig()
+	config.Timeouts.Filters = map[string]int{"mysql": 500}
+
+	if timeout := FilterTimeout("mysql", config); timeout != 500*time.Millisecond {
+		t.Errorf("The mysql filter timeout was %s when 500ms was expected.", timeout)
+	}
+
+	if timeout := FilterTimeout("redis", config); timeout != 0 {
+		t.Errorf("The redis filter timeout was %s when none was configured.", timeout)
+	}
+}
+
+func TestFilterName(t *testing.T) {
+	config := config.NewConfig()
+	config.Allowlist.Source = "redis"
+
+	names := map[string]string{
+		"fake":            "Fake",
+		"mysql":           "MySQL",
+		"redismysqlbloom": "Redis Bloom Filter",
+		"allowlist":       "Redis Allowlist",
+	}
+	for name, expected := range names {
+		if filterName := FilterName(name, config); filterName != expected {
+			t.Errorf("The %s filter was named %s when %s was expected.", name, filterName, expected)
+		}
+	}
+}
+
+func TestStoredURLDefaultChain(t *testing.T) {
+	config := config.NewConfig()
+
+	stored := StoredURL("example.com", config)
+	if stored != "example.com" {
+		t.Errorf("URL \"example.com\" was stored as \"%s\" by a chain without the canonical filter.", stored)
+	}
+
+	conn := NewTestConnector()
+	conn.AddURL(context.Background(), stored, "")
+
+	found, err := NewDB(conn, 0).ContainsURL(context.Background(), "example.com")
+	if err != nil || !found {
+		t.Errorf("URL \"example.com\" wasn't found by the default chain after it was loaded.")
+	}
+}
+
+func TestStoredURLCanonicalChain(t *testing.T) {
+	config := config.NewConfig()
+	config.Filters = []string{"canonical", "redis"}
+
+	stored := StoredURL("EXAMPLE.com", config)
+	if stored != "example.com/" {
+		t.Errorf("URL \"EXAMPLE.com\" was stored as \"%s\" when \"example.com/\" was expected.", stored)
+	}
+
+	conn := NewTestConnector()
+	conn.AddURL(context.Background(), stored, "")
+
+	chain := NewCanonical(nil)
+	_ = chain.AddSecondaryFilter(NewDB(conn, 0))
+	found, err := chain.ContainsURL(context.Background(), "example.com")
+	if err != nil || !found {
+		t.Errorf("URL \"example.com\" wasn't found by the canonical chain after it was loaded.")
+	}
+}
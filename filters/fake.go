@@ -1,10 +1,16 @@
 package filters
 
 import (
+	"context"
 	"errors"
+	"github.com/tmortimer/urlfilter/metrics"
 	"strings"
+	"time"
 )
 
+// The category of every URL the Fake filter finds.
+const FAKE_CATEGORY = "social"
+
 // A Fake filter used for testing and setup.
 type Fake struct{}
 
@@ -20,19 +26,67 @@ func (f *Fake) AddSecondaryFilter(filter Filter) error {
 }
 
 // Returns true if the url contains facebook anywhere in it,
-// because that's as good as anything to block.
-func (f *Fake) ContainsURL(url string) (bool, error) {
+// because that's as good as anything to block. Found URLs
+// are in the social category. Kept for
+// compatibility, Lookup returns the full Verdict.
+func (f *Fake) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := f.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns a Verdict naming the Fake filter. Like
+// the database filters it fails once the context is done.
+func (f *Fake) Lookup(ctx context.Context, url string) (*Verdict, error) {
+	start := time.Now()
+	verdict, err := f.lookup(ctx, url)
+	metrics.ObserveFound("Fake", start, []bool{verdict.Found}, err)
+	return verdict, err
+}
+
+// Decide the Verdict for the URL, see ContainsURL.
+func (f *Fake) lookup(ctx context.Context, url string) (*Verdict, error) {
+	verdict := NewVerdict(url, false, "Fake")
+	verdict.Source = "fake"
+
+	if err := ctx.Err(); err != nil {
+		return verdict, err
+	}
+
 	if strings.Contains(url, "facebook") {
-		return true, nil
+		verdict.Found = true
+		verdict.Category = FAKE_CATEGORY
+		return verdict, nil
 	}
 
 	if strings.Contains(url, "bookface") {
-		return false, errors.New("Bad things happened!")
+		return verdict, errors.New("Bad things happened!")
 	}
 
 	if strings.Contains(url, "faceface") {
-		return true, errors.New("Bad things happened!")
+		verdict.Found = true
+		verdict.Category = FAKE_CATEGORY
+		return verdict, errors.New("Bad things happened!")
 	}
 
-	return false, nil
+	return verdict, nil
+}
+
+// The Fake filter has nothing to depend on, it's always ready.
+func (f *Fake) Status(ctx context.Context) []*Status {
+	return []*Status{NewStatus("Fake")}
+}
+
+// The fake filter holds nothing to release.
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Same as Lookup, but for many URLs at once.
+func (f *Fake) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	verdicts := make([]*Verdict, len(urls))
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		verdicts[i], errs[i] = f.Lookup(ctx, url)
+	}
+	return verdicts, errs
 }
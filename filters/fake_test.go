@@ -1,6 +1,7 @@
 package filters
 
 import (
+	"context"
 	"github.com/google/go-cmp/cmp"
 	"testing"
 )
@@ -44,7 +45,7 @@ func TestAddSecondaryFilterDoesNothing(t *testing.T) {
 func TestContainsURLContains(t *testing.T) {
 	f := NewFake()
 	for _, url := range containsURL {
-		contains, err := f.ContainsURL(url)
+		contains, err := f.ContainsURL(context.Background(), url)
 		if !contains {
 			t.Errorf("URL \"%s\" was incorrectly missed by the filter.", url)
 		}
@@ -57,7 +58,7 @@ func TestContainsURLContains(t *testing.T) {
 func TestContainsURLDoesNotContain(t *testing.T) {
 	f := NewFake()
 	for _, url := range doesNotContainURL {
-		contains, err := f.ContainsURL(url)
+		contains, err := f.ContainsURL(context.Background(), url)
 		if contains {
 			t.Errorf("URL \"%s\" was incorrectly flagged by the filter.", url)
 		}
@@ -70,7 +71,7 @@ func TestContainsURLDoesNotContain(t *testing.T) {
 func TestContainsURLGeneratesError(t *testing.T) {
 	f := NewFake()
 	for _, url := range errorsURL {
-		contains, err := f.ContainsURL(url)
+		contains, err := f.ContainsURL(context.Background(), url)
 		if contains {
 			t.Errorf("URL \"%s\" was incorrectly flagged by the filter.", url)
 		}
@@ -83,7 +84,7 @@ func TestContainsURLGeneratesError(t *testing.T) {
 func TestContainsURLGeneratesErrorStillFound(t *testing.T) {
 	f := NewFake()
 	for _, url := range errorsContainsURL {
-		contains, err := f.ContainsURL(url)
+		contains, err := f.ContainsURL(context.Background(), url)
 		if !contains {
 			t.Errorf("URL \"%s\" was incorrectly missed by the filter.", url)
 		}
@@ -1,12 +1,60 @@
 // Chainable filters that can be used by handlers.FilterHandler.
 package filters
 
-// Represents a chainable filter to identify malicious URLs.
+import (
+	"context"
+	"time"
+)
+
+// Represents a chainable filter to identify malicious URLs. Lookups give up
+// once the context is done, ie: when the caller has gone away or the
+// lookup deadline has passed, and return the context's error.
 type Filter interface {
 	// Add secondary filter. It is up to this filter how the
 	// secondary filter is used, if at all..
 	AddSecondaryFilter(filter Filter) error
 
-	// Check if the URL is contained in the filter.
-	ContainsURL(url string) (bool, error)
+	// Check if the URL is contained in the filter. Kept for compatibility,
+	// this is the same as Lookup but only returns Verdict.Found.
+	ContainsURL(ctx context.Context, url string) (bool, error)
+
+	// Check if the URL is contained in the filter, returning a Verdict
+	// describing where in the chain the decision came from. A Verdict
+	// is always returned, even alongside an error.
+	Lookup(ctx context.Context, url string) (*Verdict, error)
+
+	// Check if each of the URLs is contained in the filter, using a single
+	// round trip per filter where possible. The Verdicts and errors are in
+	// the same order as the URLs.
+	LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error)
+
+	// Report the health of this filter followed by the rest of the chain,
+	// giving up on any check still running when the context is done.
+	Status(ctx context.Context) []*Status
+
+	// Release this filter's resources, ie: database connections, followed
+	// by the rest of the chain. The chain can't be used afterwards.
+	Close() error
+}
+
+// Close the next filter in the chain, if there is one. Returns err if it's
+// set, so the first error in the chain is the one reported.
+func closeNext(next Filter, err error) error {
+	if next == nil {
+		return err
+	}
+
+	if nextErr := next.Close(); err == nil {
+		return nextErr
+	}
+	return err
+}
+
+// Return a context that times out after timeout, or the context itself if
+// timeout is 0. Used for the per filter timeouts of database calls.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
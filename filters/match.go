@@ -0,0 +1,285 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"github.com/tmortimer/urlfilter/canonical"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// The most host suffixes checked for a URL, not counting the host itself.
+const MAX_HOST_SUFFIXES = 4
+
+// The most path prefixes checked for a URL, not counting the path itself.
+const MAX_PATH_PREFIXES = 4
+
+// The most expressions checked for a single URL. Hierarchical lookups that
+// would check more only use the exact query of each path.
+const MAX_EXPRESSIONS = 1024
+
+// Expands a URL into every stored entry that could match it, and checks
+// all of them against the next filter with a single LookupAll. This can
+// not be the last filter in the chain, and should come after the
+// canonical filter if one is configured.
+type Match struct {
+	// Secondary filter in the filter chain.
+	next Filter
+
+	// Match stored entries whose query parameters are a subset of the URL's.
+	querySubsets bool
+
+	// URLs with more query parameters than this are only matched exactly.
+	maxQueryParams int
+
+	// Match stored entries for any host suffix or path prefix of the URL.
+	hierarchical bool
+}
+
+// Return a new match filter.
+func NewMatch(querySubsets bool, maxQueryParams int, hierarchical bool) *Match {
+	return &Match{
+		querySubsets:   querySubsets,
+		maxQueryParams: maxQueryParams,
+		hierarchical:   hierarchical,
+	}
+}
+
+// Add a secondary filter. Required for the match filter.
+func (m *Match) AddSecondaryFilter(filter Filter) error {
+	if filter == nil {
+		return errors.New("Match filter can't be configured without a secondary Filter.")
+	}
+	m.next = filter
+	return nil
+}
+
+// Return the expressions to check for the URL, most specific first. The
+// URL itself is always the first expression, and at most MAX_EXPRESSIONS
+// are returned.
+func (m *Match) Expressions(url string) []string {
+	expressions := []string{url}
+	if m.hierarchical {
+		expressions = HierarchicalExpressions(url, m.querySubsets, m.maxQueryParams)
+	} else if m.querySubsets {
+		expressions = QuerySubsets(url, m.maxQueryParams)
+	}
+
+	if len(expressions) > MAX_EXPRESSIONS {
+		expressions = expressions[:MAX_EXPRESSIONS]
+	}
+	return expressions
+}
+
+// Return the Safe Browsing style expressions for the URL, each host suffix
+// combined with each path prefix, ie: a.b.evil.com/x/y?q expands to
+// a.b.evil.com/x/y?q, a.b.evil.com/x/y, a.b.evil.com/x/, a.b.evil.com/,
+// b.evil.com/x/y?q ... evil.com/. The URL should be in canonical form.
+// If querySubsets is set each query subset of the full path is included,
+// unless that would give more than MAX_EXPRESSIONS expressions.
+func HierarchicalExpressions(url string, querySubsets bool, maxQueryParams int) []string {
+	host, path := url, "/"
+	if i := strings.Index(url, "/"); i >= 0 {
+		host, path = url[:i], url[i:]
+	}
+
+	// The exact path with its query, then without its query.
+	base, params := canonical.SplitQuery(path)
+	prefixes := PathPrefixes(base)
+	hosts := Hosts(host)
+	paths := []string{path}
+	if querySubsets {
+		paths = QuerySubsets(path, maxQueryParams)
+	}
+	if len(hosts)*(len(paths)+len(prefixes)) > MAX_EXPRESSIONS {
+		log.Printf("URL %s has too many expressions, only matching its exact query.", url)
+		paths = []string{path}
+	}
+	if len(paths) == 1 && len(params) > 0 {
+		paths = append(paths, base)
+	}
+	paths = append(paths, prefixes...)
+
+	expressions := []string{url}
+	seen := map[string]bool{url: true}
+	for _, h := range hosts {
+		for _, p := range paths {
+			expression := h + p
+			if !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
+
+// Return the host followed by each of its suffixes, ie: a.b.evil.com
+// gives a.b.evil.com, b.evil.com and evil.com. At most the last five
+// components are used, and the top level domain is never on its own.
+// IP addresses only return themselves. A port is dropped from the suffixes.
+func Hosts(host string) []string {
+	hosts := []string{host}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+		hosts = append(hosts, hostname)
+	}
+
+	if net.ParseIP(strings.Trim(hostname, "[]")) != nil {
+		return hosts
+	}
+
+	components := strings.Split(hostname, ".")
+	start := 1
+	if len(components)-start > MAX_HOST_SUFFIXES+1 {
+		start = len(components) - MAX_HOST_SUFFIXES - 1
+	}
+	for i := start; i < len(components)-1; i++ {
+		hosts = append(hosts, strings.Join(components[i:], "."))
+	}
+	return hosts
+}
+
+// Return the path prefixes for the path, longest first, each ending in a
+// slash, ie: /x/y/z.html gives /x/y/, /x/ and /. The path itself is not
+// included. At most the first three components are used, plus the root.
+func PathPrefixes(path string) []string {
+	components := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	// The last component is a file, or empty if the path ends in a slash.
+	components = components[:len(components)-1]
+	if len(components) > MAX_PATH_PREFIXES-1 {
+		components = components[:MAX_PATH_PREFIXES-1]
+	}
+
+	prefixes := make([]string, 0, len(components)+1)
+	for i := len(components); i >= 0; i-- {
+		prefix := "/" + strings.Join(components[:i], "/")
+		if i > 0 {
+			prefix += "/"
+		}
+		if prefix != path {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// Return the URL with every subset of its query parameters, largest first,
+// ending with the URL without a query string. If the URL has more than
+// maxParams parameters only the URL itself is returned.
+func QuerySubsets(url string, maxParams int) []string {
+	base, params := canonical.SplitQuery(canonical.SortQuery(url))
+	if len(params) == 0 {
+		return []string{url}
+	}
+	if len(params) > maxParams {
+		log.Printf("URL %s has more than %d query parameters, only matching it exactly.", url, maxParams)
+		return []string{url}
+	}
+
+	// Every bit mask of the parameters is a subset. Bucket them by size
+	// so the most specific subsets are checked first.
+	bySize := make([][]string, len(params)+1)
+	seen := make(map[string]bool)
+	for mask := (1 << uint(len(params))) - 1; mask >= 0; mask-- {
+		subset := make([]string, 0, len(params))
+		for i, param := range params {
+			if mask&(1<<uint(i)) != 0 {
+				subset = append(subset, param)
+			}
+		}
+
+		// Repeated parameters generate the same subset more than once.
+		expression := canonical.JoinQuery(base, subset)
+		if !seen[expression] {
+			seen[expression] = true
+			bySize[len(subset)] = append(bySize[len(subset)], expression)
+		}
+	}
+
+	expressions := []string{url}
+	for size := len(params); size >= 0; size-- {
+		for _, expression := range bySize[size] {
+			if size != len(params) {
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
+
+// Check the next filter for the URL, returning true if any of its
+// expressions is found. Kept for compatibility, Lookup returns the full Verdict.
+func (m *Match) ContainsURL(ctx context.Context, url string) (bool, error) {
+	verdict, err := m.Lookup(ctx, url)
+	return verdict.Found, err
+}
+
+// Same as ContainsURL, but returns a Verdict recording which filter in the
+// chain made the decision, and which expression was found.
+func (m *Match) Lookup(ctx context.Context, url string) (*Verdict, error) {
+	verdicts, errs := m.LookupAll(ctx, []string{url})
+	return verdicts[0], errs[0]
+}
+
+// Same as Lookup, but for many URLs at once. The expressions for all of
+// the URLs are checked with a single LookupAll.
+func (m *Match) LookupAll(ctx context.Context, urls []string) ([]*Verdict, []error) {
+	start := time.Now()
+	expressions := make([]string, 0, len(urls))
+	offsets := make([]int, len(urls)+1)
+	for i, url := range urls {
+		expressions = append(expressions, m.Expressions(url)...)
+		offsets[i+1] = len(expressions)
+	}
+	duration := time.Since(start)
+
+	nextVerdicts, nextErrs := m.next.LookupAll(ctx, expressions)
+
+	start = time.Now()
+	verdicts := make([]*Verdict, len(urls))
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		verdicts[i], errs[i] = MatchVerdict(url, nextVerdicts[offsets[i]:offsets[i+1]], nextErrs[offsets[i]:offsets[i+1]])
+	}
+	metrics.FilterDuration.WithLabelValues("Match").Observe((duration + time.Since(start)).Seconds())
+	return verdicts, errs
+}
+
+// Report the health of the chain. Matching has nothing to depend on.
+func (m *Match) Status(ctx context.Context) []*Status {
+	return append([]*Status{NewStatus("Match")}, m.next.Status(ctx)...)
+}
+
+// Close the rest of the chain. Matching holds nothing to release.
+func (m *Match) Close() error {
+	return closeNext(m.next, nil)
+}
+
+// Combine the Verdicts for each of a URL's expressions into a single
+// Verdict for the URL. The first expression found decides, otherwise the
+// Verdict for the URL itself is used along with the first error generated.
+func MatchVerdict(url string, verdicts []*Verdict, errs []error) (*Verdict, error) {
+	for i, verdict := range verdicts {
+		if verdict.Found {
+			if verdict.URL != url {
+				log.Printf("URL %s matched %s.", url, verdict.URL)
+				verdict.Matched = verdict.URL
+				verdict.URL = url
+			}
+			return verdict, errs[i]
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return verdicts[0], err
+		}
+	}
+	return verdicts[0], nil
+}
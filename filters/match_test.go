@@ -0,0 +1,256 @@
+package filters
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestMatchRequiresSecondaryFilter(t *testing.T) {
+	err := NewMatch(true, 8, false).AddSecondaryFilter(nil)
+	if err == nil {
+		t.Fatal("Adding a nil secondary filter did not return an error when one was expected.")
+	}
+}
+
+func TestQuerySubsets(t *testing.T) {
+	expected := []string{
+		"evil.com/a?c=3&b=2&a=1",
+		"evil.com/a?b=2&c=3",
+		"evil.com/a?a=1&c=3",
+		"evil.com/a?a=1&b=2",
+		"evil.com/a?c=3",
+		"evil.com/a?b=2",
+		"evil.com/a?a=1",
+		"evil.com/a",
+	}
+
+	subsets := QuerySubsets("evil.com/a?c=3&b=2&a=1", 8)
+	if !cmp.Equal(subsets, expected) {
+		t.Error("The query subsets were not as expected.")
+		t.Error(cmp.Diff(subsets, expected))
+	}
+}
+
+func TestQuerySubsetsRepeatedParams(t *testing.T) {
+	expected := []string{"evil.com/a?a=1&a=1", "evil.com/a?a=1", "evil.com/a"}
+
+	subsets := QuerySubsets("evil.com/a?a=1&a=1", 8)
+	if !cmp.Equal(subsets, expected) {
+		t.Error("The query subsets were not as expected.")
+		t.Error(cmp.Diff(subsets, expected))
+	}
+}
+
+func TestQuerySubsetsTooManyParams(t *testing.T) {
+	url := "evil.com/a?a=1&b=2&c=3"
+	subsets := QuerySubsets(url, 2)
+	if len(subsets) != 1 || subsets[0] != url {
+		t.Errorf("The query subsets were %v when only %s was expected.", subsets, url)
+	}
+}
+
+func TestMatchExactOnly(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["evil.com/a?a=1"] = true
+	db := NewDB(conn, 0)
+	m := NewMatch(false, 8, false)
+	m.AddSecondaryFilter(db)
+
+	found, _ := m.ContainsURL(context.Background(), "evil.com/a?a=1&b=2")
+	if found {
+		t.Error("URL evil.com/a?a=1&b=2 was found when only exact matches were expected.")
+	}
+}
+
+func TestMatchExtraParams(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["evil.com/a?a=1"] = true
+	db := NewDB(conn, 0)
+	m := NewMatch(true, 8, false)
+	m.AddSecondaryFilter(db)
+
+	url := "evil.com/a?b=2&a=1"
+	verdict, err := m.Lookup(context.Background(), url)
+	if err != nil {
+		t.Errorf("An error was generated when none was expected: %s.", err.Error())
+	}
+	if !verdict.Found {
+		t.Errorf("URL %s was not found when it was expected to match evil.com/a?a=1.", url)
+	}
+	if verdict.URL != url {
+		t.Errorf("The verdict was for %s when %s was expected.", verdict.URL, url)
+	}
+	if verdict.Matched != "evil.com/a?a=1" {
+		t.Errorf("The matched entry was %s when evil.com/a?a=1 was expected.", verdict.Matched)
+	}
+
+	found, _ := m.ContainsURL(context.Background(), "evil.com/a?b=2")
+	if found {
+		t.Error("URL evil.com/a?b=2 was found when it was not supposed to be.")
+	}
+}
+
+func TestMatchLookupAll(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["evil.com/a"] = true
+	db := NewDB(conn, 0)
+	m := NewMatch(true, 8, false)
+	m.AddSecondaryFilter(db)
+
+	verdicts, errs := m.LookupAll(context.Background(), []string{"good.com/a?x=1", "evil.com/a?x=1&y=2"})
+	if verdicts[0].Found || !verdicts[1].Found {
+		t.Errorf("The verdicts %v and %v were not as expected.", verdicts[0], verdicts[1])
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("Errors were generated when none were expected: %v.", errs)
+	}
+}
+
+func TestMatchError(t *testing.T) {
+	m := NewMatch(true, 8, false)
+	m.AddSecondaryFilter(NewDB(NewTestConnector(), 0))
+
+	url := "bookface.com/merp?x=1"
+	verdict, err := m.Lookup(context.Background(), url)
+	if verdict.Found {
+		t.Errorf("URL %s was found when it was not supposed to be.", url)
+	}
+	if verdict.URL != url {
+		t.Errorf("The verdict was for %s when %s was expected.", verdict.URL, url)
+	}
+	if err == nil {
+		t.Error("An error was not generated when one was expected.")
+	}
+}
+
+func TestHosts(t *testing.T) {
+	cases := map[string][]string{
+		"a.b.evil.com":       {"a.b.evil.com", "b.evil.com", "evil.com"},
+		"evil.com":           {"evil.com"},
+		"a.b.c.d.e.f.g":      {"a.b.c.d.e.f.g", "c.d.e.f.g", "d.e.f.g", "e.f.g", "f.g"},
+		"a.evil.com:8080":    {"a.evil.com:8080", "a.evil.com", "evil.com"},
+		"192.168.1.1":        {"192.168.1.1"},
+		"192.168.1.1:8080":   {"192.168.1.1:8080", "192.168.1.1"},
+		"[2001:db8::1]:8080": {"[2001:db8::1]:8080", "2001:db8::1"},
+	}
+
+	for host, expected := range cases {
+		hosts := Hosts(host)
+		if !cmp.Equal(hosts, expected) {
+			t.Errorf("The hosts for %s were not as expected.", host)
+			t.Error(cmp.Diff(hosts, expected))
+		}
+	}
+}
+
+func TestPathPrefixes(t *testing.T) {
+	cases := map[string][]string{
+		"/":               {},
+		"/a":              {"/"},
+		"/a/":             {"/"},
+		"/a/b":            {"/a/", "/"},
+		"/1/2/3/4/5.html": {"/1/2/3/", "/1/2/", "/1/", "/"},
+	}
+
+	for path, expected := range cases {
+		prefixes := PathPrefixes(path)
+		if !cmp.Equal(prefixes, expected) {
+			t.Errorf("The path prefixes for %s were not as expected.", path)
+			t.Error(cmp.Diff(prefixes, expected))
+		}
+	}
+}
+
+func TestHierarchicalExpressions(t *testing.T) {
+	expected := []string{
+		"a.b.evil.com/x/y?q",
+		"a.b.evil.com/x/y",
+		"a.b.evil.com/x/",
+		"a.b.evil.com/",
+		"b.evil.com/x/y?q",
+		"b.evil.com/x/y",
+		"b.evil.com/x/",
+		"b.evil.com/",
+		"evil.com/x/y?q",
+		"evil.com/x/y",
+		"evil.com/x/",
+		"evil.com/",
+	}
+
+	expressions := HierarchicalExpressions("a.b.evil.com/x/y?q", false, 8)
+	if !cmp.Equal(expressions, expected) {
+		t.Error("The hierarchical expressions were not as expected.")
+		t.Error(cmp.Diff(expressions, expected))
+	}
+}
+
+func TestHierarchicalExpressionsQuerySubsets(t *testing.T) {
+	expected := []string{
+		"evil.com/x?b=2&a=1",
+		"evil.com/x?b=2",
+		"evil.com/x?a=1",
+		"evil.com/x",
+		"evil.com/",
+	}
+
+	expressions := HierarchicalExpressions("evil.com/x?b=2&a=1", true, 8)
+	if !cmp.Equal(expressions, expected) {
+		t.Error("The hierarchical expressions were not as expected.")
+		t.Error(cmp.Diff(expressions, expected))
+	}
+}
+
+func TestHierarchicalExpressionsTooMany(t *testing.T) {
+	url := "a.b.c.d.evil.com/x?a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8&i=9&j=10"
+	expressions := HierarchicalExpressions(url, true, 10)
+	if len(expressions) > MAX_EXPRESSIONS {
+		t.Errorf("%d expressions were returned when at most %d were expected.", len(expressions), MAX_EXPRESSIONS)
+	}
+
+	if expressions[0] != url || expressions[len(expressions)-1] != "evil.com/" {
+		t.Errorf("The expressions %v did not start with %s and end with evil.com/.", expressions, url)
+	}
+}
+
+func TestMatchExpressionsCapped(t *testing.T) {
+	m := NewMatch(true, 20, false)
+	expressions := m.Expressions("evil.com/x?a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8&i=9&j=10&k=11&l=12")
+	if len(expressions) != MAX_EXPRESSIONS {
+		t.Errorf("%d expressions were returned when %d were expected.", len(expressions), MAX_EXPRESSIONS)
+	}
+}
+
+func TestMatchHierarchical(t *testing.T) {
+	conn := NewTestConnector()
+	conn.db["evil.com/"] = true
+	conn.db["partly.com/bad/"] = true
+	db := NewDB(conn, 0)
+	m := NewMatch(false, 8, true)
+	m.AddSecondaryFilter(db)
+
+	cases := map[string]string{
+		"a.b.evil.com/x/y?q":       "evil.com/",
+		"evil.com/":                "",
+		"partly.com/bad/thing.exe": "partly.com/bad/",
+	}
+	for url, matched := range cases {
+		verdict, err := m.Lookup(context.Background(), url)
+		if err != nil {
+			t.Errorf("An error was generated when none was expected: %s.", err.Error())
+		}
+		if !verdict.Found {
+			t.Errorf("URL %s was not found when it was supposed to be.", url)
+		}
+		if verdict.Matched != matched {
+			t.Errorf("URL %s matched %s when %s was expected.", url, verdict.Matched, matched)
+		}
+	}
+
+	for _, url := range []string{"notevil.com/", "partly.com/good/thing.exe"} {
+		found, _ := m.ContainsURL(context.Background(), url)
+		if found {
+			t.Errorf("URL %s was found when it was not supposed to be.", url)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package filters
+
+import (
+	"context"
+	"time"
+)
+
+// The health of one filter in the chain, reported by the readiness endpoint.
+type Status struct {
+	// Name of the filter.
+	Filter string `json:"filter"`
+
+	// Where the filter's URLs are stored, if it has a backing store.
+	Source string `json:"source,omitempty"`
+
+	// True if the filter is able to answer lookups.
+	Ready bool `json:"ready"`
+
+	// True if the chain can't answer lookups without this filter. Caches,
+	// Bloom Filters and allowlists are skipped by the chain when they fail.
+	Required bool `json:"required"`
+
+	// The error generated when checking the filter, if any.
+	Error string `json:"error,omitempty"`
+
+	// Load state, only reported by Bloom Filters.
+	Bloom *BloomStatus `json:"bloom,omitempty"`
+}
+
+// The load state of a Bloom Filter.
+type BloomStatus struct {
+	// True once the first load has finished. Until then lookups skip the Bloom Filter.
+	Loaded bool `json:"loaded"`
+
+	// The number of URLs loaded into the Bloom Filter.
+	URLs int64 `json:"urls"`
+
+	// When the Bloom Filter last finished loading, zero if it never has.
+	LastLoad time.Time `json:"lastLoad"`
+}
+
+// Create a Status for a filter without a backing store, which is always ready.
+func NewStatus(filter string) *Status {
+	return &Status{
+		Filter: filter,
+		Ready:  true,
+	}
+}
+
+// Create a Status for a filter backed by a database, pinging it to see if
+// it's ready.
+func NewDBStatus(ctx context.Context, filter string, source string, required bool, ping func(ctx context.Context) error) *Status {
+	status := &Status{
+		Filter:   filter,
+		Source:   source,
+		Ready:    true,
+		Required: required,
+	}
+
+	if err := ping(ctx); err != nil {
+		status.Ready = false
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// Return the status of a filter followed by the statuses of the rest of the
+// chain, checking the rest of the chain while the filter is checked. Next
+// is nil if the filter is the last in the chain.
+func ChainStatus(ctx context.Context, status func() *Status, next Filter) []*Status {
+	if next == nil {
+		return []*Status{status()}
+	}
+
+	rest := make(chan []*Status, 1)
+	go func() {
+		rest <- next.Status(ctx)
+	}()
+
+	return append([]*Status{status()}, <-rest...)
+}
+
+// Return true if every required filter in the statuses is ready.
+func Ready(statuses []*Status) bool {
+	for _, status := range statuses {
+		if status.Required && !status.Ready {
+			return false
+		}
+	}
+	return true
+}
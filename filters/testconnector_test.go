@@ -1,22 +1,35 @@
 package filters
 
 import (
+	"context"
 	"errors"
 	"strings"
+	"time"
 )
 
 type TestConnector struct {
-	db map[string]bool
+	db         map[string]bool
+	categories map[string]string
+	down       bool
+	closed     bool
+	pingDelay  time.Duration
 }
 
 func NewTestConnector() *TestConnector {
 	connector := &TestConnector{}
 	connector.db = make(map[string]bool)
+	connector.categories = make(map[string]string)
 
 	return connector
 }
 
-func (t *TestConnector) ContainsURL(url string) (bool, error) {
+func (t *TestConnector) ContainsURL(ctx context.Context, url string) (bool, error) {
+	// Slow URLs wait until the caller gives up.
+	if strings.Contains(url, "slow") {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+
 	if strings.Contains(url, "merp") {
 		return false, errors.New("Bad things happened!")
 	}
@@ -28,23 +41,83 @@ func (t *TestConnector) ContainsURL(url string) (bool, error) {
 	return t.db[url], nil
 }
 
-func (t *TestConnector) AddURL(url string) error {
+func (t *TestConnector) ContainsURLs(ctx context.Context, urls []string) ([]bool, error) {
+	var err error
+	found := make([]bool, len(urls))
+	for i, url := range urls {
+		var urlErr error
+		found[i], urlErr = t.ContainsURL(ctx, url)
+		if urlErr != nil {
+			err = urlErr
+		}
+	}
+
+	return found, err
+}
+
+func (t *TestConnector) FindURLs(ctx context.Context, urls []string) ([]bool, []string, error) {
+	found, err := t.ContainsURLs(ctx, urls)
+	categories := make([]string, len(urls))
+	for i, url := range urls {
+		if found[i] {
+			categories[i] = t.categories[url]
+		}
+	}
+
+	return found, categories, err
+}
+
+func (t *TestConnector) AddURL(ctx context.Context, url string, category string) error {
 	if strings.Contains(url, "perm") {
 		return errors.New("Bad things happened!")
 	}
 
 	t.db[url] = true
+	t.categories[url] = category
+
+	return nil
+}
+
+func (t *TestConnector) RemoveURL(ctx context.Context, url string) error {
+	delete(t.db, url)
+	delete(t.categories, url)
+
+	return nil
+}
+
+func (t *TestConnector) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(t.pingDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if t.down {
+		return errors.New("Bad things happened!")
+	}
 
 	return nil
 }
 
+func (t *TestConnector) Close() error {
+	t.closed = true
+	return nil
+}
+
 func (t *TestConnector) Name() string {
 	return "Test"
 }
 
+func (t *TestConnector) Source() string {
+	return "test"
+}
+
 type TestLoader struct {
-	db    map[int]string
-	maxID int
+	db     map[int]string
+	maxID  int
+	closed bool
+	// Each page waits to receive from this, if it's set.
+	block chan struct{}
 }
 
 func NewTestLoader() *TestLoader {
@@ -54,22 +127,31 @@ func NewTestLoader() *TestLoader {
 	return loader
 }
 
-func (t *TestLoader) GetURLPage(start int, number int) ([]string, int, error) {
+func (t *TestLoader) GetURLPage(after int, number int) ([]string, int, error) {
+	if t.block != nil {
+		<-t.block
+	}
+
 	urls := make([]string, 0, number)
-	for i := start; i < start+number; i++ {
+	lastID := after
+	for i := after + 1; i <= t.maxID && len(urls) < number; i++ {
 		if url, ok := t.db[i]; ok {
 			urls = append(urls, url)
-		} else {
-			break
+			lastID = i
 		}
 	}
-	return urls, start + number - 1, nil
+	return urls, lastID, nil
 }
 
 func (t *TestLoader) GetMaxID() (int, error) {
 	return t.maxID, nil
 }
 
+func (t *TestLoader) Close() error {
+	t.closed = true
+	return nil
+}
+
 func (t *TestLoader) AddURLs(urls []string) {
 	for _, url := range urls {
 		t.maxID++
@@ -0,0 +1,71 @@
+package filters
+
+import (
+	"fmt"
+	"time"
+)
+
+// The result of checking a URL against the filter chain. Filters fill it
+// in as the request walks the chain, so it records where the decision
+// came from.
+type Verdict struct {
+	// The URL that was checked, as seen by the filter that made the decision.
+	URL string
+
+	// True if the URL was found, meaning it has been flagged.
+	Found bool
+
+	// The name of the filter that made the decision.
+	Filter string
+
+	// The stored entry that was found, if it isn't the URL itself. Set by
+	// the match filter.
+	Matched string
+
+	// The category of the entry that was found, if the list records one.
+	Category string
+
+	// The list that made the decision, ie: the database or file it's stored in.
+	Source string
+
+	// True if the decision came from a cache rather than the authoritative list.
+	Cached bool
+
+	// How long the decision is expected to hold, 0 if unknown.
+	TTL time.Duration
+}
+
+// Create a new Verdict for the URL, decided by the named filter.
+func NewVerdict(url string, found bool, filter string) *Verdict {
+	return &Verdict{
+		URL:    url,
+		Found:  found,
+		Filter: filter,
+	}
+}
+
+// Describe the Verdict for logging.
+func (v *Verdict) String() string {
+	result := "not found"
+	if v.Found {
+		result = "found"
+	}
+
+	description := fmt.Sprintf("URL %s %s by %s", v.URL, result, v.Filter)
+	if v.Source != "" {
+		description += " (" + v.Source + ")"
+	}
+	if v.Cached {
+		description += " cache"
+	}
+	if v.Matched != "" {
+		description += ", matched " + v.Matched
+	}
+	if v.Category != "" {
+		description += ", category " + v.Category
+	}
+	if v.TTL > 0 {
+		description += ", valid for " + v.TTL.String()
+	}
+	return description + "."
+}
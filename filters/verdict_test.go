@@ -0,0 +1,25 @@
+package filters
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerdictString(t *testing.T) {
+	verdict := NewVerdict("a.evil.com/x", true, "Redis")
+	verdict.Source = "localhost:6379"
+	verdict.Cached = true
+	verdict.Matched = "evil.com/"
+	verdict.Category = "malware"
+	verdict.TTL = time.Minute
+
+	expected := "URL a.evil.com/x found by Redis (localhost:6379) cache, matched evil.com/, category malware, valid for 1m0s."
+	if verdict.String() != expected {
+		t.Errorf("The Verdict was described as \"%s\" when \"%s\" was expected.", verdict.String(), expected)
+	}
+
+	expected = "URL google.ca not found by Fake."
+	if NewVerdict("google.ca", false, "Fake").String() != expected {
+		t.Errorf("The Verdict was described as \"%s\" when \"%s\" was expected.", NewVerdict("google.ca", false, "Fake").String(), expected)
+	}
+}
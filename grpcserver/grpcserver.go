@@ -0,0 +1,235 @@
+// gRPC lookup service used by the urlfilter server.
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	"github.com/tmortimer/urlfilter/urlfilterpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"time"
+)
+
+// Metadata holding the API key that selects a policy, the gRPC
+// equivalent of the X-API-Key header.
+const API_KEY_METADATA = "x-api-key"
+
+// Metadata holding the ID of the request, the gRPC equivalent of the
+// X-Request-ID header.
+const REQUEST_ID_METADATA = "x-request-id"
+
+// Names of the RPCs in the request metrics.
+const (
+	CHECK_HANDLER        = "grpc_check"
+	CHECK_MANY_HANDLER   = "grpc_checkmany"
+	CHECK_STREAM_HANDLER = "grpc_checkstream"
+)
+
+// Verdicts of the REST API and their gRPC equivalents.
+var verdicts = map[string]urlfilterpb.Verdict{
+	handlers.VERDICT_ALLOWED: urlfilterpb.Verdict_VERDICT_ALLOWED,
+	handlers.VERDICT_BLOCKED: urlfilterpb.Verdict_VERDICT_BLOCKED,
+	handlers.VERDICT_ERROR:   urlfilterpb.Verdict_VERDICT_ERROR,
+}
+
+// Implements the URLFilter gRPC service on top of a filter chain. A lookup
+// error is reported in the response's verdict rather than failing the RPC,
+// so one bad URL doesn't end a stream.
+type Server struct {
+	urlfilterpb.UnimplementedURLFilterServer
+
+	// The chain of filters used by this service to see if a URL is flagged.
+	filter filters.Filter
+
+	// Checks the URLs of a CheckMany request, the same as the batch endpoint.
+	batch *handlers.BatchHandler
+
+	// Maximum number of URLs accepted in one CheckMany request.
+	maxURLs int
+
+	// Blocking policies selected per request.
+	policies *handlers.Policies
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+}
+
+// Create a Server instance with the underlying filters.Filter chain. If
+// policies is nil every flagged URL is blocked, and if auditor is nil
+// decisions aren't audited.
+func NewServer(filter filters.Filter, maxURLs int, workers int, policies *handlers.Policies, auditor *audit.Logger) *Server {
+	return &Server{
+		filter:   filter,
+		batch:    handlers.NewBatchHandler(filter, maxURLs, workers, handlers.BatchHandlerOptions{Policies: policies}),
+		maxURLs:  maxURLs,
+		policies: policies,
+		auditor:  auditor,
+	}
+}
+
+// Create a gRPC server with the URLFilter service registered.
+func NewGRPCServer(service *Server) *grpc.Server {
+	s := grpc.NewServer()
+	urlfilterpb.RegisterURLFilterServer(s, service)
+	return s
+}
+
+// Stop the gRPC server accepting connections and wait for the calls being
+// handled to finish. Calls still running when ctx is done are cancelled,
+// and ctx's error is returned.
+func Shutdown(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// Check a single URL.
+func (s *Server) Check(ctx context.Context, req *urlfilterpb.CheckRequest) (*urlfilterpb.CheckResponse, error) {
+	policy, err := s.policies.Choose(apiKey(ctx), req.GetPolicy())
+	if err != nil {
+		return nil, policyError(CHECK_HANDLER, err)
+	}
+
+	response := s.check(ctx, req.GetUrl(), policy)
+	s.audit(ctx, CHECK_HANDLER, response, requestID(ctx))
+	metrics.Requests.WithLabelValues(CHECK_HANDLER, response.Verdict, codes.OK.String()).Inc()
+	return NewCheckResponse(response), nil
+}
+
+// Check many URLs in one request, the same as the batch endpoint.
+func (s *Server) CheckMany(ctx context.Context, req *urlfilterpb.CheckManyRequest) (*urlfilterpb.CheckManyResponse, error) {
+	policy, err := s.policies.Choose(apiKey(ctx), req.GetPolicy())
+	if err != nil {
+		return nil, policyError(CHECK_MANY_HANDLER, err)
+	}
+
+	if len(req.GetUrls()) > s.maxURLs {
+		metrics.Requests.WithLabelValues(CHECK_MANY_HANDLER, handlers.VERDICT_NONE, codes.InvalidArgument.String()).Inc()
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("A batch may contain at most %d URLs.", s.maxURLs))
+	}
+
+	responses := s.batch.Lookup(ctx, req.GetUrls(), policy)
+	result := &urlfilterpb.CheckManyResponse{Responses: make([]*urlfilterpb.CheckResponse, len(responses))}
+	id := requestID(ctx)
+	for i, response := range responses {
+		s.audit(ctx, CHECK_MANY_HANDLER, response, id)
+		metrics.Requests.WithLabelValues(CHECK_MANY_HANDLER, response.Verdict, codes.OK.String()).Inc()
+		result.Responses[i] = NewCheckResponse(response)
+	}
+	return result, nil
+}
+
+// Check each URL as it's received. The API key is read once from the
+// stream's metadata, the policy may change with each request. An unknown
+// policy ends the stream. Every lookup is audited under the stream's
+// request ID.
+func (s *Server) CheckStream(stream urlfilterpb.URLFilter_CheckStreamServer) error {
+	key := apiKey(stream.Context())
+	id := requestID(stream.Context())
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		policy, err := s.policies.Choose(key, req.GetPolicy())
+		if err != nil {
+			return policyError(CHECK_STREAM_HANDLER, err)
+		}
+
+		response := s.check(stream.Context(), req.GetUrl(), policy)
+		s.audit(stream.Context(), CHECK_STREAM_HANDLER, response, id)
+		metrics.Requests.WithLabelValues(CHECK_STREAM_HANDLER, response.Verdict, codes.OK.String()).Inc()
+		if err := stream.Send(NewCheckResponse(response)); err != nil {
+			return err
+		}
+	}
+}
+
+// Check the URL against the filter chain, the same as the filter endpoint.
+func (s *Server) check(ctx context.Context, url string, policy *handlers.Policy) *handlers.FilterResponse {
+	start := time.Now()
+	verdict, err := s.filter.Lookup(ctx, url)
+	return handlers.NewFilterResponse(url, verdict, err, time.Since(start), policy)
+}
+
+// Write the audit record of a lookup made by the RPC, if the audit log
+// is enabled.
+func (s *Server) audit(ctx context.Context, handler string, response *handlers.FilterResponse, requestID string) {
+	if s.auditor == nil {
+		return
+	}
+
+	client := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		client = handlers.HostIP(p.Addr.String())
+	}
+	s.auditor.Log(handlers.NewAuditRecord(client, handler, response, requestID))
+}
+
+// Convert the REST API's response to its gRPC equivalent.
+func NewCheckResponse(response *handlers.FilterResponse) *urlfilterpb.CheckResponse {
+	return &urlfilterpb.CheckResponse{
+		Verdict:    verdicts[response.Verdict],
+		Url:        response.URL,
+		Filter:     response.Filter,
+		Matched:    response.Matched,
+		Category:   response.Category,
+		Policy:     response.Policy,
+		Source:     response.Source,
+		Cached:     response.Cached,
+		TtlSeconds: response.TTLSeconds,
+		Error:      response.Error,
+		DurationMs: response.DurationMs,
+	}
+}
+
+// Return the API key from the request metadata, empty if there isn't one.
+func apiKey(ctx context.Context) string {
+	if keys := metadata.ValueFromIncomingContext(ctx, API_KEY_METADATA); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// Return the request ID from the metadata, or a new random one if the
+// caller didn't send a valid one.
+func requestID(ctx context.Context) string {
+	id := ""
+	if ids := metadata.ValueFromIncomingContext(ctx, REQUEST_ID_METADATA); len(ids) > 0 {
+		id = ids[0]
+	}
+	return handlers.CheckRequestID(id)
+}
+
+// Record the rejected request and return the gRPC status for an error
+// selecting a policy.
+func policyError(handler string, err error) error {
+	code := codes.InvalidArgument
+	if err == handlers.ErrUnknownAPIKey {
+		code = codes.Unauthenticated
+	}
+	metrics.Requests.WithLabelValues(handler, handlers.VERDICT_NONE, code.String()).Inc()
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,247 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/urlfilterpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+)
+
+func NewTestPolicies() *handlers.Policies {
+	return handlers.NewPolicies(map[string]config.Policy{
+		"guest": {Categories: []string{"malware", filters.FAKE_CATEGORY}, APIKeys: []string{"guestkey"}},
+		"staff": {Categories: []string{"malware"}, APIKeys: []string{"staffkey"}},
+	}, "guest")
+}
+
+// Serve the service over an in memory connection and return a client for it.
+func NewTestClient(t *testing.T, service *Server) urlfilterpb.URLFilterClient {
+	listener := bufconn.Listen(1024 * 1024)
+	s := NewGRPCServer(service)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return urlfilterpb.NewURLFilterClient(conn)
+}
+
+func TestCheck(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, nil, nil))
+
+	response, err := client.Check(context.Background(), &urlfilterpb.CheckRequest{Url: "www.facebook.com"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.GetVerdict() != urlfilterpb.Verdict_VERDICT_BLOCKED {
+		t.Errorf("URL \"www.facebook.com\" was %s when blocked was expected.", response.GetVerdict())
+	}
+
+	if response.GetFilter() != "Fake" || response.GetSource() != "fake" || response.GetCategory() != filters.FAKE_CATEGORY {
+		t.Errorf("The response did not report the Fake filter's verdict, got %v.", response)
+	}
+
+	response, err = client.Check(context.Background(), &urlfilterpb.CheckRequest{Url: "www.google.com"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.GetVerdict() != urlfilterpb.Verdict_VERDICT_ALLOWED {
+		t.Errorf("URL \"www.google.com\" was %s when allowed was expected.", response.GetVerdict())
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, nil, nil))
+
+	response, err := client.Check(context.Background(), &urlfilterpb.CheckRequest{Url: "www.bookface.com"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.GetVerdict() != urlfilterpb.Verdict_VERDICT_ERROR || response.GetError() == "" {
+		t.Errorf("URL \"www.bookface.com\" was %s with error \"%s\" when an error was expected.", response.GetVerdict(), response.GetError())
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, NewTestPolicies(), nil))
+
+	response, err := client.Check(context.Background(), &urlfilterpb.CheckRequest{Url: "www.facebook.com", Policy: "staff"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.GetVerdict() != urlfilterpb.Verdict_VERDICT_ALLOWED || response.GetPolicy() != "staff" {
+		t.Errorf("URL \"www.facebook.com\" was %s under policy %s when allowed under staff was expected.", response.GetVerdict(), response.GetPolicy())
+	}
+
+	// The API key takes precedence over the requested policy.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), API_KEY_METADATA, "guestkey")
+	response, err = client.Check(ctx, &urlfilterpb.CheckRequest{Url: "www.facebook.com", Policy: "staff"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.GetVerdict() != urlfilterpb.Verdict_VERDICT_BLOCKED || response.GetPolicy() != "guest" {
+		t.Errorf("URL \"www.facebook.com\" was %s under policy %s when blocked under guest was expected.", response.GetVerdict(), response.GetPolicy())
+	}
+}
+
+func TestCheckPolicyErrors(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, NewTestPolicies(), nil))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), API_KEY_METADATA, "merp")
+	_, err := client.Check(ctx, &urlfilterpb.CheckRequest{Url: "www.facebook.com"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("An unknown API key returned %s when Unauthenticated was expected.", status.Code(err))
+	}
+
+	_, err = client.Check(context.Background(), &urlfilterpb.CheckRequest{Url: "www.facebook.com", Policy: "merp"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("An unknown policy returned %s when InvalidArgument was expected.", status.Code(err))
+	}
+}
+
+func TestCheckMany(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, nil, nil))
+
+	urls := []string{"www.facebook.com", "www.google.com", "www.bookface.com"}
+	expected := []urlfilterpb.Verdict{
+		urlfilterpb.Verdict_VERDICT_BLOCKED,
+		urlfilterpb.Verdict_VERDICT_ALLOWED,
+		urlfilterpb.Verdict_VERDICT_ERROR,
+	}
+
+	response, err := client.CheckMany(context.Background(), &urlfilterpb.CheckManyRequest{Urls: urls})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(response.GetResponses()) != len(urls) {
+		t.Fatalf("%d responses were returned for %d URLs.", len(response.GetResponses()), len(urls))
+	}
+
+	for i, r := range response.GetResponses() {
+		if r.GetUrl() != urls[i] {
+			t.Errorf("Response %d was for URL \"%s\" when \"%s\" was expected.", i, r.GetUrl(), urls[i])
+		}
+
+		if r.GetVerdict() != expected[i] {
+			t.Errorf("URL \"%s\" was %s when %s was expected.", urls[i], r.GetVerdict(), expected[i])
+		}
+	}
+}
+
+func TestCheckManyTooLarge(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 2, 2, nil, nil))
+
+	urls := []string{"www.facebook.com", "www.google.com", "www.bookface.com"}
+	_, err := client.CheckMany(context.Background(), &urlfilterpb.CheckManyRequest{Urls: urls})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("An oversized batch returned %s when InvalidArgument was expected.", status.Code(err))
+	}
+}
+
+func TestCheckStream(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, NewTestPolicies(), nil))
+
+	stream, err := client.CheckStream(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	requests := []*urlfilterpb.CheckRequest{
+		{Url: "www.facebook.com"},
+		{Url: "www.facebook.com", Policy: "staff"},
+		{Url: "www.bookface.com"},
+	}
+	expected := []urlfilterpb.Verdict{
+		urlfilterpb.Verdict_VERDICT_BLOCKED,
+		urlfilterpb.Verdict_VERDICT_ALLOWED,
+		urlfilterpb.Verdict_VERDICT_ERROR,
+	}
+
+	for i, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		response, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if response.GetVerdict() != expected[i] {
+			t.Errorf("Stream request %d for URL \"%s\" was %s when %s was expected.", i, req.GetUrl(), response.GetVerdict(), expected[i])
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("The stream ended with %v when EOF was expected.", err)
+	}
+}
+
+func TestCheckStreamUnknownPolicy(t *testing.T) {
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, NewTestPolicies(), nil))
+
+	stream, err := client.CheckStream(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := stream.Send(&urlfilterpb.CheckRequest{Url: "www.facebook.com", Policy: "merp"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("An unknown policy ended the stream with %s when InvalidArgument was expected.", status.Code(err))
+	}
+}
+
+func TestCheckAudit(t *testing.T) {
+	out := &bytes.Buffer{}
+	auditor := audit.NewLogger([]audit.Sink{audit.NewWriterSink(out)}, 1)
+	client := NewTestClient(t, NewServer(filters.NewFake(), 10, 2, nil, auditor))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), REQUEST_ID_METADATA, "abc123")
+	if _, err := client.Check(ctx, &urlfilterpb.CheckRequest{Url: "www.facebook.com"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	record := &audit.Record{}
+	if err := json.Unmarshal(out.Bytes(), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com" || record.Verdict != handlers.VERDICT_BLOCKED || record.RequestID != "abc123" ||
+		record.Handler != CHECK_HANDLER || record.Category != filters.FAKE_CATEGORY {
+		t.Errorf("The lookup was audited as \"%s\".", out.String())
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/filters"
+	"log"
+	"net/http"
+)
+
+const ADMIN_ENDPOINT = "/admin/1/urls"
+
+// Largest admin request body accepted, in bytes.
+const ADMIN_MAX_BODY_BYTES = 1024 * 1024
+
+// The authoritative URL store the admin API writes through to.
+type URLStore interface {
+	// Check if the URL is in the store.
+	ContainsURL(ctx context.Context, url string) (bool, error)
+
+	// Add the URL to the store with its category.
+	AddURL(ctx context.Context, url string, category string) error
+
+	// Remove the URL from the store.
+	RemoveURL(ctx context.Context, url string) error
+
+	// Return the name of the store. Used for logging.
+	Name() string
+
+	// Close the connection to the store.
+	Close() error
+}
+
+// A cache in front of the store, invalidated whenever a URL is written.
+type URLCache interface {
+	// Remove the URL from the cache.
+	RemoveURL(ctx context.Context, url string) error
+
+	// Return the name of the cache. Used for logging.
+	Name() string
+
+	// Close the connection to the cache.
+	Close() error
+}
+
+// Adds and removes URLs at runtime.
+type AdminHandler struct {
+	// The authoritative store URLs are written to.
+	store URLStore
+
+	// Caches holding entries from the store, invalidated on every write.
+	caches []URLCache
+
+	// API keys allowed to use the admin API.
+	keys []string
+
+	// Canonicalizes URLs the same way as the filter chain, nil if the chain
+	// doesn't canonicalize.
+	canonical *filters.Canonical
+}
+
+// Request body for adding and removing URLs.
+type AdminRequest struct {
+	// The URLs to add or remove.
+	URLs []string `json:"urls"`
+
+	// The category to add the URLs with, ignored when removing.
+	Category string `json:"category"`
+}
+
+// Response body for adding and removing URLs.
+type AdminResponse struct {
+	// The form of each URL that was written, as the chain looks it up.
+	URLs []string `json:"urls"`
+}
+
+// Create an AdminHandler writing to store and invalidating caches. If
+// canonical is nil URLs are written as they're sent.
+func NewAdminHandler(store URLStore, caches []URLCache, keys []string, canonical *filters.Canonical) *AdminHandler {
+	return &AdminHandler{
+		store:     store,
+		caches:    caches,
+		keys:      keys,
+		canonical: canonical,
+	}
+}
+
+// Create an AdminHandler from the config. URLs are written to the store at
+// the end of the filter chain, MySQL or Redis, in the form the chain looks
+// them up. If the store is MySQL the Redis cache is invalidated when it's
+// part of the chain. The Bloom Filter picks up added URLs on its next
+// load. Removed URLs stay in the Bloom Filter, but it always checks the
+// next filter on a hit.
+func CreateAdminHandler(config *config.Config) (*AdminHandler, error) {
+	var store URLStore
+	caches := []URLCache{}
+
+	switch config.Filters[len(config.Filters)-1] {
+	case "mysql":
+		mysql, err := connectors.NewMySQL(config.MySQL)
+		if err != nil {
+			return nil, err
+		}
+		store = mysql
+
+		for _, name := range config.Filters {
+			if name == "redis" {
+				caches = append(caches, connectors.NewRedis(config.Redis))
+			}
+		}
+	case "redis":
+		store = connectors.NewRedis(config.Redis)
+	default:
+		return nil, fmt.Errorf("The admin API can't write to the %s filter.", config.Filters[len(config.Filters)-1])
+	}
+
+	return NewAdminHandler(store, caches, config.Admin.APIKeys, filters.ChainCanonical(config)), nil
+}
+
+// Close the connections to the store and the caches, returning the first
+// error.
+func (a *AdminHandler) Close() error {
+	first := a.store.Close()
+	for _, cache := range a.caches {
+		if err := cache.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Return true if the request carries one of the admin API keys.
+func (a *AdminHandler) Authorized(r *http.Request) bool {
+	key := []byte(r.Header.Get(API_KEY_HEADER))
+	if len(key) == 0 {
+		return false
+	}
+
+	authorized := false
+	for _, valid := range a.keys {
+		if subtle.ConstantTimeCompare(key, []byte(valid)) == 1 {
+			authorized = true
+		}
+	}
+	return authorized
+}
+
+// Handles admin requests. POST adds the URLs in the body, DELETE removes them.
+func (a *AdminHandler) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodPost+", "+http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.Authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := &AdminRequest{}
+	body := http.MaxBytesReader(w, r.Body, ADMIN_MAX_BODY_BYTES)
+	if err := json.NewDecoder(body).Decode(request); err != nil {
+		http.Error(w, fmt.Sprintf("Request body must be a JSON object with a list of urls: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &AdminResponse{URLs: make([]string, 0, len(request.URLs))}
+	for _, url := range request.URLs {
+		url = a.Canonicalize(url)
+
+		var err error
+		if r.Method == http.MethodPost {
+			err = a.Add(r.Context(), url, request.Category)
+		} else {
+			err = a.Remove(r.Context(), url)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write %s: %s", url, err), http.StatusInternalServerError)
+			return
+		}
+
+		response.URLs = append(response.URLs, url)
+	}
+
+	w.Header().Set("Content-Type", JSON_CONTENT_TYPE)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write the admin response: %s.", err)
+	}
+}
+
+// Store the same form of the URL the filter chain looks up.
+func (a *AdminHandler) Canonicalize(url string) string {
+	if a.canonical == nil {
+		return url
+	}
+	return a.canonical.Canonicalize(url)
+}
+
+// Add the URL to the store. The store keeps the category of a URL that's
+// already there, to change it remove the URL first.
+func (a *AdminHandler) Add(ctx context.Context, url string, category string) error {
+	log.Printf("Adding URL %s to %s.", url, a.store.Name())
+	if err := a.store.AddURL(ctx, url, category); err != nil {
+		return err
+	}
+
+	return a.Invalidate(ctx, url)
+}
+
+// Remove the URL from the store and invalidate the caches.
+func (a *AdminHandler) Remove(ctx context.Context, url string) error {
+	log.Printf("Removing URL %s from %s.", url, a.store.Name())
+	if err := a.store.RemoveURL(ctx, url); err != nil {
+		return err
+	}
+
+	return a.Invalidate(ctx, url)
+}
+
+// Remove the URL from each cache so the next lookup goes to the store.
+// Caches that can't remove individual URLs are skipped, they have to be
+// rebuilt to forget the URL.
+func (a *AdminHandler) Invalidate(ctx context.Context, url string) error {
+	for _, cache := range a.caches {
+		err := cache.RemoveURL(ctx, url)
+		if err == connectors.ErrRemoveUnsupported {
+			log.Printf("%s can't remove %s, it will be dropped on the next rebuild.", cache.Name(), url)
+		} else if err != nil {
+			return fmt.Errorf("Failed to invalidate %s in %s: %s", url, cache.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Initialize admin API.
+func (a *AdminHandler) Init() {
+	http.HandleFunc(ADMIN_ENDPOINT, a.adminHandler)
+}
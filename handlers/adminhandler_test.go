@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type TestStore struct {
+	db     map[string]string
+	closed bool
+}
+
+func NewTestStore() *TestStore {
+	return &TestStore{db: make(map[string]string)}
+}
+
+func (s *TestStore) ContainsURL(ctx context.Context, url string) (bool, error) {
+	_, found := s.db[url]
+	return found, nil
+}
+
+func (s *TestStore) AddURL(ctx context.Context, url string, category string) error {
+	if strings.Contains(url, "perm") {
+		return errors.New("Bad things happened!")
+	}
+	if _, found := s.db[url]; !found {
+		s.db[url] = category
+	}
+	return nil
+}
+
+func (s *TestStore) RemoveURL(ctx context.Context, url string) error {
+	if strings.Contains(url, "bloom") {
+		return connectors.ErrRemoveUnsupported
+	}
+	delete(s.db, url)
+	return nil
+}
+
+func (s *TestStore) Name() string {
+	return "Test"
+}
+
+func (s *TestStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func ServeAdmin(t *testing.T, h *AdminHandler, method string, key string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, ADMIN_ENDPOINT, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.adminHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestAdminInitAddsHandlers(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), nil, []string{"adminkey"}, filters.NewCanonical(nil))
+	h.Init()
+}
+
+func TestAdminAddsURL(t *testing.T) {
+	store := NewTestStore()
+	cache := NewTestStore()
+	cache.db["evil.com/"] = ""
+	h := NewAdminHandler(store, []URLCache{cache}, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	recorder := ServeAdmin(t, h, http.MethodPost, "adminkey", `{"urls": ["EVIL.com"], "category": "malware"}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The adminHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if store.db["evil.com/"] != "malware" {
+		t.Error("URL \"evil.com/\" was not added to the store with its category.")
+	}
+
+	if _, found := cache.db["evil.com/"]; found {
+		t.Error("URL \"evil.com/\" was not invalidated in the cache.")
+	}
+
+	response := &AdminResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatalf("Failed to decode the JSON response body: %s.", err)
+	}
+	if len(response.URLs) != 1 || response.URLs[0] != "evil.com/" {
+		t.Errorf("The response listed %v when [evil.com/] was expected.", response.URLs)
+	}
+}
+
+func TestAdminAddKeepsExistingCategory(t *testing.T) {
+	store := NewTestStore()
+	store.db["evil.com/"] = "phishing"
+	h := NewAdminHandler(store, nil, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	ServeAdmin(t, h, http.MethodPost, "adminkey", `{"urls": ["evil.com"], "category": "malware"}`)
+
+	if store.db["evil.com/"] != "phishing" {
+		t.Errorf("URL \"evil.com/\" had category %s when phishing was expected.", store.db["evil.com/"])
+	}
+}
+
+func TestAdminRemovesURL(t *testing.T) {
+	store := NewTestStore()
+	store.db["evil.com/"] = "malware"
+	cache := NewTestStore()
+	cache.db["evil.com/"] = "malware"
+	h := NewAdminHandler(store, []URLCache{cache}, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	recorder := ServeAdmin(t, h, http.MethodDelete, "adminkey", `{"urls": ["evil.com"]}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The adminHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if _, found := store.db["evil.com/"]; found {
+		t.Error("URL \"evil.com/\" was not removed from the store.")
+	}
+
+	if _, found := cache.db["evil.com/"]; found {
+		t.Error("URL \"evil.com/\" was not removed from the cache.")
+	}
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	store := NewTestStore()
+	h := NewAdminHandler(store, nil, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	for _, key := range []string{"", "merp"} {
+		recorder := ServeAdmin(t, h, http.MethodPost, key, `{"urls": ["evil.com"]}`)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("The adminHandler function returned %s when Unauthorized was expected.", http.StatusText(recorder.Code))
+		}
+	}
+
+	if len(store.db) != 0 {
+		t.Error("An unauthorized request wrote to the store.")
+	}
+}
+
+func TestAdminBadRequest(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), nil, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	recorder := ServeAdmin(t, h, http.MethodPost, "adminkey", `["evil.com"]`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("The adminHandler function returned %s when Bad Request was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestAdminMethodNotAllowed(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), nil, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	recorder := ServeAdmin(t, h, http.MethodGet, "adminkey", "")
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("The adminHandler function returned %s when Method Not Allowed was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestAdminStoreError(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), nil, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	recorder := ServeAdmin(t, h, http.MethodPost, "adminkey", `{"urls": ["evil.com/perm"]}`)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("The adminHandler function returned %s when Internal Server Error was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestAdminSkipsUnsupportedCache(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), []URLCache{NewTestStore()}, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	if err := h.Invalidate(context.Background(), "bloom.com/"); err != nil {
+		t.Errorf("An error was generated when none was expected: %s.", err)
+	}
+}
+
+func TestAdminClose(t *testing.T) {
+	store := NewTestStore()
+	cache := NewTestStore()
+	h := NewAdminHandler(store, []URLCache{cache}, []string{"adminkey"}, filters.NewCanonical(nil))
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !store.closed || !cache.closed {
+		t.Error("Closing the admin handler didn't close the store and the cache.")
+	}
+}
+
+func TestAdminWritesChainForm(t *testing.T) {
+	store := NewTestStore()
+	cache := NewTestStore()
+	cache.db["EVIL.com"] = ""
+	h := NewAdminHandler(store, []URLCache{cache}, []string{"adminkey"}, nil)
+
+	ServeAdmin(t, h, http.MethodPost, "adminkey", `{"urls": ["EVIL.com"]}`)
+
+	if _, found := store.db["EVIL.com"]; !found {
+		t.Error("URL \"EVIL.com\" wasn't written as sent for a chain that doesn't canonicalize.")
+	}
+
+	if _, found := cache.db["EVIL.com"]; found {
+		t.Error("URL \"EVIL.com\" was not invalidated in the cache.")
+	}
+}
+
+func TestAdminBodyTooLarge(t *testing.T) {
+	h := NewAdminHandler(NewTestStore(), nil, []string{"adminkey"}, nil)
+
+	body := `{"urls": ["` + strings.Repeat("a", ADMIN_MAX_BODY_BYTES) + `"]}`
+	recorder := ServeAdmin(t, h, http.MethodPost, "adminkey", body)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("An oversized admin request returned %d when 400 was expected.", recorder.Code)
+	}
+}
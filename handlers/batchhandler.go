@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const BATCH_ENDPOINT = FILTER_ENDPOINT + "batch"
+
+// Name of the handler in the request metrics.
+const BATCH_HANDLER = "batch"
+
+// Largest request body accepted for each URL in a batch.
+const BATCH_MAX_URL_BYTES = 8 * 1024
+
+// Checks many URLs against the filter chain in a single request.
+type BatchHandler struct {
+	// The chain of filters used by this handler to see if a URL is flagged.
+	filter filters.Filter
+
+	// Serves requests to the batch endpoint that aren't POSTs, which are
+	// lookups of a host named batch. Nil to reject them.
+	lookups http.Handler
+
+	// Maximum number of URLs accepted in one request.
+	maxURLs int
+
+	// Number of lookups run concurrently for each request.
+	workers int
+
+	// Blocking policies selected per request.
+	policies *Policies
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+
+	// Records how failed lookups should be answered, nil to leave them as errors.
+	failure *FailurePolicy
+}
+
+// The optional parts of a BatchHandler, any of which can be left nil.
+type BatchHandlerOptions struct {
+	// Serves requests to the batch endpoint that aren't POSTs, nil to
+	// reject them.
+	Lookups http.Handler
+
+	// Blocking policies selected per request, nil to block every flagged URL.
+	Policies *Policies
+
+	// Records every decision, nil if the audit log is disabled.
+	Auditor *audit.Logger
+
+	// Records how failed lookups should be answered, nil to leave them as errors.
+	Failure *FailurePolicy
+}
+
+// Create a BatchHandler instance with the underlying filters.Filter chain,
+// accepting up to maxURLs per request and checking them with workers
+// concurrent lookups.
+func NewBatchHandler(filter filters.Filter, maxURLs int, workers int, options BatchHandlerOptions) *BatchHandler {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &BatchHandler{
+		filter:   filter,
+		lookups:  options.Lookups,
+		maxURLs:  maxURLs,
+		workers:  workers,
+		policies: options.Policies,
+		auditor:  options.Auditor,
+		failure:  options.Failure,
+	}
+}
+
+// Handles batch URL filtering requests. The body is a JSON array of URLs,
+// the response is a JSON array of FilterResponses in the same order. The
+// policy is selected by API key or the urlfilter-policy query parameter
+// on the batch endpoint, and applies to every URL in the batch.
+func (b *BatchHandler) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && b.lookups != nil {
+		b.lookups.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy, _, err := b.policies.Select(r, r.URL.RequestURI())
+	if err != nil {
+		http.Error(w, err.Error(), PolicyErrorStatus(err))
+		return
+	}
+
+	urls := []string{}
+	body := http.MaxBytesReader(w, r.Body, int64(b.maxURLs)*BATCH_MAX_URL_BYTES)
+	if err := json.NewDecoder(body).Decode(&urls); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("A batch may contain at most %d URLs.", b.maxURLs), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, fmt.Sprintf("Request body must be a JSON array of URLs: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(urls) > b.maxURLs {
+		http.Error(w, fmt.Sprintf("A batch may contain at most %d URLs.", b.maxURLs), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	requestID := RequestID(r)
+	w.Header().Set(REQUEST_ID_HEADER, requestID)
+
+	responses := b.Lookup(r.Context(), urls, policy)
+	status := strconv.Itoa(http.StatusOK)
+	for _, response := range responses {
+		metrics.Requests.WithLabelValues(BATCH_HANDLER, response.Verdict, status).Inc()
+		if b.auditor != nil {
+			b.auditor.Log(NewAuditRecord(ClientIP(r), BATCH_HANDLER, response, requestID))
+		}
+	}
+
+	w.Header().Set("Content-Type", JSON_CONTENT_TYPE)
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		log.Printf("Failed to write the batch response: %s.", err)
+	}
+}
+
+// Check each URL against the filter chain. The URLs are split into one
+// chunk per worker, and each chunk is checked with a single LookupAll so
+// that each filter in the chain costs one round trip per chunk.
+func (b *BatchHandler) Lookup(ctx context.Context, urls []string, policy *Policy) []*FilterResponse {
+	responses := make([]*FilterResponse, len(urls))
+	chunkSize := (len(urls) + b.workers - 1) / b.workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(urls); start += chunkSize {
+		end := start + chunkSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+
+		wg.Add(1)
+		go func(start int, end int) {
+			defer wg.Done()
+			begin := time.Now()
+			verdicts, errs := b.filter.LookupAll(ctx, urls[start:end])
+			duration := time.Since(begin)
+			for i := start; i < end; i++ {
+				responses[i] = NewFilterResponse(urls[i], verdicts[i-start], errs[i-start], duration, policy)
+				if b.failure != nil {
+					b.failure.Apply(responses[i])
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	return responses
+}
+
+// Initialize batch URL filter API.
+func (b *BatchHandler) Init() {
+	http.HandleFunc(BATCH_ENDPOINT, b.batchHandler)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func ServeBatch(t *testing.T, h *BatchHandler, method string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, BATCH_ENDPOINT, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.batchHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestBatchInitAddsHandlers(t *testing.T) {
+	h := NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{})
+	h.Init()
+}
+
+func TestBatchHandlesURLs(t *testing.T) {
+	urls := []string{"www.google.ca", "www.facebook.ca", "www.bookface.ca", "www.faceface.ca", "cisco.com"}
+	verdicts := []string{VERDICT_ALLOWED, VERDICT_BLOCKED, VERDICT_ERROR, VERDICT_BLOCKED, VERDICT_ALLOWED}
+
+	body, _ := json.Marshal(urls)
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{}), http.MethodPost, string(body))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The batchHandler function %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	responses := []*FilterResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(&responses); err != nil {
+		t.Fatalf("Failed to decode the JSON response: %s", err)
+	}
+
+	if len(responses) != len(urls) {
+		t.Fatalf("%d verdicts were returned when %d were expected.", len(responses), len(urls))
+	}
+
+	for i, response := range responses {
+		if response.URL != urls[i] {
+			t.Errorf("Verdict %d was for %s when %s was expected.", i, response.URL, urls[i])
+		}
+
+		if response.Verdict != verdicts[i] {
+			t.Errorf("The verdict for %s was %s when %s was expected.", urls[i], response.Verdict, verdicts[i])
+		}
+	}
+}
+
+func TestBatchHandlesEmptyBatch(t *testing.T) {
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{}), http.MethodPost, "[]")
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The batchHandler function %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchRejectsTooManyURLs(t *testing.T) {
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 2, 2, BatchHandlerOptions{}), http.MethodPost, `["a.com", "b.com", "c.com"]`)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("The batchHandler function %s when Request Entity Too Large was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchRejectsBadBody(t *testing.T) {
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{}), http.MethodPost, `{"url": "a.com"}`)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("The batchHandler function %s when Bad Request was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchRejectsGet(t *testing.T) {
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{}), http.MethodGet, "")
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("The batchHandler function %s when Method Not Allowed was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchPassesGetToLookups(t *testing.T) {
+	lookups := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{})
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{Lookups: lookups}), http.MethodGet, "")
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The batchHandler function %s when OK was expected for a lookup of the batch host.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchRejectsLargeBody(t *testing.T) {
+	body := `["` + strings.Repeat("a", 2*BATCH_MAX_URL_BYTES) + `.com"]`
+	recorder := ServeBatch(t, NewBatchHandler(filters.NewFake(), 1, 2, BatchHandlerOptions{}), http.MethodPost, body)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("The batchHandler function %s when Request Entity Too Large was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestBatchChunksPerWorker(t *testing.T) {
+	f := &TestFilter{}
+	f.AddSecondaryFilter(filters.NewFake())
+	h := NewBatchHandler(f, 10, 1, BatchHandlerOptions{})
+
+	responses := h.Lookup(context.Background(), []string{"a.com", "b.com", "c.com"}, nil)
+
+	if f.called != 1 {
+		t.Errorf("The TestFilter LookupAll function was called %d time(s) when once was expected.", f.called)
+	}
+
+	if len(responses) != 3 {
+		t.Errorf("%d verdicts were returned when 3 were expected.", len(responses))
+	}
+}
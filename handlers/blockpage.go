@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/tmortimer/urlfilter/config"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const HTML_CONTENT_TYPE = "text/html; charset=utf-8"
+
+// Header holding the ID of a request, so a block page can be matched to
+// the log. An ID sent by the requester is kept if it's valid.
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// The longest request ID kept from a requester.
+const MAX_REQUEST_ID_LENGTH = 64
+
+// Query parameters added to the block page redirect.
+const (
+	REDIRECT_URL_PARAM        = "url"
+	REDIRECT_CATEGORY_PARAM   = "category"
+	REDIRECT_REQUEST_ID_PARAM = "requestId"
+)
+
+// The built-in block page template.
+const DEFAULT_BLOCK_PAGE = `<!DOCTYPE html>
+<html>
+<head><title>Blocked</title></head>
+<body>
+<h1>Blocked</h1>
+<p>Access to {{.URL}} has been blocked.</p>
+{{with .Category}}<p>Category: {{.}}</p>
+{{end}}<p>Request ID: {{.RequestID}}</p>
+</body>
+</html>
+`
+
+// Block page using the built-in template, without a redirect.
+var DefaultBlockPage = &BlockPage{template: template.Must(template.New("blockpage").Parse(DEFAULT_BLOCK_PAGE))}
+
+// Values available to block page templates.
+type BlockPageData struct {
+	// The URL that was blocked.
+	URL string
+
+	// The category of the entry that was found, if the list records one.
+	Category string
+
+	// The policy the decision was made under, if any.
+	Policy string
+
+	// The ID of the request.
+	RequestID string
+}
+
+// Renders the page returned for a blocked URL, or the redirect to an
+// external block page.
+type BlockPage struct {
+	// The template the page is rendered from.
+	template *template.Template
+
+	// Return the page to requesters that don't accept text/html.
+	always bool
+
+	// External block page blocked URLs are redirected to, nil if unset.
+	redirect *url.URL
+}
+
+// Create a BlockPage from the config, parsing the template file if one is
+// set.
+func NewBlockPage(cfg config.BlockPage) (*BlockPage, error) {
+	page := &BlockPage{template: DefaultBlockPage.template, always: cfg.HTML}
+
+	if cfg.Template != "" {
+		tmpl, err := template.ParseFiles(cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		page.template = tmpl
+	}
+
+	if cfg.RedirectURL != "" {
+		redirect, err := url.Parse(cfg.RedirectURL)
+		if err != nil {
+			return nil, err
+		}
+		page.redirect = redirect
+	}
+
+	return page, nil
+}
+
+// Return true if the blocked request should get the page or the redirect
+// rather than an empty 403.
+func (b *BlockPage) Handles(r *http.Request) bool {
+	return b.redirect != nil || b.always || AcceptsHTML(r)
+}
+
+// Status the blocked request is answered with.
+func (b *BlockPage) Status() int {
+	if b.redirect != nil {
+		return http.StatusFound
+	}
+	return http.StatusForbidden
+}
+
+// Render the page for the data.
+func (b *BlockPage) Render(data *BlockPageData) (string, error) {
+	page := &bytes.Buffer{}
+	if err := b.template.Execute(page, data); err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
+
+// Return the external block page URL with the details of the blocked
+// request added to its query.
+func (b *BlockPage) RedirectURL(data *BlockPageData) string {
+	redirect := *b.redirect
+	query := redirect.Query()
+	query.Set(REDIRECT_URL_PARAM, data.URL)
+	if data.Category != "" {
+		query.Set(REDIRECT_CATEGORY_PARAM, data.Category)
+	}
+	query.Set(REDIRECT_REQUEST_ID_PARAM, data.RequestID)
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+// Answer the blocked request with the redirect or the page. If the page
+// fails to render the requester gets an empty 403.
+func (b *BlockPage) Write(w http.ResponseWriter, data *BlockPageData) {
+	if b.redirect != nil {
+		w.Header().Set("Location", b.RedirectURL(data))
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	page, err := b.Render(data)
+	if err != nil {
+		log.Printf("Failed to render the block page for %s: %s.", data.URL, err)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", HTML_CONTENT_TYPE)
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(page))
+}
+
+// Build the block page data from the result of a lookup.
+func NewBlockPageData(response *FilterResponse, requestID string) *BlockPageData {
+	return &BlockPageData{
+		URL:       response.URL,
+		Category:  response.Category,
+		Policy:    response.Policy,
+		RequestID: requestID,
+	}
+}
+
+// Return the ID sent by the requester, or a new random one if it didn't
+// send a valid one.
+func RequestID(r *http.Request) string {
+	return CheckRequestID(r.Header.Get(REQUEST_ID_HEADER))
+}
+
+// Return the ID if it's valid, otherwise a new one.
+func CheckRequestID(id string) string {
+	if ValidRequestID(id) {
+		return id
+	}
+	return NewRequestID()
+}
+
+// Return true if the ID is safe to copy into logs, headers and block pages.
+// It must be 1 to MAX_REQUEST_ID_LENGTH letters, digits, dots, dashes or
+// underscores.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Return a new random request ID.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Return true if the requester accepts an HTML response body.
+func AcceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func ServeBlockPage(t *testing.T, cfg config.BlockPage, target string, accept string) *httptest.ResponseRecorder {
+	blockPage, err := NewBlockPage(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{BlockPage: blockPage})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+target, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(h.filterHandler).ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestBlockPageAcceptHTML(t *testing.T) {
+	recorder := ServeBlockPage(t, config.NewBlockPage(), "www.facebook.com/a", "text/html,application/xhtml+xml")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("URL \"www.facebook.com/a\" returned %d when 403 was expected.", recorder.Code)
+	}
+
+	if recorder.Header().Get("Content-Type") != HTML_CONTENT_TYPE {
+		t.Errorf("The block page was returned as \"%s\".", recorder.Header().Get("Content-Type"))
+	}
+
+	requestID := recorder.Header().Get(REQUEST_ID_HEADER)
+	if requestID == "" {
+		t.Error("The block page was returned without a request ID.")
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{"www.facebook.com/a", "Category: " + filters.FAKE_CATEGORY, "Request ID: " + requestID} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("The block page did not contain \"%s\", got \"%s\".", expected, body)
+		}
+	}
+}
+
+func TestBlockPageEscapesURL(t *testing.T) {
+	page, err := DefaultBlockPage.Render(&BlockPageData{URL: "www.facebook.com/<b>", RequestID: "1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !strings.Contains(page, "www.facebook.com/&lt;b&gt;") {
+		t.Errorf("The block page did not escape the URL, got \"%s\".", page)
+	}
+}
+
+func TestBlockPageNotRequested(t *testing.T) {
+	recorder := ServeBlockPage(t, config.NewBlockPage(), "www.facebook.com", "")
+
+	if recorder.Code != http.StatusForbidden || recorder.Body.Len() != 0 {
+		t.Errorf("URL \"www.facebook.com\" returned %d with body \"%s\" when an empty 403 was expected.", recorder.Code, recorder.Body.String())
+	}
+
+	// JSON wins if the requester accepts both.
+	recorder = ServeBlockPage(t, config.NewBlockPage(), "www.facebook.com", "text/html, "+JSON_CONTENT_TYPE)
+	if recorder.Header().Get("Content-Type") != JSON_CONTENT_TYPE {
+		t.Errorf("URL \"www.facebook.com\" was returned as \"%s\" when JSON was requested.", recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestBlockPageAlwaysHTML(t *testing.T) {
+	cfg := config.NewBlockPage()
+	cfg.HTML = true
+	recorder := ServeBlockPage(t, cfg, "www.facebook.com", "")
+
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), "www.facebook.com") {
+		t.Errorf("URL \"www.facebook.com\" returned %d with body \"%s\" when the block page was expected.", recorder.Code, recorder.Body.String())
+	}
+
+	// Allowed URLs are unaffected.
+	recorder = ServeBlockPage(t, cfg, "www.google.com", "")
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("URL \"www.google.com\" returned %d with body \"%s\" when an empty 200 was expected.", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestBlockPageTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.html")
+	if err := os.WriteFile(path, []byte("{{.URL}} {{.Category}} {{.RequestID}}"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cfg := config.NewBlockPage()
+	cfg.Template = path
+	recorder := ServeBlockPage(t, cfg, "www.facebook.com", "text/html")
+
+	expected := "www.facebook.com " + filters.FAKE_CATEGORY + " " + recorder.Header().Get(REQUEST_ID_HEADER)
+	if recorder.Body.String() != expected {
+		t.Errorf("The block page was \"%s\" when \"%s\" was expected.", recorder.Body.String(), expected)
+	}
+
+	cfg.Template = filepath.Join(t.TempDir(), "missing.html")
+	if _, err := NewBlockPage(cfg); err == nil {
+		t.Error("A missing block page template didn't fail.")
+	}
+}
+
+func TestBlockPageRedirect(t *testing.T) {
+	cfg := config.NewBlockPage()
+	cfg.RedirectURL = "https://blocked.example.com/page?lang=en"
+	recorder := ServeBlockPage(t, cfg, "www.facebook.com", "")
+
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("URL \"www.facebook.com\" returned %d when 302 was expected.", recorder.Code)
+	}
+
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	query := location.Query()
+	if location.Host != "blocked.example.com" || query.Get("lang") != "en" ||
+		query.Get(REDIRECT_URL_PARAM) != "www.facebook.com" ||
+		query.Get(REDIRECT_CATEGORY_PARAM) != filters.FAKE_CATEGORY ||
+		query.Get(REDIRECT_REQUEST_ID_PARAM) != recorder.Header().Get(REQUEST_ID_HEADER) {
+		t.Errorf("URL \"www.facebook.com\" was redirected to \"%s\".", location)
+	}
+}
+
+func TestRequestIDKept(t *testing.T) {
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.google.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if id := RequestID(req); len(id) != 16 {
+		t.Errorf("A new request ID was \"%s\" when 16 hex digits were expected.", id)
+	}
+
+	req.Header.Set(REQUEST_ID_HEADER, "abc123")
+	if id := RequestID(req); id != "abc123" {
+		t.Errorf("The request ID was \"%s\" when the requester's \"abc123\" was expected.", id)
+	}
+}
+
+func TestRequestIDReplacedIfInvalid(t *testing.T) {
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.google.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, invalid := range []string{"<script>", "abc 123", "abc\n123", strings.Repeat("a", MAX_REQUEST_ID_LENGTH+1)} {
+		req.Header.Set(REQUEST_ID_HEADER, invalid)
+		if id := RequestID(req); len(id) != 16 {
+			t.Errorf("The invalid request ID \"%s\" was replaced with \"%s\" when 16 hex digits were expected.", invalid, id)
+		}
+	}
+}
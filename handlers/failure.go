@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"strconv"
+)
+
+// How a lookup that failed without finding the URL is answered. FAIL_ERROR
+// reports the error with a 500, as if there were no failure policy.
+const (
+	FAIL_OPEN        = "open"
+	FAIL_CLOSED      = "closed"
+	FAIL_UNAVAILABLE = "unavailable"
+	FAIL_ERROR       = ""
+)
+
+// Header holding the failure mode a failed lookup was answered with.
+const FAILURE_HEADER = "X-URLFilter-Failure"
+
+// Decides how failed lookups are answered, optionally depending on the
+// filter that failed.
+type FailurePolicy struct {
+	// Mode used unless the filter that failed has its own.
+	mode string
+
+	// Seconds in the Retry-After header of unavailable responses.
+	retryAfter int
+
+	// Modes by the name the filter that failed reports in its Verdicts.
+	filters map[string]string
+}
+
+// Create a FailurePolicy from the config. Returns nil if no failure modes
+// are configured, so failed lookups are only reported as errors.
+func NewFailurePolicy(cfg *config.Config) *FailurePolicy {
+	if cfg.Failure.Mode == FAIL_ERROR && len(cfg.Failure.Filters) == 0 {
+		return nil
+	}
+
+	f := &FailurePolicy{
+		mode:       cfg.Failure.Mode,
+		retryAfter: cfg.Failure.RetryAfter,
+		filters:    make(map[string]string),
+	}
+
+	for name, mode := range cfg.Failure.Filters {
+		f.filters[filters.FilterName(name, cfg)] = mode
+	}
+	return f
+}
+
+// Return the mode a lookup that failed in the named filter is answered with.
+func (f *FailurePolicy) Mode(filter string) string {
+	if mode, ok := f.filters[filter]; ok {
+		return mode
+	}
+	return f.mode
+}
+
+// Record the failure mode on the response of a failed lookup, and return
+// the status it's answered with. Other responses are left alone.
+func (f *FailurePolicy) Apply(response *FilterResponse) int {
+	if response.Verdict != VERDICT_ERROR {
+		return http.StatusOK
+	}
+
+	response.Failure = f.Mode(response.Filter)
+	return FailureStatus(response.Failure)
+}
+
+// Set the headers describing how a failed lookup was answered. Errors
+// reported as such get none.
+func (f *FailurePolicy) WriteHeaders(w http.ResponseWriter, mode string) {
+	if mode == FAIL_ERROR {
+		return
+	}
+
+	w.Header().Set(FAILURE_HEADER, mode)
+	if mode == FAIL_UNAVAILABLE {
+		w.Header().Set("Retry-After", strconv.Itoa(f.retryAfter))
+	}
+}
+
+// Return the status a failure mode is answered with.
+func FailureStatus(mode string) int {
+	switch mode {
+	case FAIL_OPEN:
+		return http.StatusOK
+	case FAIL_CLOSED:
+		return http.StatusForbidden
+	case FAIL_ERROR:
+		return http.StatusInternalServerError
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Return a FailurePolicy for the failure config.
+func NewTestFailurePolicy(failure config.Failure) *FailurePolicy {
+	cfg := config.NewConfig()
+	cfg.Failure = failure
+	return NewFailurePolicy(cfg)
+}
+
+func ServeFailure(t *testing.T, cfg config.Failure, url string) (*httptest.ResponseRecorder, *FilterResponse) {
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{Failure: NewTestFailurePolicy(cfg)})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+url, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Accept", JSON_CONTENT_TYPE)
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(h.filterHandler).ServeHTTP(recorder, req)
+
+	response := &FilterResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatalf("Failed to decode the JSON response body: %s.", err)
+	}
+
+	return recorder, response
+}
+
+func TestFailureModes(t *testing.T) {
+	modes := map[string]int{
+		FAIL_OPEN:        http.StatusOK,
+		FAIL_CLOSED:      http.StatusForbidden,
+		FAIL_UNAVAILABLE: http.StatusServiceUnavailable,
+	}
+
+	for mode, status := range modes {
+		cfg := config.NewFailure()
+		cfg.Mode = mode
+		recorder, response := ServeFailure(t, cfg, "www.bookface.ca")
+
+		if recorder.Code != status {
+			t.Errorf("URL \"www.bookface.ca\" returned %d when failing %s when %d was expected.", recorder.Code, mode, status)
+		}
+
+		if response.Verdict != VERDICT_ERROR || response.Failure != mode {
+			t.Errorf("URL \"www.bookface.ca\" had verdict %s and failure %s when error and %s were expected.", response.Verdict, response.Failure, mode)
+		}
+
+		if recorder.Header().Get(FAILURE_HEADER) != mode {
+			t.Errorf("The failure header was %s when %s was expected.", recorder.Header().Get(FAILURE_HEADER), mode)
+		}
+	}
+}
+
+func TestFailureRetryAfter(t *testing.T) {
+	cfg := config.NewFailure()
+	cfg.Mode = FAIL_UNAVAILABLE
+	cfg.RetryAfter = 30
+	recorder, _ := ServeFailure(t, cfg, "www.bookface.ca")
+
+	if recorder.Header().Get("Retry-After") != "30" {
+		t.Errorf("The Retry-After header was \"%s\" when 30 was expected.", recorder.Header().Get("Retry-After"))
+	}
+
+	cfg.Mode = FAIL_OPEN
+	recorder, _ = ServeFailure(t, cfg, "www.bookface.ca")
+
+	if recorder.Header().Get("Retry-After") != "" {
+		t.Errorf("The Retry-After header was set when failing open.")
+	}
+}
+
+func TestFailureFilterOverride(t *testing.T) {
+	cfg := config.NewFailure()
+	cfg.Filters = map[string]string{"fake": FAIL_OPEN, "mysql": FAIL_CLOSED}
+	recorder, response := ServeFailure(t, cfg, "www.bookface.ca")
+
+	if recorder.Code != http.StatusOK || response.Failure != FAIL_OPEN {
+		t.Errorf("URL \"www.bookface.ca\" returned %d failing %s when the Fake filter's override of open was expected.", recorder.Code, response.Failure)
+	}
+}
+
+func TestFailureDefaultIsError(t *testing.T) {
+	if NewFailurePolicy(config.NewConfig()) != nil {
+		t.Fatal("A FailurePolicy was created when no failure modes were configured.")
+	}
+
+	cfg := config.NewFailure()
+	cfg.Filters = map[string]string{"mysql": FAIL_OPEN}
+	recorder, response := ServeFailure(t, cfg, "www.bookface.ca")
+
+	if recorder.Code != http.StatusInternalServerError || response.Failure != FAIL_ERROR {
+		t.Errorf("URL \"www.bookface.ca\" returned %d failing %s when an error was expected.", recorder.Code, response.Failure)
+	}
+
+	if recorder.Header().Get(FAILURE_HEADER) != "" || recorder.Header().Get("Retry-After") != "" {
+		t.Error("The failure headers were set for a failed lookup reported as an error.")
+	}
+}
+
+func TestFailureClosedNoBlockPage(t *testing.T) {
+	cfg := config.NewFailure()
+	cfg.Mode = FAIL_CLOSED
+	blockPage, err := NewBlockPage(config.BlockPage{HTML: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{BlockPage: blockPage, Failure: NewTestFailurePolicy(cfg)})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.bookface.ca", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(h.filterHandler).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusForbidden || recorder.Body.Len() != 0 {
+		t.Errorf("URL \"www.bookface.ca\" returned %d with body \"%s\" when failing closed, when a bare 403 was expected.", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestFailureFoundWithError(t *testing.T) {
+	cfg := config.NewFailure()
+	cfg.Mode = FAIL_OPEN
+	recorder, response := ServeFailure(t, cfg, "www.faceface.ca")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("URL \"www.faceface.ca\" returned %d when Forbidden was expected.", recorder.Code)
+	}
+
+	if response.Failure != "" || recorder.Header().Get(FAILURE_HEADER) != "" {
+		t.Errorf("URL \"www.faceface.ca\" was found but was answered as failing %s.", response.Failure)
+	}
+}
+
+func TestFailureBatch(t *testing.T) {
+	cfg := config.NewFailure()
+	cfg.Mode = FAIL_CLOSED
+	h := NewBatchHandler(filters.NewFake(), 10, 2, BatchHandlerOptions{Failure: NewTestFailurePolicy(cfg)})
+
+	recorder := ServeBatch(t, h, http.MethodPost, `["www.google.ca", "www.bookface.ca"]`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The batch returned %d when OK was expected.", recorder.Code)
+	}
+
+	responses := []*FilterResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(&responses); err != nil {
+		t.Fatalf("Failed to decode the JSON response body: %s.", err)
+	}
+
+	if responses[0].Failure != "" {
+		t.Errorf("URL \"www.google.ca\" was answered as failing %s.", responses[0].Failure)
+	}
+
+	if responses[1].Failure != FAIL_CLOSED {
+		t.Errorf("URL \"www.bookface.ca\" was answered as failing %s when closed was expected.", responses[1].Failure)
+	}
+}
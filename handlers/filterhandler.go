@@ -1,42 +1,292 @@
 package handlers
 
 import (
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/audit"
 	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/metrics"
+	"github.com/tmortimer/urlfilter/notify"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const FILTER_ENDPOINT = "/urlinfo/1/"
 
+// Name of the handler in the request metrics.
+const FILTER_HANDLER = "filter"
+
+const JSON_CONTENT_TYPE = "application/json"
+
+// Verdicts reported in the JSON response body.
+const (
+	VERDICT_ALLOWED = "allowed"
+	VERDICT_BLOCKED = "blocked"
+	VERDICT_ERROR   = "error"
+)
+
+// Verdict recorded in the request metrics for requests rejected before a lookup.
+const VERDICT_NONE = "none"
+
 // Holds a filter which the handler uses to check for banned URLs.
 type FilterHandler struct {
 	// The chain of filters used by this handler to see if a URL is flagged.
 	filter filters.Filter
+
+	// Blocking policies selected per request.
+	policies *Policies
+
+	// Page returned for blocked URLs, nil for an empty 403.
+	blockPage *BlockPage
+
+	// Notified of blocked URLs, nil if no webhooks are configured.
+	notifier *notify.Notifier
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+
+	// Decides how failed lookups are answered, nil for a 500.
+	failure *FailurePolicy
+}
+
+// JSON response body, only returned if the requester asks for it
+// with the "Accept: application/json" header.
+type FilterResponse struct {
+	// One of allowed, blocked or error.
+	Verdict string `json:"verdict"`
+
+	// The URL that was checked by the filter chain.
+	URL string `json:"url"`
+
+	// The filter in the chain that made the decision.
+	Filter string `json:"filter,omitempty"`
+
+	// The stored entry that was found, if it isn't the URL itself.
+	Matched string `json:"matched,omitempty"`
+
+	// The category of the entry that was found, if the list records one.
+	Category string `json:"category,omitempty"`
+
+	// The policy the decision was made under, if any.
+	Policy string `json:"policy,omitempty"`
+
+	// The list that made the decision.
+	Source string `json:"source,omitempty"`
+
+	// True if the decision came from a cache rather than the authoritative list.
+	Cached bool `json:"cached"`
+
+	// How long the decision is expected to hold in seconds, 0 if unknown.
+	TTLSeconds float64 `json:"ttlSeconds"`
+
+	// The error text if an error was generated during the lookup.
+	Error string `json:"error,omitempty"`
+
+	// How the failed lookup was answered, one of open, closed or unavailable.
+	Failure string `json:"failure,omitempty"`
+
+	// Time spent checking the filter chain in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+}
+
+// The optional parts of a FilterHandler, any of which can be left nil.
+type FilterHandlerOptions struct {
+	// Blocking policies selected per request, nil to block every flagged URL.
+	Policies *Policies
+
+	// Page returned for blocked URLs, nil for an empty 403.
+	BlockPage *BlockPage
+
+	// Notified of blocked URLs, nil if no webhooks are configured.
+	Notifier *notify.Notifier
+
+	// Records every decision, nil if the audit log is disabled.
+	Auditor *audit.Logger
+
+	// Decides how failed lookups are answered, nil for a 500.
+	Failure *FailurePolicy
 }
 
 // Create a FilterHandler instance with the underlying filters.Filter chain.
-func NewFilterHandler(filter filters.Filter) *FilterHandler {
-	return &FilterHandler{filter: filter}
+func NewFilterHandler(filter filters.Filter, options FilterHandlerOptions) *FilterHandler {
+	return &FilterHandler{
+		filter:    filter,
+		policies:  options.Policies,
+		blockPage: options.BlockPage,
+		notifier:  options.Notifier,
+		auditor:   options.Auditor,
+		failure:   options.Failure,
+	}
 }
 
 // Handles URL filtering requests.
 func (f *FilterHandler) filterHandler(w http.ResponseWriter, r *http.Request) {
 	url := r.URL.RequestURI()[len(FILTER_ENDPOINT):]
-	found, err := f.filter.ContainsURL(url)
+	policy, url, err := f.policies.Select(r, url)
+	if err != nil {
+		status := PolicyErrorStatus(err)
+		metrics.Requests.WithLabelValues(FILTER_HANDLER, VERDICT_NONE, strconv.Itoa(status)).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	requestID := RequestID(r)
+	w.Header().Set(REQUEST_ID_HEADER, requestID)
+
+	start := time.Now()
+	verdict, err := f.filter.Lookup(r.Context(), url)
+	response := NewFilterResponse(url, verdict, err, time.Since(start), policy)
+
+	if response.Category != "" {
+		w.Header().Set(CATEGORY_HEADER, response.Category)
+	}
 
 	// If we generated an error but the URL was found we can still act on
 	// that information. If an error was generated but the URL was not found
-	// we have to let the requester know we're unable to answer their request.
-	if err != nil && !found {
-		//TOM needs something more usefule here.
-		w.WriteHeader(http.StatusInternalServerError)
-	} else if found {
+	// we have to let the requester know we're unable to answer their request,
+	// or answer it the way the failure policy says to.
+	status := http.StatusOK
+	if response.Verdict == VERDICT_ERROR && f.failure != nil {
+		status = f.failure.Apply(response)
+		f.failure.WriteHeaders(w, response.Failure)
+	} else if response.Verdict == VERDICT_ERROR {
+		status = http.StatusInternalServerError
+	} else if response.Verdict == VERDICT_BLOCKED {
 		// Return negative response, URL is banned.
-		w.WriteHeader(http.StatusForbidden)
-	} else {
-		log.Printf("URL %s not found in the filter.", url)
-		// Return positive response.
+		status = http.StatusForbidden
 	}
+	// Otherwise return positive response.
+
+	if f.auditor != nil {
+		f.auditor.Log(NewAuditRecord(ClientIP(r), FILTER_HANDLER, response, requestID))
+	}
+
+	if response.Verdict == VERDICT_BLOCKED && f.notifier != nil {
+		f.notifier.Notify(NewEvent(r, response, requestID))
+	}
+
+	// Browsers get the block page, or are sent to an external one. Failed
+	// lookups answered with a 403 aren't blocked URLs, so they don't.
+	page := response.Verdict == VERDICT_BLOCKED && f.blockPage != nil && !WantsJSON(r) && f.blockPage.Handles(r)
+	if page {
+		status = f.blockPage.Status()
+	}
+	metrics.Requests.WithLabelValues(FILTER_HANDLER, response.Verdict, strconv.Itoa(status)).Inc()
+
+	if page {
+		f.blockPage.Write(w, NewBlockPageData(response, requestID))
+	} else if WantsJSON(r) {
+		w.Header().Set("Content-Type", JSON_CONTENT_TYPE)
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Failed to write the response for %s: %s.", url, err)
+		}
+	} else if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+}
+
+// Build the JSON response body from the result of a lookup. A flagged URL
+// is only reported as blocked if the policy blocks its category.
+func NewFilterResponse(url string, verdict *filters.Verdict, err error, duration time.Duration, policy *Policy) *FilterResponse {
+	response := &FilterResponse{
+		Verdict:    VERDICT_ALLOWED,
+		URL:        url,
+		DurationMs: float64(duration) / float64(time.Millisecond),
+	}
+
+	if policy != nil {
+		response.Policy = policy.Name
+	}
+
+	found := false
+	if verdict != nil {
+		found = verdict.Found
+		response.URL = verdict.URL
+		response.Filter = verdict.Filter
+		response.Matched = verdict.Matched
+		response.Category = verdict.Category
+		response.Source = verdict.Source
+		response.Cached = verdict.Cached
+		response.TTLSeconds = verdict.TTL.Seconds()
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	if found {
+		// Flagged URLs in a category the policy doesn't block are allowed.
+		if policy.Blocks(verdict) {
+			response.Verdict = VERDICT_BLOCKED
+		}
+	} else if err != nil {
+		response.Verdict = VERDICT_ERROR
+	}
+
+	return response
+}
+
+// Build the webhook event for a blocked URL.
+func NewEvent(r *http.Request, response *FilterResponse, requestID string) *notify.Event {
+	return &notify.Event{
+		URL:       response.URL,
+		ClientIP:  ClientIP(r),
+		Filter:    response.Filter,
+		Matched:   response.Matched,
+		Category:  response.Category,
+		Policy:    response.Policy,
+		RequestID: requestID,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// Build the audit record of a lookup made by the handler for the client.
+// Front ends without request IDs leave requestID empty.
+func NewAuditRecord(client string, handler string, response *FilterResponse, requestID string) *audit.Record {
+	return &audit.Record{
+		Time:       time.Now().UTC(),
+		RequestID:  requestID,
+		Client:     client,
+		Handler:    handler,
+		URL:        response.URL,
+		Verdict:    response.Verdict,
+		Filter:     response.Filter,
+		Matched:    response.Matched,
+		Category:   response.Category,
+		Policy:     response.Policy,
+		Cached:     response.Cached,
+		Error:      response.Error,
+		Failure:    response.Failure,
+		DurationMs: response.DurationMs,
+	}
+}
+
+// Return the address of the requester, without the port.
+func ClientIP(r *http.Request) string {
+	return HostIP(r.RemoteAddr)
+}
+
+// Return the host of a host:port address, or the address if it has no port.
+func HostIP(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// Serve a URL filtering request.
+func (f *FilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.filterHandler(w, r)
+}
+
+// Return true if the requester has asked for a JSON response body.
+func WantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), JSON_CONTENT_TYPE)
 }
 
 // Initialize URL filter API.
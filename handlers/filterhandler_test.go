@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/audit"
 	"github.com/tmortimer/urlfilter/filters"
 	"net/http"
 	"net/http/httptest"
@@ -17,16 +21,40 @@ func (f *TestFilter) AddSecondaryFilter(filter filters.Filter) error {
 	return nil
 }
 
-func (f *TestFilter) ContainsURL(url string) (bool, error) {
+func (f *TestFilter) ContainsURL(ctx context.Context, url string) (bool, error) {
 	f.called++
 
-	return f.next.ContainsURL(url)
+	return f.next.ContainsURL(ctx, url)
+}
+
+func (f *TestFilter) Lookup(ctx context.Context, url string) (*filters.Verdict, error) {
+	f.called++
+
+	return f.next.Lookup(ctx, url)
+}
+
+func (f *TestFilter) LookupAll(ctx context.Context, urls []string) ([]*filters.Verdict, []error) {
+	f.called++
+
+	return f.next.LookupAll(ctx, urls)
+}
+
+func (f *TestFilter) Status(ctx context.Context) []*filters.Status {
+	f.called++
+
+	return f.next.Status(ctx)
+}
+
+func (f *TestFilter) Close() error {
+	f.called++
+
+	return f.next.Close()
 }
 
 func TestInitAddsHandlers(t *testing.T) {
 	f := &TestFilter{}
 	f.AddSecondaryFilter(filters.NewFake())
-	h := NewFilterHandler(f)
+	h := NewFilterHandler(f, FilterHandlerOptions{})
 
 	// So it doesn't fail, but how can I (directly) test that it actually registered...
 	// Not going to spend the time digging into these weeds right now.
@@ -38,7 +66,7 @@ func TestHandlesSafeURL(t *testing.T) {
 	// This page was useful for info on how to test http handlers in Go.
 	f := &TestFilter{}
 	f.AddSecondaryFilter(filters.NewFake())
-	h := NewFilterHandler(f)
+	h := NewFilterHandler(f, FilterHandlerOptions{})
 
 	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.google.ca", nil)
 	if err != nil {
@@ -64,7 +92,7 @@ func TestHandlesBlockedURL(t *testing.T) {
 	// This page was useful for info on how to test http handlers in Go.
 	f := &TestFilter{}
 	f.AddSecondaryFilter(filters.NewFake())
-	h := NewFilterHandler(f)
+	h := NewFilterHandler(f, FilterHandlerOptions{})
 
 	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.facebook.ca", nil)
 	if err != nil {
@@ -90,7 +118,7 @@ func TestHandlesError(t *testing.T) {
 	// This page was useful for info on how to test http handlers in Go.
 	f := &TestFilter{}
 	f.AddSecondaryFilter(filters.NewFake())
-	h := NewFilterHandler(f)
+	h := NewFilterHandler(f, FilterHandlerOptions{})
 
 	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.bookface.ca", nil)
 	if err != nil {
@@ -116,7 +144,7 @@ func TestHandlesErrorURLFound(t *testing.T) {
 	// This page was useful for info on how to test http handlers in Go.
 	f := &TestFilter{}
 	f.AddSecondaryFilter(filters.NewFake())
-	h := NewFilterHandler(f)
+	h := NewFilterHandler(f, FilterHandlerOptions{})
 
 	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.faceface.ca", nil)
 	if err != nil {
@@ -136,3 +164,191 @@ func TestHandlesErrorURLFound(t *testing.T) {
 		t.Errorf("The filterHandler function %s when Forbidden was expected.", http.StatusText(recorder.Code))
 	}
 }
+
+func ServeJSON(t *testing.T, url string) (*httptest.ResponseRecorder, *FilterResponse) {
+	f := &TestFilter{}
+	f.AddSecondaryFilter(filters.NewFake())
+	h := NewFilterHandler(f, FilterHandlerOptions{})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", JSON_CONTENT_TYPE)
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.filterHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if f.called != 1 {
+		t.Errorf("The TestFilter Lookup function was called %d time(s).", f.called)
+	}
+
+	if recorder.Header().Get("Content-Type") != JSON_CONTENT_TYPE {
+		t.Errorf("The Content-Type was %s when %s was expected.", recorder.Header().Get("Content-Type"), JSON_CONTENT_TYPE)
+	}
+
+	response := &FilterResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatalf("Failed to decode the JSON response: %s", err)
+	}
+
+	return recorder, response
+}
+
+func TestHandlesSafeURLJSON(t *testing.T) {
+	url := "www.google.ca/search?q=cars"
+	recorder, response := ServeJSON(t, url)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The filterHandler function %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Verdict != VERDICT_ALLOWED {
+		t.Errorf("The verdict was %s when %s was expected.", response.Verdict, VERDICT_ALLOWED)
+	}
+
+	if response.URL != url {
+		t.Errorf("The URL was %s when %s was expected.", response.URL, url)
+	}
+
+	if response.Filter != "Fake" {
+		t.Errorf("The deciding filter was %s when Fake was expected.", response.Filter)
+	}
+
+	if response.Source != "fake" {
+		t.Errorf("The source was %s when fake was expected.", response.Source)
+	}
+
+	if response.Cached {
+		t.Error("The verdict was reported as a cache hit when it was not.")
+	}
+
+	if response.Error != "" {
+		t.Errorf("An error was reported when none was expected: %s.", response.Error)
+	}
+}
+
+func TestHandlesBlockedURLJSON(t *testing.T) {
+	recorder, response := ServeJSON(t, "www.facebook.ca")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("The filterHandler function %s when Forbidden was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Verdict != VERDICT_BLOCKED {
+		t.Errorf("The verdict was %s when %s was expected.", response.Verdict, VERDICT_BLOCKED)
+	}
+}
+
+func TestHandlesErrorJSON(t *testing.T) {
+	recorder, response := ServeJSON(t, "www.bookface.ca")
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("The filterHandler function %s when Internal Server Error was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Verdict != VERDICT_ERROR {
+		t.Errorf("The verdict was %s when %s was expected.", response.Verdict, VERDICT_ERROR)
+	}
+
+	if response.Error == "" {
+		t.Error("The error text was not reported when it was expected.")
+	}
+}
+
+func TestHandlesErrorURLFoundJSON(t *testing.T) {
+	recorder, response := ServeJSON(t, "www.faceface.ca")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("The filterHandler function %s when Forbidden was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Verdict != VERDICT_BLOCKED {
+		t.Errorf("The verdict was %s when %s was expected.", response.Verdict, VERDICT_BLOCKED)
+	}
+
+	if response.Error == "" {
+		t.Error("The error text was not reported when it was expected.")
+	}
+}
+
+func TestHandlesSafeURLNoBody(t *testing.T) {
+	f := &TestFilter{}
+	f.AddSecondaryFilter(filters.NewFake())
+	h := NewFilterHandler(f, FilterHandlerOptions{})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.google.ca", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.filterHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Body.Len() != 0 {
+		t.Errorf("A response body was written when the requester did not ask for JSON: %s.", recorder.Body.String())
+	}
+}
+
+func TestHandlesBlockedEvent(t *testing.T) {
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.facebook.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.RemoteAddr = "10.0.0.1:54321"
+
+	response := &FilterResponse{Verdict: VERDICT_BLOCKED, URL: "www.facebook.com", Filter: "Fake", Category: filters.FAKE_CATEGORY}
+	event := NewEvent(req, response, "abc123")
+
+	if event.URL != "www.facebook.com" || event.ClientIP != "10.0.0.1" || event.Filter != "Fake" ||
+		event.Category != filters.FAKE_CATEGORY || event.RequestID != "abc123" || event.Timestamp.IsZero() {
+		t.Errorf("The blocked URL event was %v.", event)
+	}
+}
+
+func TestHandlesAudit(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{Auditor: audit.NewLogger([]audit.Sink{audit.NewWriterSink(out)}, 1)})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.facebook.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.RemoteAddr = "10.0.0.1:54321"
+	req.Header.Set(REQUEST_ID_HEADER, "abc123")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(h.filterHandler).ServeHTTP(recorder, req)
+
+	record := &audit.Record{}
+	if err := json.Unmarshal(out.Bytes(), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com" || record.Verdict != VERDICT_BLOCKED || record.Client != "10.0.0.1" ||
+		record.RequestID != "abc123" || record.Handler != FILTER_HANDLER || record.Category != filters.FAKE_CATEGORY {
+		t.Errorf("The lookup was audited as \"%s\".", out.String())
+	}
+}
+
+func TestHandlesCallerGone(t *testing.T) {
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", FILTER_ENDPOINT+"www.facebook.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(h.filterHandler).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("URL \"www.facebook.com\" returned %d after the caller went away when 500 was expected.", recorder.Code)
+	}
+}
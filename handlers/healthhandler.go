@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/filters"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Returns 200 as long as the process is alive.
+const HEALTH_ENDPOINT = "/healthz"
+
+// Returns 200 if every required filter in the chain is ready, 503 otherwise.
+const READY_ENDPOINT = "/readyz"
+
+// How long the readiness endpoint waits for the filters to answer. A filter
+// that hasn't answered by then isn't ready.
+const READY_TIMEOUT = 2 * time.Second
+
+// Reports the health of the worker and its filter chain, for load balancers.
+type HealthHandler struct {
+	// The chain of filters checked for readiness.
+	filter filters.Filter
+}
+
+// JSON response body for the readiness endpoint.
+type ReadyResponse struct {
+	// True if every required filter in the chain is ready.
+	Ready bool `json:"ready"`
+
+	// The health of each filter in the chain, in chain order.
+	Filters []*filters.Status `json:"filters"`
+}
+
+// Create a HealthHandler instance for the filters.Filter chain.
+func NewHealthHandler(filter filters.Filter) *HealthHandler {
+	return &HealthHandler{filter: filter}
+}
+
+// The process is alive if it can answer at all.
+func (h *HealthHandler) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// Check every filter in the chain at once, and report 503 with the
+// breakdown if a required dependency is down.
+func (h *HealthHandler) readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), READY_TIMEOUT)
+	defer cancel()
+
+	statuses := h.filter.Status(ctx)
+	response := &ReadyResponse{
+		Ready:   filters.Ready(statuses),
+		Filters: statuses,
+	}
+
+	status := http.StatusOK
+	if !response.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", JSON_CONTENT_TYPE)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write the readiness response: %s.", err)
+	}
+}
+
+// Initialize health API.
+func (h *HealthHandler) Init() {
+	http.HandleFunc(HEALTH_ENDPOINT, h.healthHandler)
+	http.HandleFunc(READY_ENDPOINT, h.readyHandler)
+}
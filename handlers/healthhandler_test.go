@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A Fake filter whose store is down.
+type DownFilter struct {
+	*filters.Fake
+}
+
+func (f *DownFilter) Status(ctx context.Context) []*filters.Status {
+	return []*filters.Status{{Filter: "Down", Required: true, Error: "Bad things happened!"}}
+}
+
+// A Fake filter that records whether it was checked with a deadline.
+type DeadlineFilter struct {
+	*filters.Fake
+	deadline bool
+}
+
+func (f *DeadlineFilter) Status(ctx context.Context) []*filters.Status {
+	_, f.deadline = ctx.Deadline()
+	return f.Fake.Status(ctx)
+}
+
+func ServeReady(t *testing.T, filter filters.Filter) (*httptest.ResponseRecorder, *ReadyResponse) {
+	h := NewHealthHandler(filter)
+
+	req, err := http.NewRequest("GET", READY_ENDPOINT, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.readyHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	response := &ReadyResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatalf("Failed to decode the JSON response body: %s.", err)
+	}
+
+	return recorder, response
+}
+
+func TestHealthInitAddsHandlers(t *testing.T) {
+	h := NewHealthHandler(filters.NewFake())
+	h.Init()
+}
+
+func TestHealthz(t *testing.T) {
+	h := NewHealthHandler(&DownFilter{filters.NewFake()})
+
+	req, err := http.NewRequest("GET", HEALTH_ENDPOINT, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.healthHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The healthHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	f := &TestFilter{}
+	f.AddSecondaryFilter(filters.NewFake())
+
+	recorder, response := ServeReady(t, f)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The readyHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if !response.Ready || len(response.Filters) != 1 || response.Filters[0].Filter != "Fake" {
+		t.Errorf("The readiness response was %v when the Fake filter was expected to be ready.", response)
+	}
+
+	if f.called != 1 {
+		t.Errorf("The filter chain was checked %d times when once was expected.", f.called)
+	}
+}
+
+func TestReadyzDown(t *testing.T) {
+	recorder, response := ServeReady(t, &DownFilter{filters.NewFake()})
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("The readyHandler function returned %s when Service Unavailable was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Ready || response.Filters[0].Error == "" {
+		t.Error("The readiness response did not report the filter that was down.")
+	}
+}
+
+func TestReadyzHasDeadline(t *testing.T) {
+	f := &DeadlineFilter{Fake: filters.NewFake()}
+	ServeReady(t, f)
+
+	if !f.deadline {
+		t.Error("The filter chain was checked without a deadline.")
+	}
+}
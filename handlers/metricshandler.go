@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tmortimer/urlfilter/metrics"
+	"net/http"
+)
+
+const METRICS_ENDPOINT = "/metrics"
+
+// Serves the metrics in the Prometheus text format.
+type MetricsHandler struct {
+	// Serves the metrics registry.
+	handler http.Handler
+}
+
+// Create a MetricsHandler serving the urlfilter metrics registry.
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{
+		handler: promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}),
+	}
+}
+
+// Initialize metrics API.
+func (m *MetricsHandler) Init() {
+	http.Handle(METRICS_ENDPOINT, m.handler)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsInitAddsHandlers(t *testing.T) {
+	h := NewMetricsHandler()
+	h.Init()
+}
+
+func TestMetricsCountsRequests(t *testing.T) {
+	f := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{})
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+"www.facebook.com", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	http.HandlerFunc(f.filterHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	req, err = http.NewRequest("GET", METRICS_ENDPOINT, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	NewMetricsHandler().handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The metrics handler returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`urlfilter_requests_total{handler="filter",status="403",verdict="blocked"}`,
+		`urlfilter_filter_lookups_total{filter="Fake",result="hit"}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("The metrics did not include %s.", expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/tmortimer/urlfilter/canonical"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"strings"
+)
+
+// Header holding the API key that selects a policy.
+const API_KEY_HEADER = "X-API-Key"
+
+// Query parameter naming the policy to use. It's stripped from the URL
+// before it's checked.
+const POLICY_PARAM = "urlfilter-policy"
+
+// Header holding the category of the flagged entry that was found.
+const CATEGORY_HEADER = "X-URLFilter-Category"
+
+var ErrUnknownAPIKey = errors.New("Unknown API key.")
+
+var ErrUnknownPolicy = errors.New("Unknown policy.")
+
+// A blocking policy, listing which categories of flagged URL are blocked.
+// A nil Policy blocks every flagged URL.
+type Policy struct {
+	// Name of the policy from the config.
+	Name string
+
+	// Categories of flagged URL that are blocked.
+	categories map[string]bool
+}
+
+// Create a Policy blocking the given categories.
+func NewPolicy(name string, categories []string) *Policy {
+	policy := &Policy{
+		Name:       name,
+		categories: make(map[string]bool),
+	}
+	for _, category := range categories {
+		policy.categories[category] = true
+	}
+	return policy
+}
+
+// Return true if the flagged URL should be blocked under this policy.
+// URLs without a category are always blocked, as are all flagged URLs
+// if there is no policy.
+func (p *Policy) Blocks(verdict *filters.Verdict) bool {
+	if verdict == nil || !verdict.Found {
+		return false
+	}
+
+	return p == nil || verdict.Category == "" || p.categories[verdict.Category]
+}
+
+// The configured policies, and the API keys that select them.
+type Policies struct {
+	// Policies by name.
+	policies map[string]*Policy
+
+	// Policy names by API key.
+	keys map[string]string
+
+	// Policy used when a request doesn't select one, nil blocks everything.
+	defaultPolicy *Policy
+}
+
+// Create Policies from the config.
+func NewPolicies(cfg map[string]config.Policy, defaultPolicy string) *Policies {
+	p := &Policies{
+		policies: make(map[string]*Policy),
+		keys:     make(map[string]string),
+	}
+
+	for name, policy := range cfg {
+		p.policies[name] = NewPolicy(name, policy.Categories)
+		for _, key := range policy.APIKeys {
+			p.keys[key] = name
+		}
+	}
+	p.defaultPolicy = p.policies[defaultPolicy]
+
+	return p
+}
+
+// Select the policy for the request. The API key header takes precedence
+// over the query parameter, which is stripped from the returned URL. If
+// no policies are configured the request is unaffected.
+func (p *Policies) Select(r *http.Request, url string) (*Policy, string, error) {
+	if p == nil || len(p.policies) == 0 {
+		return nil, url, nil
+	}
+
+	name := ""
+	base, params := canonical.SplitQuery(url)
+	kept := make([]string, 0, len(params))
+	for _, param := range params {
+		if strings.HasPrefix(param, POLICY_PARAM+"=") {
+			name = param[len(POLICY_PARAM)+1:]
+		} else {
+			kept = append(kept, param)
+		}
+	}
+	url = canonical.JoinQuery(base, kept)
+
+	policy, err := p.Choose(r.Header.Get(API_KEY_HEADER), name)
+	return policy, url, err
+}
+
+// Choose the policy selected by the API key, or by name if there is no
+// key. If neither is set the default policy is used. If no policies are
+// configured nil is returned.
+func (p *Policies) Choose(key string, name string) (*Policy, error) {
+	if p == nil || len(p.policies) == 0 {
+		return nil, nil
+	}
+
+	if key != "" {
+		var ok bool
+		if name, ok = p.keys[key]; !ok {
+			return nil, ErrUnknownAPIKey
+		}
+	}
+
+	if name == "" {
+		return p.defaultPolicy, nil
+	}
+
+	policy, ok := p.policies[name]
+	if !ok {
+		return nil, ErrUnknownPolicy
+	}
+	return policy, nil
+}
+
+// Return the HTTP status for an error selecting a policy.
+func PolicyErrorStatus(err error) int {
+	if err == ErrUnknownAPIKey {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
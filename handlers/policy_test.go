@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func NewTestPolicies(defaultPolicy string) *Policies {
+	return NewPolicies(map[string]config.Policy{
+		"guest": {Categories: []string{"malware", filters.FAKE_CATEGORY}, APIKeys: []string{"guestkey"}},
+		"staff": {Categories: []string{"malware"}, APIKeys: []string{"staffkey"}},
+	}, defaultPolicy)
+}
+
+func ServePolicy(t *testing.T, policies *Policies, url string, key string) (*httptest.ResponseRecorder, *FilterResponse) {
+	h := NewFilterHandler(filters.NewFake(), FilterHandlerOptions{Policies: policies})
+
+	req, err := http.NewRequest("GET", FILTER_ENDPOINT+url, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Accept", JSON_CONTENT_TYPE)
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.filterHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	response := &FilterResponse{}
+	if recorder.Code != http.StatusUnauthorized && recorder.Code != http.StatusBadRequest {
+		if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+			t.Fatalf("Failed to decode the JSON response body: %s.", err)
+		}
+	}
+
+	return recorder, response
+}
+
+func TestPolicyBlocksCategory(t *testing.T) {
+	recorder, response := ServePolicy(t, NewTestPolicies(""), "www.facebook.com", "guestkey")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("The filterHandler function returned %s when Forbidden was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Policy != "guest" {
+		t.Errorf("The policy was %s when guest was expected.", response.Policy)
+	}
+
+	if recorder.Header().Get(CATEGORY_HEADER) != filters.FAKE_CATEGORY {
+		t.Errorf("The category header was %s when %s was expected.", recorder.Header().Get(CATEGORY_HEADER), filters.FAKE_CATEGORY)
+	}
+}
+
+func TestPolicyAllowsOtherCategory(t *testing.T) {
+	recorder, response := ServePolicy(t, NewTestPolicies(""), "www.facebook.com", "staffkey")
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The filterHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.Verdict != VERDICT_ALLOWED {
+		t.Errorf("The verdict was %s when %s was expected.", response.Verdict, VERDICT_ALLOWED)
+	}
+
+	if response.Category != filters.FAKE_CATEGORY {
+		t.Errorf("The category was %s when %s was expected.", response.Category, filters.FAKE_CATEGORY)
+	}
+}
+
+func TestPolicyQueryParam(t *testing.T) {
+	recorder, response := ServePolicy(t, NewTestPolicies(""), "www.facebook.com/a?b=1&"+POLICY_PARAM+"=staff", "")
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The filterHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	if response.URL != "www.facebook.com/a?b=1" {
+		t.Errorf("The policy parameter was not stripped from the URL, %s was checked.", response.URL)
+	}
+}
+
+func TestPolicyDefault(t *testing.T) {
+	recorder, _ := ServePolicy(t, NewTestPolicies("staff"), "www.facebook.com", "")
+	if recorder.Code != http.StatusOK {
+		t.Errorf("The filterHandler function returned %s when OK was expected.", http.StatusText(recorder.Code))
+	}
+
+	recorder, _ = ServePolicy(t, NewTestPolicies(""), "www.facebook.com", "")
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("The filterHandler function returned %s when Forbidden was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestPolicyUnknownKey(t *testing.T) {
+	recorder, _ := ServePolicy(t, NewTestPolicies(""), "www.facebook.com", "merp")
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("The filterHandler function returned %s when Unauthorized was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestPolicyUnknownPolicy(t *testing.T) {
+	recorder, _ := ServePolicy(t, NewTestPolicies(""), "www.facebook.com?"+POLICY_PARAM+"=merp", "")
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("The filterHandler function returned %s when Bad Request was expected.", http.StatusText(recorder.Code))
+	}
+}
+
+func TestPolicyBlocksUncategorized(t *testing.T) {
+	verdict := filters.NewVerdict("evil.com", true, "Test")
+
+	if !NewPolicy("staff", []string{"malware"}).Blocks(verdict) {
+		t.Error("A flagged URL without a category was not blocked.")
+	}
+
+	var policy *Policy
+	verdict.Category = "adult"
+	if !policy.Blocks(verdict) {
+		t.Error("A flagged URL was not blocked without a policy.")
+	}
+}
+
+func TestPolicyChoose(t *testing.T) {
+	policies := NewTestPolicies("staff")
+
+	policy, err := policies.Choose("guestkey", "staff")
+	if err != nil || policy.Name != "guest" {
+		t.Errorf("The API key did not take precedence over the policy name, got %v.", policy)
+	}
+
+	policy, err = policies.Choose("", "")
+	if err != nil || policy.Name != "staff" {
+		t.Errorf("The default policy was not chosen, got %v.", policy)
+	}
+
+	if _, err = policies.Choose("merp", ""); err != ErrUnknownAPIKey {
+		t.Errorf("An unknown API key returned %v.", err)
+	}
+
+	if _, err = policies.Choose("", "merp"); err != ErrUnknownPolicy {
+		t.Errorf("An unknown policy returned %v.", err)
+	}
+
+	var none *Policies
+	if policy, err = none.Choose("merp", "merp"); policy != nil || err != nil {
+		t.Error("A request was affected when no policies were configured.")
+	}
+}
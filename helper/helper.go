@@ -0,0 +1,155 @@
+// Squid external ACL helper, checks URLs from Squid against the filter
+// chain over stdin and stdout instead of running a server.
+package helper
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the helper in the request metrics.
+const HELPER_HANDLER = "helper"
+
+// Results of the external_acl_type protocol. OK means the ACL matched, ie:
+// the URL is flagged, so Squid is configured to deny on a match.
+const (
+	RESULT_OK  = "OK"
+	RESULT_ERR = "ERR"
+	RESULT_BH  = "BH"
+)
+
+var ErrEmptyLine = errors.New("Empty request line.")
+
+// Answers Squid external_acl_type lookups. Squid sends one URL per line,
+// prefixed with a channel ID if the helper was configured with
+// concurrency, and each answer is prefixed with the same ID.
+type Helper struct {
+	// The chain of filters used by this helper to see if a URL is flagged.
+	filter filters.Filter
+
+	// The policy every URL is checked under, nil blocks everything.
+	policy *handlers.Policy
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+
+	// Guards the output, concurrent lookups finish in any order.
+	lock sync.Mutex
+}
+
+// Create a Helper instance with the underlying filters.Filter chain. If
+// policy is nil every flagged URL is reported, and if auditor is nil
+// decisions aren't audited.
+func NewHelper(filter filters.Filter, policy *handlers.Policy, auditor *audit.Logger) *Helper {
+	return &Helper{filter: filter, policy: policy, auditor: auditor}
+}
+
+// Answer lookups read from in until it's closed. Lines with a channel ID
+// are looked up concurrently, lines without one are answered in order.
+func (h *Helper) Run(in io.Reader, out io.Writer) error {
+	writer := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(in)
+
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		channel, target, err := ParseLine(scanner.Text())
+		if err != nil {
+			h.write(writer, channel, fmt.Sprintf("%s message=%q", RESULT_BH, err.Error()))
+			continue
+		}
+
+		if channel == "" {
+			h.write(writer, channel, h.lookup(target))
+			continue
+		}
+
+		wg.Add(1)
+		go func(channel string, target string) {
+			defer wg.Done()
+			h.write(writer, channel, h.lookup(target))
+		}(channel, target)
+	}
+	wg.Wait()
+
+	return scanner.Err()
+}
+
+// Check the URL against the filter chain and return the result, with the
+// category as the tag if the URL is flagged. Squid treats BH as a failure
+// of the helper, so errors are reported that way. Only the URL is read
+// from Squid, so lookups are audited without a client or request ID.
+func (h *Helper) lookup(target string) string {
+	start := time.Now()
+	verdict, err := h.filter.Lookup(context.Background(), target)
+	response := handlers.NewFilterResponse(target, verdict, err, time.Since(start), h.policy)
+	if h.auditor != nil {
+		h.auditor.Log(handlers.NewAuditRecord("", HELPER_HANDLER, response, ""))
+	}
+
+	result := RESULT_ERR
+	switch response.Verdict {
+	case handlers.VERDICT_BLOCKED:
+		result = RESULT_OK
+		if response.Category != "" {
+			result += " tag=" + response.Category
+		}
+	case handlers.VERDICT_ERROR:
+		result = fmt.Sprintf("%s message=%q", RESULT_BH, response.Error)
+	}
+	metrics.Requests.WithLabelValues(HELPER_HANDLER, response.Verdict, strings.Fields(result)[0]).Inc()
+
+	return result
+}
+
+// Write the result line, flushed immediately since Squid waits for it.
+func (h *Helper) write(writer *bufio.Writer, channel string, result string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if channel != "" {
+		writer.WriteString(channel + " ")
+	}
+	writer.WriteString(result + "\n")
+	writer.Flush()
+}
+
+// Split a request line into its channel ID, which is empty without
+// concurrency, and the URL. The URL is the first format token, any others
+// are ignored. Squid %-encodes tokens and sends absolute URLs, the scheme
+// is dropped to match the REST API path.
+func ParseLine(line string) (string, string, error) {
+	fields := strings.Fields(line)
+	channel := ""
+	if len(fields) > 1 {
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			channel = fields[0]
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) == 0 {
+		return channel, "", ErrEmptyLine
+	}
+
+	target, err := url.PathUnescape(fields[0])
+	if err != nil {
+		return channel, "", err
+	}
+
+	if i := strings.Index(target, "://"); i >= 0 {
+		target = target[i+3:]
+	}
+	return channel, target, nil
+}
@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func RunHelper(t *testing.T, policy *handlers.Policy, input string) []string {
+	out := &bytes.Buffer{}
+	if err := NewHelper(filters.NewFake(), policy, nil).Run(strings.NewReader(input), out); err != nil {
+		t.Fatal(err.Error())
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestParseLine(t *testing.T) {
+	tests := map[string][2]string{
+		"http://www.google.com/a?b=1":    {"", "www.google.com/a?b=1"},
+		"7 http://www.google.com/a%20b":  {"7", "www.google.com/a b"},
+		"3 www.google.com:443 extra":     {"3", "www.google.com:443"},
+		"https://www.google.com/ extra2": {"", "www.google.com/"},
+	}
+
+	for line, expected := range tests {
+		channel, url, err := ParseLine(line)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if channel != expected[0] || url != expected[1] {
+			t.Errorf("Line \"%s\" was parsed as channel \"%s\" URL \"%s\" when channel \"%s\" URL \"%s\" was expected.", line, channel, url, expected[0], expected[1])
+		}
+	}
+
+	if _, _, err := ParseLine("  "); err != ErrEmptyLine {
+		t.Errorf("An empty line returned %v.", err)
+	}
+}
+
+func TestRunSequential(t *testing.T) {
+	lines := RunHelper(t, nil, "http://www.facebook.com/\nhttp://www.google.com/\nhttp://www.bookface.com/\n")
+
+	expected := []string{"OK tag=" + filters.FAKE_CATEGORY, "ERR", "BH message=\"Bad things happened!\""}
+	if len(lines) != len(expected) {
+		t.Fatalf("%d results were returned for %d lines.", len(lines), len(expected))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Result %d was \"%s\" when \"%s\" was expected.", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestRunConcurrent(t *testing.T) {
+	lines := RunHelper(t, nil, "0 http://www.facebook.com/\n1 http://www.google.com/\n2 http://www.bookface.com/\n")
+
+	// Concurrent lookups may be answered in any order.
+	sort.Strings(lines)
+	expected := []string{"0 OK tag=" + filters.FAKE_CATEGORY, "1 ERR", "2 BH message=\"Bad things happened!\""}
+	if len(lines) != len(expected) {
+		t.Fatalf("%d results were returned for %d lines.", len(lines), len(expected))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Result %d was \"%s\" when \"%s\" was expected.", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	lines := RunHelper(t, handlers.NewPolicy("staff", []string{"malware"}), "http://www.facebook.com/\n")
+
+	if lines[0] != "ERR" {
+		t.Errorf("URL \"www.facebook.com/\" was \"%s\" under the staff policy when \"ERR\" was expected.", lines[0])
+	}
+}
+
+func TestRunAudit(t *testing.T) {
+	audited := &bytes.Buffer{}
+	h := NewHelper(filters.NewFake(), nil, audit.NewLogger([]audit.Sink{audit.NewWriterSink(audited)}, 1))
+	if err := h.Run(strings.NewReader("http://www.facebook.com/\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	record := &audit.Record{}
+	if err := json.Unmarshal(audited.Bytes(), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com/" || record.Verdict != handlers.VERDICT_BLOCKED || record.Handler != HELPER_HANDLER {
+		t.Errorf("The lookup was audited as \"%s\".", audited.String())
+	}
+}
@@ -0,0 +1,132 @@
+// Prometheus metrics for the urlfilter server, filter chain and connectors.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+const NAMESPACE = "urlfilter"
+
+// Lookup results counted for each filter.
+const (
+	RESULT_HIT   = "hit"
+	RESULT_MISS  = "miss"
+	RESULT_ERROR = "error"
+)
+
+// Requests handled, by handler, verdict and HTTP or gRPC status.
+var Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "requests_total",
+	Help:      "URL filter requests handled, by handler, verdict and HTTP or gRPC status. Batch requests count each URL.",
+}, []string{"handler", "verdict", "status"})
+
+// Time each filter spends on its own work, not counting the rest of the chain.
+var FilterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: NAMESPACE,
+	Name:      "filter_duration_seconds",
+	Help:      "Time each filter spends on a lookup, not counting the rest of the chain. Batch lookups are observed once.",
+	Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+}, []string{"filter"})
+
+// URLs checked by each filter, by result.
+var FilterLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "filter_lookups_total",
+	Help:      "URLs checked by each filter, by result. A Bloom Filter hit may be a false positive.",
+}, []string{"filter", "result"})
+
+// The number of URLs loaded into each Bloom Filter.
+var BloomURLs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: NAMESPACE,
+	Name:      "bloom_urls",
+	Help:      "URLs loaded into the Bloom Filter.",
+}, []string{"filter"})
+
+// When each Bloom Filter last finished loading.
+var BloomLastLoad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: NAMESPACE,
+	Name:      "bloom_last_load_timestamp_seconds",
+	Help:      "Unix time the Bloom Filter last finished loading.",
+}, []string{"filter"})
+
+// How long each Bloom Filter's last load took.
+var BloomLastLoadDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: NAMESPACE,
+	Name:      "bloom_last_load_duration_seconds",
+	Help:      "Time the Bloom Filter's last successful load took.",
+}, []string{"filter"})
+
+// Failed Bloom Filter loads.
+var BloomLoadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "bloom_load_failures_total",
+	Help:      "Bloom Filter loads that failed part way through.",
+}, []string{"filter"})
+
+// Results of blocked lookup events sent to the webhooks.
+const (
+	EVENT_SENT    = "sent"
+	EVENT_FAILED  = "failed"
+	EVENT_DROPPED = "dropped"
+)
+
+// Blocked lookup events, by whether they reached a webhook.
+var WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "webhook_events_total",
+	Help:      "Blocked lookup events for the webhooks, by result. Sent and failed events are counted for each webhook, events are dropped once for a full queue.",
+}, []string{"result"})
+
+// Connection pools of the Redis and MySQL connectors.
+var Pools = NewPoolCollector()
+
+// The registry served by the metrics endpoint.
+var Registry = NewRegistry()
+
+// Create a registry with the urlfilter metrics, and the Go runtime and
+// process metrics.
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		Requests,
+		FilterDuration,
+		FilterLookups,
+		BloomURLs,
+		BloomLastLoad,
+		BloomLastLoadDuration,
+		BloomLoadFailures,
+		WebhookEvents,
+		Pools,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Record a lookup by the named filter that took duration, and its results.
+func ObserveLookup(filter string, duration time.Duration, hits int, misses int, errors int) {
+	FilterDuration.WithLabelValues(filter).Observe(duration.Seconds())
+	FilterLookups.WithLabelValues(filter, RESULT_HIT).Add(float64(hits))
+	FilterLookups.WithLabelValues(filter, RESULT_MISS).Add(float64(misses))
+	FilterLookups.WithLabelValues(filter, RESULT_ERROR).Add(float64(errors))
+}
+
+// Record a lookup of found by the named filter. If err is set every URL
+// is counted as an error, the connectors fail a whole batch at once.
+func ObserveFound(filter string, start time.Time, found []bool, err error) {
+	if err != nil {
+		ObserveLookup(filter, time.Since(start), 0, 0, len(found))
+		return
+	}
+
+	hits := 0
+	for _, f := range found {
+		if f {
+			hits++
+		}
+	}
+	ObserveLookup(filter, time.Since(start), hits, len(found)-hits, 0)
+}
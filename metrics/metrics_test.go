@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TestPool struct {
+	stats PoolStats
+}
+
+func (p *TestPool) Name() string {
+	return "Test"
+}
+
+func (p *TestPool) Source() string {
+	return "test"
+}
+
+func (p *TestPool) PoolStats() PoolStats {
+	return p.stats
+}
+
+func TestObserveFound(t *testing.T) {
+	ObserveFound("ObserveFound", time.Now(), []bool{true, false, false}, nil)
+	ObserveFound("ObserveFound", time.Now(), []bool{false, false}, errors.New("Bad things happened!"))
+
+	expected := map[string]float64{RESULT_HIT: 1, RESULT_MISS: 2, RESULT_ERROR: 2}
+	for result, count := range expected {
+		if value := testutil.ToFloat64(FilterLookups.WithLabelValues("ObserveFound", result)); value != count {
+			t.Errorf("The %s count was %f when %f was expected.", result, value, count)
+		}
+	}
+
+	if count := testutil.CollectAndCount(FilterDuration, "urlfilter_filter_duration_seconds"); count == 0 {
+		t.Error("The lookup duration was not observed.")
+	}
+}
+
+func TestPoolCollectorSumsSharedSources(t *testing.T) {
+	pools := NewPoolCollector()
+	pools.Add(&TestPool{PoolStats{Open: 2, InUse: 1, Idle: 1, WaitCount: 3}})
+	pools.Add(&TestPool{PoolStats{Open: 1, Idle: 1, WaitCount: 1}})
+
+	expected := `
+# HELP urlfilter_pool_waits_total Times a caller waited for a connection from the connector's pool.
+# TYPE urlfilter_pool_waits_total counter
+urlfilter_pool_waits_total{pool="Test",source="test"} 4
+`
+	if err := testutil.CollectAndCompare(pools, strings.NewReader(expected), "urlfilter_pool_waits_total"); err != nil {
+		t.Errorf("The pool metrics were not as expected: %s", err)
+	}
+
+	if count := testutil.CollectAndCount(pools, "urlfilter_pool_connections"); count != 3 {
+		t.Errorf("%d pool connection metrics were collected when 3 were expected.", count)
+	}
+}
+
+func TestRegistryGathers(t *testing.T) {
+	if _, err := NewRegistry().Gather(); err != nil {
+		t.Errorf("Gathering the metrics generated an error: %s.", err)
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Connection pool statistics, common to the Redis and MySQL connectors.
+type PoolStats struct {
+	// Connections currently open, in use or idle.
+	Open int
+
+	// Connections currently in use.
+	InUse int
+
+	// Connections currently idle.
+	Idle int
+
+	// Total number of times a caller waited for a connection.
+	WaitCount int64
+
+	// Total time callers waited for a connection.
+	WaitDuration time.Duration
+}
+
+// A connector with a connection pool.
+type Pool interface {
+	// Return the name of the connector.
+	Name() string
+
+	// Describe where the connector's URLs are stored.
+	Source() string
+
+	// Return the current statistics of the connection pool.
+	PoolStats() PoolStats
+}
+
+// Collects the statistics of each connector's pool when scraped.
+type PoolCollector struct {
+	// The pools reported.
+	pools []Pool
+
+	// Guards pools, which are added as connectors are created.
+	lock sync.Mutex
+
+	// Connections in each pool, by state.
+	connections *prometheus.Desc
+
+	// Times a caller waited for a connection from each pool.
+	waits *prometheus.Desc
+
+	// Time callers spent waiting for a connection from each pool.
+	waitSeconds *prometheus.Desc
+}
+
+// Create an empty PoolCollector.
+func NewPoolCollector() *PoolCollector {
+	return &PoolCollector{
+		connections: prometheus.NewDesc(
+			prometheus.BuildFQName(NAMESPACE, "pool", "connections"),
+			"Connections in the connector's pool, by state.",
+			[]string{"pool", "source", "state"}, nil),
+		waits: prometheus.NewDesc(
+			prometheus.BuildFQName(NAMESPACE, "pool", "waits_total"),
+			"Times a caller waited for a connection from the connector's pool.",
+			[]string{"pool", "source"}, nil),
+		waitSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(NAMESPACE, "pool", "wait_seconds_total"),
+			"Time callers spent waiting for a connection from the connector's pool.",
+			[]string{"pool", "source"}, nil),
+	}
+}
+
+// Add a connector's pool to those reported.
+func (p *PoolCollector) Add(pool Pool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.pools = append(p.pools, pool)
+}
+
+// Describe the pool metrics.
+func (p *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.connections
+	ch <- p.waits
+	ch <- p.waitSeconds
+}
+
+// Collect the current statistics of each pool. Connectors to the same
+// source, ie: the MySQL filter and the Bloom Filter's loader, are summed.
+func (p *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	p.lock.Lock()
+	pools := make([]Pool, len(p.pools))
+	copy(pools, p.pools)
+	p.lock.Unlock()
+
+	type key struct{ name, source string }
+	keys := []key{}
+	totals := make(map[key]PoolStats)
+	for _, pool := range pools {
+		k := key{pool.Name(), pool.Source()}
+		total, ok := totals[k]
+		if !ok {
+			keys = append(keys, k)
+		}
+
+		stats := pool.PoolStats()
+		total.Open += stats.Open
+		total.InUse += stats.InUse
+		total.Idle += stats.Idle
+		total.WaitCount += stats.WaitCount
+		total.WaitDuration += stats.WaitDuration
+		totals[k] = total
+	}
+
+	for _, k := range keys {
+		stats := totals[k]
+		ch <- prometheus.MustNewConstMetric(p.connections, prometheus.GaugeValue, float64(stats.Open), k.name, k.source, "open")
+		ch <- prometheus.MustNewConstMetric(p.connections, prometheus.GaugeValue, float64(stats.InUse), k.name, k.source, "in_use")
+		ch <- prometheus.MustNewConstMetric(p.connections, prometheus.GaugeValue, float64(stats.Idle), k.name, k.source, "idle")
+		ch <- prometheus.MustNewConstMetric(p.waits, prometheus.CounterValue, float64(stats.WaitCount), k.name, k.source)
+		ch <- prometheus.MustNewConstMetric(p.waitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds(), k.name, k.source)
+	}
+}
@@ -3,11 +3,13 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"github.com/tjarratt/babble"
 	"github.com/tmortimer/urlfilter/config"
 	"github.com/tmortimer/urlfilter/connectors"
+	"github.com/tmortimer/urlfilter/filters"
 	"log"
 	"math/rand"
 	"os"
@@ -20,6 +22,7 @@ func main() {
 	listPath := flag.String("list", "", "Path to config list of domains.")
 	pathDepth := flag.Int("mpdepth", 0, "Max depth of path to add to domains.")
 	queryDepth := flag.Int("mqdepth", 0, "Max depth of query to add to domains.")
+	category := flag.String("category", "", "Category to record for every URL in the list, ie: malware.")
 
 	flag.Parse()
 
@@ -32,6 +35,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Unable to connect to MySQL: %s", err)
 	}
+	defer conn.Close()
 
 	list, err := os.Open(*listPath)
 	defer list.Close()
@@ -71,7 +75,10 @@ func main() {
 			}
 		}
 
-		conn.AddURL(url)
+		// Store the same form of the URL the configured chain looks up.
+		url = filters.StoredURL(url, config)
+
+		conn.AddURL(context.Background(), url, *category)
 		fmt.Println(url)
 		count++
 	}
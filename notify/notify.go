@@ -0,0 +1,223 @@
+// Webhook notifications for blocked lookups, posted in the background so
+// lookups never wait on them.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/metrics"
+	"log"
+	"net/http"
+	"time"
+)
+
+// A blocked lookup, posted to the webhooks in a JSON array.
+type Event struct {
+	// The URL that was blocked.
+	URL string `json:"url"`
+
+	// Address of the client that asked for the URL.
+	ClientIP string `json:"clientIP"`
+
+	// The filter in the chain that flagged the URL.
+	Filter string `json:"filter,omitempty"`
+
+	// The stored entry that was found, if it isn't the URL itself.
+	Matched string `json:"matched,omitempty"`
+
+	// The category of the entry that was found, if the list records one.
+	Category string `json:"category,omitempty"`
+
+	// The policy the URL was blocked under, if any.
+	Policy string `json:"policy,omitempty"`
+
+	// The ID of the request, as in the X-Request-ID header.
+	RequestID string `json:"requestId,omitempty"`
+
+	// When the URL was blocked.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Queues events and posts them to the webhooks in batches. The queue is
+// bounded, events are dropped while it's full.
+type Notifier struct {
+	// URLs the events are posted to.
+	urls []string
+
+	// Client used for the posts, with the configured timeout.
+	client *http.Client
+
+	// Events waiting to be posted.
+	events chan *Event
+
+	// Maximum number of events posted at a time.
+	batchSize int
+
+	// How long a partial batch waits before it's posted.
+	flushInterval time.Duration
+
+	// Number of times a failed post is retried.
+	maxRetries int
+
+	// Delay before the first retry, doubled for each one after.
+	retryBackoff time.Duration
+
+	// Receives the context events are drained under when the Notifier is
+	// closed.
+	done chan context.Context
+
+	// Closed once the last events have been posted.
+	stopped chan struct{}
+}
+
+// Create a Notifier from the config and start posting events.
+func NewNotifier(cfg config.Webhook) *Notifier {
+	n := &Notifier{
+		urls:          cfg.URLs,
+		client:        &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		events:        make(chan *Event, cfg.QueueSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushInterval) * time.Millisecond,
+		maxRetries:    cfg.MaxRetries,
+		retryBackoff:  time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		done:          make(chan context.Context),
+		stopped:       make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Queue the event without waiting. Returns false if the queue was full
+// and the event was dropped.
+func (n *Notifier) Notify(event *Event) bool {
+	select {
+	case n.events <- event:
+		return true
+	default:
+		metrics.WebhookEvents.WithLabelValues(metrics.EVENT_DROPPED).Inc()
+		return false
+	}
+}
+
+// Stop the Notifier, posting the events that are still queued first.
+// Events still queued when the context is done, and events queued
+// afterwards, are dropped.
+func (n *Notifier) Close(ctx context.Context) {
+	n.done <- ctx
+	<-n.stopped
+}
+
+// Collect queued events into batches, posting each batch once it's full
+// or the flush interval has passed since its first event.
+func (n *Notifier) run() {
+	defer close(n.stopped)
+
+	batch := make([]*Event, 0, n.batchSize)
+	// Nil until the batch has an event, so an empty batch never flushes.
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case event := <-n.events:
+			batch = append(batch, event)
+			if len(batch) == 1 {
+				flush = time.After(n.flushInterval)
+			}
+			if len(batch) < n.batchSize {
+				continue
+			}
+		case <-flush:
+		case ctx := <-n.done:
+			n.drain(ctx, batch)
+			return
+		}
+
+		n.post(context.Background(), batch)
+		batch = make([]*Event, 0, n.batchSize)
+		flush = nil
+	}
+}
+
+// Post the batch along with the events still queued, in batches, until
+// the context is done. Whatever is left then is dropped.
+func (n *Notifier) drain(ctx context.Context, batch []*Event) {
+	for ctx.Err() == nil {
+		select {
+		case event := <-n.events:
+			batch = append(batch, event)
+			if len(batch) < n.batchSize {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				n.post(ctx, batch)
+			}
+			return
+		}
+
+		n.post(ctx, batch)
+		batch = make([]*Event, 0, n.batchSize)
+	}
+
+	dropped := len(batch) + len(n.events)
+	log.Printf("Dropped %d webhook events that weren't posted before shutting down.", dropped)
+	metrics.WebhookEvents.WithLabelValues(metrics.EVENT_DROPPED).Add(float64(dropped))
+}
+
+// Post the batch to every webhook, giving up when the context is done.
+func (n *Notifier) post(ctx context.Context, batch []*Event) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Printf("Failed to encode %d webhook events: %s.", len(batch), err)
+		return
+	}
+
+	for _, url := range n.urls {
+		result := metrics.EVENT_SENT
+		if err := n.send(ctx, url, body); err != nil {
+			log.Printf("Failed to post %d events to webhook %s: %s.", len(batch), url, err)
+			result = metrics.EVENT_FAILED
+		}
+		metrics.WebhookEvents.WithLabelValues(result).Add(float64(len(batch)))
+	}
+}
+
+// Post the body to the webhook, retrying with backoff until it's accepted
+// with a 2xx, the retries run out or the context is done.
+func (n *Notifier) send(ctx context.Context, url string, body []byte) error {
+	backoff := n.retryBackoff
+	var err error
+	for attempt := 0; attempt <= n.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		var request *http.Request
+		request, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		var response *http.Response
+		response, err = n.client.Do(request)
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("Webhook returned %s.", response.Status)
+	}
+	return err
+}
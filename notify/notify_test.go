@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/tmortimer/urlfilter/config"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A webhook that records each batch posted to it, after answering the
+// first failures posts with a 503.
+func NewTestWebhook(t *testing.T, failures int32) (*httptest.Server, chan []*Event) {
+	batches := make(chan []*Event, 10)
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []*Event
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err.Error())
+		}
+		batches <- batch
+	}))
+	t.Cleanup(server.Close)
+	return server, batches
+}
+
+func NewTestConfig(url string) config.Webhook {
+	cfg := config.NewWebhook()
+	cfg.URLs = []string{url}
+	cfg.BatchSize = 2
+	cfg.FlushInterval = 50
+	cfg.RetryBackoff = 1
+	return cfg
+}
+
+func ReceiveBatch(t *testing.T, batches chan []*Event) []*Event {
+	select {
+	case batch := <-batches:
+		return batch
+	case <-time.After(5 * time.Second):
+		t.Fatal("The webhook wasn't posted to.")
+		return nil
+	}
+}
+
+func TestNotifyFullBatch(t *testing.T) {
+	server, batches := NewTestWebhook(t, 0)
+	n := NewNotifier(NewTestConfig(server.URL))
+
+	n.Notify(&Event{URL: "www.facebook.com", ClientIP: "10.0.0.1"})
+	n.Notify(&Event{URL: "www.faceface.com", ClientIP: "10.0.0.2"})
+
+	batch := ReceiveBatch(t, batches)
+	if len(batch) != 2 || batch[0].URL != "www.facebook.com" || batch[1].ClientIP != "10.0.0.2" {
+		t.Errorf("The webhook received an unexpected batch %v.", batch)
+	}
+}
+
+func TestNotifyFlushInterval(t *testing.T) {
+	server, batches := NewTestWebhook(t, 0)
+	n := NewNotifier(NewTestConfig(server.URL))
+
+	n.Notify(&Event{URL: "www.facebook.com"})
+
+	batch := ReceiveBatch(t, batches)
+	if len(batch) != 1 || batch[0].URL != "www.facebook.com" {
+		t.Errorf("The webhook received an unexpected batch %v.", batch)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	server, batches := NewTestWebhook(t, 2)
+	n := NewNotifier(NewTestConfig(server.URL))
+
+	n.Notify(&Event{URL: "www.facebook.com"})
+
+	batch := ReceiveBatch(t, batches)
+	if len(batch) != 1 {
+		t.Errorf("The webhook received %d events after two failures when 1 was expected.", len(batch))
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	server, _ := NewTestWebhook(t, 10)
+	n := &Notifier{client: http.DefaultClient, maxRetries: 1, retryBackoff: time.Millisecond}
+
+	if err := n.send(context.Background(), server.URL, []byte("[]")); err == nil {
+		t.Error("Posting to a failing webhook didn't fail.")
+	}
+}
+
+func TestNotifyDropsWhenFull(t *testing.T) {
+	// Nothing is reading the queue.
+	n := &Notifier{events: make(chan *Event, 1)}
+
+	if !n.Notify(&Event{URL: "www.facebook.com"}) {
+		t.Error("The first event was dropped from an empty queue.")
+	}
+
+	if n.Notify(&Event{URL: "www.faceface.com"}) {
+		t.Error("An event wasn't dropped from a full queue.")
+	}
+}
+
+func TestCloseFlushes(t *testing.T) {
+	server, batches := NewTestWebhook(t, 0)
+	cfg := NewTestConfig(server.URL)
+	cfg.FlushInterval = 60000
+	n := NewNotifier(cfg)
+
+	n.Notify(&Event{URL: "www.facebook.com", ClientIP: "10.0.0.1"})
+	n.Close(context.Background())
+
+	select {
+	case batch := <-batches:
+		if len(batch) != 1 || batch[0].URL != "www.facebook.com" {
+			t.Errorf("The webhook received an unexpected batch %v.", batch)
+		}
+	default:
+		t.Error("The queued event wasn't posted before the Notifier closed.")
+	}
+}
+
+func TestCloseGivesUpAtDeadline(t *testing.T) {
+	server, _ := NewTestWebhook(t, 1000)
+	cfg := NewTestConfig(server.URL)
+	cfg.RetryBackoff = 60000
+	n := NewNotifier(cfg)
+
+	n.Notify(&Event{URL: "www.facebook.com", ClientIP: "10.0.0.1"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	n.Close(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Closing the Notifier took %s after its deadline had passed.", elapsed)
+	}
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"github.com/tmortimer/urlfilter/handlers"
+	"html"
+	"log"
+)
+
+// Return the built-in block page for the blocked URL.
+func BlockPage(response *handlers.FilterResponse, requestID string) string {
+	page, err := handlers.DefaultBlockPage.Render(handlers.NewBlockPageData(response, requestID))
+	if err != nil {
+		log.Printf("Failed to render the block page for %s: %s.", response.URL, err)
+		return "Access to " + html.EscapeString(response.URL) + " has been blocked.\n"
+	}
+	return page
+}
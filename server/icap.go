@@ -0,0 +1,538 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path of the REQMOD service, ie: icap://proxy.example:1344/reqmod.
+const ICAP_SERVICE = "/reqmod"
+
+// Name of the ICAP server in the request metrics.
+const ICAP_HANDLER = "icap"
+
+const ICAP_VERSION = "ICAP/1.0"
+
+// Identifies the state of the service to ICAP clients, which may cache
+// OPTIONS responses. It should change if the service's behaviour does.
+const ICAP_ISTAG = "\"urlfilter-1\""
+
+// Seconds ICAP clients may cache the OPTIONS response.
+const ICAP_OPTIONS_TTL = 3600
+
+// Largest encapsulated HTTP request header accepted, in bytes. The
+// Encapsulated offsets come from the client, so they're bounded before
+// anything is allocated.
+const ICAP_MAX_HEADER_LENGTH = 64 * 1024
+
+// Largest encapsulated body accepted, in bytes, across all of its chunks.
+const ICAP_MAX_BODY_LENGTH = 1024 * 1024
+
+// How often a shutdown checks whether the connections have finished.
+const ICAP_SHUTDOWN_POLL = 50 * time.Millisecond
+
+// ICAP header holding the address of the proxy's client.
+const ICAP_CLIENT_IP_HEADER = "X-Client-IP"
+
+var ErrICAPMalformed = errors.New("Malformed ICAP request.")
+
+var ErrICAPTooLarge = errors.New("ICAP request too large.")
+
+var icapStatusText = map[int]string{
+	200: "OK",
+	204: "No Content",
+	400: "Bad Request",
+	404: "ICAP Service Not Found",
+	405: "Method Not Allowed",
+	500: "Server Error",
+}
+
+// ICAP (RFC 3507) server answering OPTIONS and REQMOD requests from
+// proxies. Allowed requests get a 204, or are echoed back unmodified if the
+// proxy doesn't allow 204s. Blocked requests get a 403 block page.
+type ICAPServer struct {
+	// The chain of filters used by this server to see if a URL is flagged.
+	filter filters.Filter
+
+	// Blocking policies selected per request.
+	policies *handlers.Policies
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+
+	// Guards the listeners, connections and shutdown flag.
+	lock sync.Mutex
+
+	// Listeners being served, closed on shutdown.
+	listeners map[net.Listener]bool
+
+	// Open connections, true while a request is being handled on them.
+	conns map[net.Conn]bool
+
+	// Set once the server is shutting down.
+	shuttingDown bool
+}
+
+// A parsed ICAP request, the encapsulated HTTP message is read separately.
+type icapRequest struct {
+	// OPTIONS or REQMOD.
+	method string
+
+	// The ICAP service URI.
+	uri *url.URL
+
+	// The ICAP headers.
+	header textproto.MIMEHeader
+
+	// The sections of the encapsulated message, in order.
+	sections []icapSection
+}
+
+// A section of the encapsulated message, from the Encapsulated header.
+type icapSection struct {
+	// One of req-hdr, req-body, res-hdr, res-body, opt-body or null-body.
+	name string
+
+	// Offset of the section from the start of the encapsulated message.
+	offset int
+}
+
+// Create an ICAPServer instance with the underlying filters.Filter chain.
+// If policies is nil every flagged URL is blocked, and if auditor is nil
+// decisions aren't audited.
+func NewICAPServer(filter filters.Filter, policies *handlers.Policies, auditor *audit.Logger) *ICAPServer {
+	return &ICAPServer{
+		filter:    filter,
+		policies:  policies,
+		auditor:   auditor,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// Accept ICAP connections on the listener, each is served in its own
+// goroutine until the client closes it. Returns nil once the server has
+// been shut down.
+func (s *ICAPServer) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.shuttingDown {
+		s.lock.Unlock()
+		listener.Close()
+		return nil
+	}
+	s.listeners[listener] = true
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			delete(s.listeners, listener)
+			if s.shuttingDown {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Stop accepting connections, close the idle ones, and wait for the
+// requests being handled to finish. Connections still busy when ctx is
+// done are closed, and ctx's error is returned.
+func (s *ICAPServer) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	s.shuttingDown = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	s.lock.Unlock()
+
+	ticker := time.NewTicker(ICAP_SHUTDOWN_POLL)
+	defer ticker.Stop()
+	for {
+		if s.closeConns(false) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns(true)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close the idle connections, or all of them if busy is set. Returns true
+// if no connections are left open.
+func (s *ICAPServer) closeConns(busy bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for conn, active := range s.conns {
+		if busy || !active {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// Record whether a request is being handled on the connection. Returns
+// false if the connection is idle and the server is shutting down, in which
+// case it should be closed rather than wait for another request.
+func (s *ICAPServer) track(conn net.Conn, active bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.shuttingDown && !active {
+		delete(s.conns, conn)
+		return false
+	}
+	s.conns[conn] = active
+	return true
+}
+
+// Forget the connection once it's closed.
+func (s *ICAPServer) untrack(conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, conn)
+}
+
+// Serve requests on a persistent ICAP connection. A request that can't be
+// parsed closes the connection, since the rest of the stream can't be framed.
+func (s *ICAPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	defer s.untrack(conn)
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		if !s.track(conn, false) {
+			return
+		}
+
+		// Idle connections closed by a shutdown end the same way as those
+		// closed by the client.
+		req, err := readICAPRequest(reader)
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			return
+		}
+		s.track(conn, true)
+
+		keepAlive := false
+		if err != nil {
+			log.Printf("Failed to read ICAP request: %s.", err)
+			writeICAPResponse(writer, http.StatusBadRequest, nil, nil)
+		} else {
+			keepAlive = s.handle(req, reader, writer)
+		}
+
+		if err := writer.Flush(); err != nil || !keepAlive {
+			return
+		}
+		if req.header.Get("Connection") == "close" {
+			return
+		}
+	}
+}
+
+// Handle a single request, returning false if the connection can't be reused.
+func (s *ICAPServer) handle(req *icapRequest, reader *bufio.Reader, writer *bufio.Writer) bool {
+	if req.uri.Path != ICAP_SERVICE {
+		writeICAPResponse(writer, http.StatusNotFound, nil, nil)
+		return false
+	}
+
+	switch req.method {
+	case "OPTIONS":
+		s.options(writer)
+		return true
+	case "REQMOD":
+		return s.reqmod(req, reader, writer)
+	}
+
+	writeICAPResponse(writer, http.StatusMethodNotAllowed, nil, nil)
+	return false
+}
+
+// Describe the REQMOD service. A zero byte preview is requested so that
+// allowed requests never need to send their body.
+func (s *ICAPServer) options(writer *bufio.Writer) {
+	writeICAPResponse(writer, http.StatusOK, [][2]string{
+		{"Methods", "REQMOD"},
+		{"Service", "urlfilter"},
+		{"Allow", "204"},
+		{"Preview", "0"},
+		{"Transfer-Preview", "*"},
+		{"Options-TTL", strconv.Itoa(ICAP_OPTIONS_TTL)},
+		{"Encapsulated", "null-body=0"},
+	}, nil)
+}
+
+// Check the URL of the encapsulated HTTP request against the filter chain.
+// The policy is selected by the X-API-Key ICAP header or the
+// urlfilter-policy parameter of the service URI.
+func (s *ICAPServer) reqmod(req *icapRequest, reader *bufio.Reader, writer *bufio.Writer) bool {
+	headerLength, hasBody, err := req.requestHeaderLength()
+	if err != nil {
+		writeICAPResponse(writer, http.StatusBadRequest, nil, nil)
+		return false
+	}
+
+	rawHeader := make([]byte, headerLength)
+	if _, err := io.ReadFull(reader, rawHeader); err != nil {
+		return false
+	}
+
+	// The body has to be consumed to keep the connection in step. After a
+	// preview the rest of it is never needed, a 204 is always allowed.
+	preview := req.header.Get("Preview") != ""
+	var body []byte
+	if hasBody {
+		if body, err = readICAPChunks(reader); err != nil {
+			if err == ErrICAPMalformed || err == ErrICAPTooLarge {
+				writeICAPResponse(writer, http.StatusBadRequest, nil, nil)
+			}
+			return false
+		}
+	}
+
+	httpReq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(rawHeader)))
+	if err != nil {
+		writeICAPResponse(writer, http.StatusBadRequest, nil, nil)
+		return false
+	}
+
+	policy, err := s.policies.Choose(req.header.Get(handlers.API_KEY_HEADER), req.uri.Query().Get(handlers.POLICY_PARAM))
+	if err != nil {
+		metrics.Requests.WithLabelValues(ICAP_HANDLER, handlers.VERDICT_NONE, strconv.Itoa(http.StatusBadRequest)).Inc()
+		writeICAPResponse(writer, http.StatusBadRequest, nil, nil)
+		return true
+	}
+
+	target := RequestURL(httpReq)
+	start := time.Now()
+	// ICAP has no way to tell that the client has gone away, only the
+	// lookup deadline applies.
+	verdict, err := s.filter.Lookup(context.Background(), target)
+	response := handlers.NewFilterResponse(target, verdict, err, time.Since(start), policy)
+	requestID := handlers.RequestID(httpReq)
+	if s.auditor != nil {
+		// The proxy only sends the client's address if it's configured to,
+		// ie: Squid's icap_send_client_ip.
+		s.auditor.Log(handlers.NewAuditRecord(req.header.Get(ICAP_CLIENT_IP_HEADER), ICAP_HANDLER, response, requestID))
+	}
+
+	// The proxy decides whether to fail open when the lookup fails.
+	status := http.StatusOK
+	switch {
+	case response.Verdict == handlers.VERDICT_ERROR:
+		status = http.StatusInternalServerError
+		writeICAPResponse(writer, status, nil, nil)
+	case response.Verdict == handlers.VERDICT_BLOCKED:
+		writeICAPBlockPage(writer, response, requestID)
+	case preview || strings.Contains(req.header.Get("Allow"), "204"):
+		status = http.StatusNoContent
+		writeICAPResponse(writer, status, nil, nil)
+	default:
+		writeICAPEcho(writer, rawHeader, body, hasBody)
+	}
+	metrics.Requests.WithLabelValues(ICAP_HANDLER, response.Verdict, strconv.Itoa(status)).Inc()
+
+	return true
+}
+
+// Return the length of the encapsulated HTTP request header, and whether
+// a request body follows it.
+func (r *icapRequest) requestHeaderLength() (int, bool, error) {
+	if len(r.sections) < 2 || r.sections[0].name != "req-hdr" || r.sections[0].offset != 0 {
+		return 0, false, ErrICAPMalformed
+	}
+
+	next := r.sections[1]
+	return next.offset, next.name == "req-body", nil
+}
+
+// Build the URL checked for a proxied or encapsulated HTTP request, in the
+// same form as the REST API path: the host followed by the path and query.
+// CONNECT requests only have a host and port.
+func RequestURL(r *http.Request) string {
+	if r.Method == http.MethodConnect {
+		return r.Host
+	}
+	return r.Host + r.URL.RequestURI()
+}
+
+// Read an ICAP request line and headers, io.EOF if the connection closed
+// between requests.
+func readICAPRequest(reader *bufio.Reader) (*icapRequest, error) {
+	tp := textproto.NewReader(reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || parts[2] != ICAP_VERSION {
+		return nil, ErrICAPMalformed
+	}
+
+	uri, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	// Offsets have to be in order and within the header limit, they're
+	// used to size the read of the encapsulated header.
+	req := &icapRequest{method: parts[0], uri: uri, header: header}
+	last := 0
+	for _, section := range strings.Split(header.Get("Encapsulated"), ",") {
+		name, offset, ok := strings.Cut(strings.TrimSpace(section), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < last || n > ICAP_MAX_HEADER_LENGTH {
+			return nil, ErrICAPMalformed
+		}
+		last = n
+		req.sections = append(req.sections, icapSection{name: name, offset: n})
+	}
+
+	return req, nil
+}
+
+// Read a chunked encapsulated body up to its last chunk. For a preview
+// that's the end of the preview, whether or not it's the whole body. Bodies
+// over ICAP_MAX_BODY_LENGTH are rejected with ErrICAPTooLarge.
+func readICAPChunks(reader *bufio.Reader) ([]byte, error) {
+	tp := textproto.NewReader(reader)
+	body := &bytes.Buffer{}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		// Chunk extensions, ie: ieof, don't change how the body is framed.
+		size, _, _ := strings.Cut(line, ";")
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		if err != nil || n < 0 {
+			return nil, ErrICAPMalformed
+		}
+
+		if n > int64(ICAP_MAX_BODY_LENGTH-body.Len()) {
+			return nil, ErrICAPTooLarge
+		}
+
+		if n == 0 {
+			// The last chunk is followed by an empty line.
+			if _, err := tp.ReadLine(); err != nil {
+				return nil, err
+			}
+			return body.Bytes(), nil
+		}
+
+		copied, err := io.Copy(body, io.LimitReader(reader, n))
+		if err != nil {
+			return nil, err
+		}
+		if copied != n {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		// Each chunk ends with a CRLF.
+		if line, err := tp.ReadLine(); err != nil || line != "" {
+			return nil, ErrICAPMalformed
+		}
+	}
+}
+
+// Write an ICAP response with the headers, followed by the encapsulated
+// message if there is one.
+func writeICAPResponse(writer *bufio.Writer, status int, headers [][2]string, encapsulated []byte) {
+	fmt.Fprintf(writer, "%s %d %s\r\n", ICAP_VERSION, status, icapStatusText[status])
+	fmt.Fprintf(writer, "ISTag: %s\r\n", ICAP_ISTAG)
+
+	hasEncapsulated := false
+	for _, header := range headers {
+		fmt.Fprintf(writer, "%s: %s\r\n", header[0], header[1])
+		hasEncapsulated = hasEncapsulated || header[0] == "Encapsulated"
+	}
+	if !hasEncapsulated {
+		writer.WriteString("Encapsulated: null-body=0\r\n")
+	}
+
+	writer.WriteString("\r\n")
+	writer.Write(encapsulated)
+}
+
+// Write a 403 block page for the proxy to return to the client, in place
+// of forwarding the request.
+func writeICAPBlockPage(writer *bufio.Writer, response *handlers.FilterResponse, requestID string) {
+	page := BlockPage(response, requestID)
+
+	header := &bytes.Buffer{}
+	fmt.Fprintf(header, "HTTP/1.1 %d %s\r\n", http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	fmt.Fprintf(header, "Content-Type: %s\r\n", handlers.HTML_CONTENT_TYPE)
+	fmt.Fprintf(header, "%s: %s\r\n", handlers.REQUEST_ID_HEADER, requestID)
+	fmt.Fprintf(header, "Content-Length: %d\r\n", len(page))
+	if response.Category != "" {
+		fmt.Fprintf(header, "%s: %s\r\n", handlers.CATEGORY_HEADER, response.Category)
+	}
+	header.WriteString("\r\n")
+
+	encapsulated := fmt.Sprintf("res-hdr=0, res-body=%d", header.Len())
+	writeICAPResponse(writer, http.StatusOK, [][2]string{{"Encapsulated", encapsulated}},
+		append(header.Bytes(), icapChunk([]byte(page))...))
+}
+
+// Write the encapsulated request back unmodified, for proxies that don't
+// accept 204s.
+func writeICAPEcho(writer *bufio.Writer, rawHeader []byte, body []byte, hasBody bool) {
+	encapsulated := fmt.Sprintf("req-hdr=0, null-body=%d", len(rawHeader))
+	message := rawHeader
+	if hasBody {
+		encapsulated = fmt.Sprintf("req-hdr=0, req-body=%d", len(rawHeader))
+		message = append(message, icapChunk(body)...)
+	}
+	writeICAPResponse(writer, http.StatusOK, [][2]string{{"Encapsulated", encapsulated}}, message)
+}
+
+// Encode the body as a single chunk followed by the last chunk.
+func icapChunk(body []byte) []byte {
+	chunked := &bytes.Buffer{}
+	if len(body) > 0 {
+		fmt.Fprintf(chunked, "%x\r\n", len(body))
+		chunked.Write(body)
+		chunked.WriteString("\r\n")
+	}
+	chunked.WriteString("0\r\n\r\n")
+	return chunked.Bytes()
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An ICAP connection to an ICAPServer over an in memory pipe.
+type TestICAPConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewTestICAPConn(t *testing.T, policies *handlers.Policies) *TestICAPConn {
+	client, server := net.Pipe()
+	go NewICAPServer(filters.NewFake(), policies, nil).serveConn(server)
+	t.Cleanup(func() { client.Close() })
+
+	return &TestICAPConn{conn: client, reader: bufio.NewReader(client)}
+}
+
+// Send a REQMOD for the HTTP request header, with the extra ICAP headers.
+func (c *TestICAPConn) ReqMod(t *testing.T, service string, httpHeader string, icapHeaders string, body string) (int, textproto.MIMEHeader) {
+	encapsulated := fmt.Sprintf("req-hdr=0, null-body=%d", len(httpHeader))
+	if body != "" {
+		encapsulated = fmt.Sprintf("req-hdr=0, req-body=%d", len(httpHeader))
+	}
+
+	request := "REQMOD icap://localhost" + service + " ICAP/1.0\r\n" +
+		"Host: localhost\r\n" +
+		"Encapsulated: " + encapsulated + "\r\n" +
+		icapHeaders + "\r\n" + httpHeader + body
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return c.ReadResponse(t)
+}
+
+// Read the ICAP status and headers of a response.
+func (c *TestICAPConn) ReadResponse(t *testing.T) (int, textproto.MIMEHeader) {
+	tp := textproto.NewReader(c.reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var status int
+	if _, err := fmt.Sscanf(line, "ICAP/1.0 %d", &status); err != nil {
+		t.Fatalf("Failed to parse the ICAP status line \"%s\".", line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return status, header
+}
+
+const TEST_HTTP_HEADER = "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n\r\n"
+
+func TestICAPOptions(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	if _, err := c.conn.Write([]byte("OPTIONS icap://localhost/reqmod ICAP/1.0\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	status, header := c.ReadResponse(t)
+	if status != http.StatusOK {
+		t.Errorf("OPTIONS returned %d when 200 was expected.", status)
+	}
+
+	if header.Get("Methods") != "REQMOD" || header.Get("Preview") != "0" || header.Get("ISTag") != ICAP_ISTAG {
+		t.Errorf("OPTIONS returned unexpected headers %v.", header)
+	}
+}
+
+func TestICAPReqModAllowed(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	httpHeader := fmt.Sprintf(TEST_HTTP_HEADER, "www.google.com", "www.google.com")
+	status, _ := c.ReqMod(t, ICAP_SERVICE, httpHeader, "Allow: 204\r\n", "")
+	if status != http.StatusNoContent {
+		t.Errorf("URL \"www.google.com/\" returned %d when 204 was expected.", status)
+	}
+
+	// The connection is persistent, and a preview is answered with a 204.
+	status, _ = c.ReqMod(t, ICAP_SERVICE, httpHeader, "Preview: 0\r\n", "0; ieof\r\n\r\n")
+	if status != http.StatusNoContent {
+		t.Errorf("URL \"www.google.com/\" returned %d after a preview when 204 was expected.", status)
+	}
+}
+
+func TestICAPReqModEcho(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	httpHeader := "POST http://www.google.com/a HTTP/1.1\r\nHost: www.google.com\r\n\r\n"
+	status, header := c.ReqMod(t, ICAP_SERVICE, httpHeader, "", "3\r\nabc\r\n0\r\n\r\n")
+	if status != http.StatusOK {
+		t.Fatalf("URL \"www.google.com/a\" returned %d when 200 was expected.", status)
+	}
+
+	expected := fmt.Sprintf("req-hdr=0, req-body=%d", len(httpHeader))
+	if header.Get("Encapsulated") != expected {
+		t.Fatalf("The echoed request was encapsulated as \"%s\" when \"%s\" was expected.", header.Get("Encapsulated"), expected)
+	}
+
+	echoed := make([]byte, len(httpHeader))
+	if _, err := io.ReadFull(c.reader, echoed); err != nil || string(echoed) != httpHeader {
+		t.Errorf("The request header was echoed as \"%s\".", echoed)
+	}
+
+	body, err := readICAPChunks(c.reader)
+	if err != nil || string(body) != "abc" {
+		t.Errorf("The request body was echoed as \"%s\".", body)
+	}
+}
+
+func TestICAPReqModBlocked(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	httpHeader := fmt.Sprintf(TEST_HTTP_HEADER, "www.facebook.com", "www.facebook.com")
+	status, header := c.ReqMod(t, ICAP_SERVICE, httpHeader, "Allow: 204\r\n", "")
+	if status != http.StatusOK {
+		t.Fatalf("URL \"www.facebook.com/\" returned %d when 200 was expected.", status)
+	}
+
+	if !strings.HasPrefix(header.Get("Encapsulated"), "res-hdr=0, res-body=") {
+		t.Fatalf("The block page was encapsulated as \"%s\".", header.Get("Encapsulated"))
+	}
+
+	tp := textproto.NewReader(c.reader)
+	line, err := tp.ReadLine()
+	if err != nil || line != "HTTP/1.1 403 Forbidden" {
+		t.Errorf("The block page status was \"%s\" when \"HTTP/1.1 403 Forbidden\" was expected.", line)
+	}
+
+	blockHeader, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if blockHeader.Get(handlers.CATEGORY_HEADER) != filters.FAKE_CATEGORY {
+		t.Errorf("The block page category was \"%s\" when \"%s\" was expected.", blockHeader.Get(handlers.CATEGORY_HEADER), filters.FAKE_CATEGORY)
+	}
+
+	body, err := readICAPChunks(c.reader)
+	if err != nil || !strings.Contains(string(body), "www.facebook.com/") {
+		t.Errorf("The block page did not name the URL, got \"%s\".", body)
+	}
+}
+
+func TestICAPReqModError(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	httpHeader := fmt.Sprintf(TEST_HTTP_HEADER, "www.bookface.com", "www.bookface.com")
+	status, _ := c.ReqMod(t, ICAP_SERVICE, httpHeader, "Allow: 204\r\n", "")
+	if status != http.StatusInternalServerError {
+		t.Errorf("A failed lookup returned %d when 500 was expected.", status)
+	}
+}
+
+func TestICAPReqModPolicy(t *testing.T) {
+	policies := handlers.NewPolicies(map[string]config.Policy{
+		"staff": {Categories: []string{"malware"}, APIKeys: []string{"staffkey"}},
+	}, "")
+	c := NewTestICAPConn(t, policies)
+
+	httpHeader := fmt.Sprintf(TEST_HTTP_HEADER, "www.facebook.com", "www.facebook.com")
+	status, _ := c.ReqMod(t, ICAP_SERVICE+"?"+handlers.POLICY_PARAM+"=staff", httpHeader, "Allow: 204\r\n", "")
+	if status != http.StatusNoContent {
+		t.Errorf("URL \"www.facebook.com/\" returned %d under the staff policy when 204 was expected.", status)
+	}
+
+	status, _ = c.ReqMod(t, ICAP_SERVICE, httpHeader, "Allow: 204\r\nX-API-Key: merp\r\n", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("An unknown API key returned %d when 400 was expected.", status)
+	}
+}
+
+func TestICAPUnknownService(t *testing.T) {
+	c := NewTestICAPConn(t, nil)
+
+	httpHeader := fmt.Sprintf(TEST_HTTP_HEADER, "www.google.com", "www.google.com")
+	status, _ := c.ReqMod(t, "/respmod", httpHeader, "Allow: 204\r\n", "")
+	if status != http.StatusNotFound {
+		t.Errorf("An unknown service returned %d when 404 was expected.", status)
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	tests := map[string]string{
+		"GET http://www.google.com/a?b=1 HTTP/1.1\r\nHost: www.google.com\r\n\r\n": "www.google.com/a?b=1",
+		"GET /a?b=1 HTTP/1.1\r\nHost: www.google.com\r\n\r\n":                      "www.google.com/a?b=1",
+		"CONNECT www.google.com:443 HTTP/1.1\r\nHost: www.google.com:443\r\n\r\n":  "www.google.com:443",
+	}
+
+	for raw, expected := range tests {
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if url := RequestURL(req); url != expected {
+			t.Errorf("URL \"%s\" was built when \"%s\" was expected.", url, expected)
+		}
+	}
+}
+
+func TestICAPShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := NewICAPServer(filters.NewFake(), nil, nil)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	c := &TestICAPConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if _, err := c.conn.Write([]byte("OPTIONS icap://localhost/reqmod ICAP/1.0\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err.Error())
+	}
+	c.ReadResponse(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutting down the ICAP server returned %s.", err)
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %s after the ICAP server was shut down.", err)
+	}
+
+	if _, err := c.reader.ReadByte(); err != io.EOF {
+		t.Errorf("The idle ICAP connection wasn't closed by the shutdown, reading returned %v.", err)
+	}
+}
+
+func TestICAPRejectsBadOffsets(t *testing.T) {
+	for _, encapsulated := range []string{"req-hdr=0, null-body=-1", "req-hdr=10, null-body=5", "req-hdr=0, null-body=999999999"} {
+		c := NewTestICAPConn(t, nil)
+
+		request := "REQMOD icap://localhost/reqmod ICAP/1.0\r\nHost: localhost\r\nEncapsulated: " + encapsulated + "\r\n\r\n"
+		if _, err := c.conn.Write([]byte(request)); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if status, _ := c.ReadResponse(t); status != http.StatusBadRequest {
+			t.Errorf("Encapsulated \"%s\" returned %d when 400 was expected.", encapsulated, status)
+		}
+	}
+}
+
+func TestICAPRejectsLargeChunks(t *testing.T) {
+	httpHeader := "POST http://www.google.com/a HTTP/1.1\r\nHost: www.google.com\r\n\r\n"
+	for _, body := range []string{"ffffffffffffffff\r\n", "7fffffffffffffff\r\n", fmt.Sprintf("%x\r\n", ICAP_MAX_BODY_LENGTH+1)} {
+		c := NewTestICAPConn(t, nil)
+
+		if status, _ := c.ReqMod(t, ICAP_SERVICE, httpHeader, "", body); status != http.StatusBadRequest {
+			t.Errorf("Chunk \"%s\" returned %d when 400 was expected.", strings.TrimSpace(body), status)
+		}
+	}
+}
+
+func TestICAPReqModAudit(t *testing.T) {
+	out := &bytes.Buffer{}
+	client, server := net.Pipe()
+	go NewICAPServer(filters.NewFake(), nil, audit.NewLogger([]audit.Sink{audit.NewWriterSink(out)}, 1)).serveConn(server)
+	t.Cleanup(func() { client.Close() })
+	c := &TestICAPConn{conn: client, reader: bufio.NewReader(client)}
+
+	httpHeader := "GET http://www.facebook.com/ HTTP/1.1\r\nHost: www.facebook.com\r\nX-Request-ID: abc123\r\n\r\n"
+	if status, _ := c.ReqMod(t, ICAP_SERVICE, httpHeader, ICAP_CLIENT_IP_HEADER+": 10.0.0.1\r\n", ""); status != http.StatusOK {
+		t.Fatalf("The REQMOD returned %d when 200 was expected.", status)
+	}
+
+	record := &audit.Record{}
+	if err := json.Unmarshal(out.Bytes(), record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com/" || record.Verdict != handlers.VERDICT_BLOCKED || record.Client != "10.0.0.1" ||
+		record.RequestID != "abc123" || record.Handler != ICAP_HANDLER {
+		t.Errorf("The lookup was audited as \"%s\".", out.String())
+	}
+}
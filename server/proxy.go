@@ -0,0 +1,159 @@
+package server
+
+import (
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/metrics"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Name of the proxy in the request metrics.
+const PROXY_HANDLER = "proxy"
+
+// How long the proxy waits to connect to the destination of a CONNECT tunnel.
+const PROXY_DIAL_TIMEOUT = 10 * time.Second
+
+// Forward HTTP proxy that checks every request against the filter chain.
+// Plain HTTP requests are checked by URL, CONNECT tunnels by host and port
+// since the rest of an HTTPS URL is encrypted.
+type ProxyServer struct {
+	// The chain of filters used by this proxy to see if a URL is flagged.
+	filter filters.Filter
+
+	// The policy every URL is checked under, nil blocks everything.
+	policy *handlers.Policy
+
+	// Ports CONNECT tunnels can be opened to.
+	connectPorts map[string]bool
+
+	// Records every decision, nil if the audit log is disabled.
+	auditor *audit.Logger
+
+	// Forwards allowed plain HTTP requests.
+	forwarder *httputil.ReverseProxy
+}
+
+// Create a ProxyServer instance with the underlying filters.Filter chain.
+// If policy is nil every flagged URL is blocked. Tunnels can only be
+// opened to the connectPorts. If auditor is nil decisions aren't audited.
+func NewProxyServer(filter filters.Filter, policy *handlers.Policy, connectPorts []int, auditor *audit.Logger) *ProxyServer {
+	ports := make(map[string]bool, len(connectPorts))
+	for _, port := range connectPorts {
+		ports[strconv.Itoa(port)] = true
+	}
+
+	return &ProxyServer{
+		filter:       filter,
+		policy:       policy,
+		connectPorts: ports,
+		auditor:      auditor,
+		forwarder: &httputil.ReverseProxy{
+			// The request URL is already absolute, only the headers change.
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetXForwarded()
+			},
+		},
+	}
+}
+
+// Create an HTTP server for the proxy, started with RunListener.
+func NewProxyHTTPServer(proxy *ProxyServer) *http.Server {
+	return &http.Server{Handler: proxy}
+}
+
+// Check the request against the filter chain. Blocked requests get the
+// block page, or a refused tunnel, allowed requests are forwarded.
+func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect && r.URL.Host == "" {
+		metrics.Requests.WithLabelValues(PROXY_HANDLER, handlers.VERDICT_NONE, strconv.Itoa(http.StatusBadRequest)).Inc()
+		http.Error(w, "Only proxy requests are accepted.", http.StatusBadRequest)
+		return
+	}
+
+	if _, port, err := net.SplitHostPort(r.Host); r.Method == http.MethodConnect && (err != nil || !p.connectPorts[port]) {
+		metrics.Requests.WithLabelValues(PROXY_HANDLER, handlers.VERDICT_NONE, strconv.Itoa(http.StatusForbidden)).Inc()
+		http.Error(w, "Tunnels can't be opened to that port.", http.StatusForbidden)
+		return
+	}
+
+	target := RequestURL(r)
+	start := time.Now()
+	verdict, err := p.filter.Lookup(r.Context(), target)
+	response := handlers.NewFilterResponse(target, verdict, err, time.Since(start), p.policy)
+	requestID := handlers.RequestID(r)
+	if p.auditor != nil {
+		p.auditor.Log(handlers.NewAuditRecord(handlers.ClientIP(r), PROXY_HANDLER, response, requestID))
+	}
+
+	status := http.StatusOK
+	switch {
+	case response.Verdict == handlers.VERDICT_ERROR:
+		status = http.StatusInternalServerError
+		http.Error(w, "The URL could not be checked.", status)
+	case response.Verdict == handlers.VERDICT_BLOCKED:
+		status = http.StatusForbidden
+		if response.Category != "" {
+			w.Header().Set(handlers.CATEGORY_HEADER, response.Category)
+		}
+		w.Header().Set(handlers.REQUEST_ID_HEADER, requestID)
+		w.Header().Set("Content-Type", handlers.HTML_CONTENT_TYPE)
+		w.WriteHeader(status)
+		io.WriteString(w, BlockPage(response, requestID))
+	case r.Method == http.MethodConnect:
+		status = p.tunnel(w, r)
+	default:
+		p.forwarder.ServeHTTP(w, r)
+	}
+	metrics.Requests.WithLabelValues(PROXY_HANDLER, response.Verdict, strconv.Itoa(status)).Inc()
+}
+
+// Connect to the destination and copy bytes both ways until either side
+// closes. Returns the status sent to the client.
+func (p *ProxyServer) tunnel(w http.ResponseWriter, r *http.Request) int {
+	upstream, err := net.DialTimeout("tcp", r.Host, PROXY_DIAL_TIMEOUT)
+	if err != nil {
+		log.Printf("Failed to open a tunnel to %s: %s.", r.Host, err)
+		http.Error(w, "The destination could not be reached.", http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Tunnels aren't supported over this connection.", http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Failed to take over the connection for a tunnel to %s: %s.", r.Host, err)
+		return http.StatusInternalServerError
+	}
+	defer client.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return http.StatusOK
+	}
+
+	// Anything the client sent after the CONNECT request is already buffered.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+	wg.Wait()
+
+	return http.StatusOK
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/tmortimer/urlfilter/audit"
+	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/handlers"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Start the proxy with the Fake filter and return its URL.
+func StartTestProxy(t *testing.T, policy *handlers.Policy) *url.URL {
+	return StartTestProxyPorts(t, policy, []int{443})
+}
+
+// Start the proxy with the Fake filter, allowing tunnels to the ports,
+// and return its URL.
+func StartTestProxyPorts(t *testing.T, policy *handlers.Policy, connectPorts []int) *url.URL {
+	proxy := httptest.NewServer(NewProxyServer(filters.NewFake(), policy, connectPorts, nil))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return proxyURL
+}
+
+// Send a CONNECT request for the target to the proxy, returning the
+// connection and the response.
+func Connect(t *testing.T, proxyURL *url.URL, target string) (net.Conn, *http.Response) {
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return conn, response
+}
+
+func TestProxyForwardsAllowed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(StartTestProxy(t, nil))}}
+	response, err := client.Get(upstream.URL + "/a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || string(body) != "upstream" {
+		t.Errorf("The allowed request returned %d \"%s\" when the upstream's response was expected.", response.StatusCode, body)
+	}
+}
+
+func TestProxyBlocksFlagged(t *testing.T) {
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(StartTestProxy(t, nil))}}
+	response, err := client.Get("http://www.facebook.com/a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("URL \"www.facebook.com/a\" returned %d when 403 was expected.", response.StatusCode)
+	}
+
+	if response.Header.Get(handlers.CATEGORY_HEADER) != filters.FAKE_CATEGORY {
+		t.Errorf("The block page category was \"%s\" when \"%s\" was expected.", response.Header.Get(handlers.CATEGORY_HEADER), filters.FAKE_CATEGORY)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	if !strings.Contains(string(body), "www.facebook.com/a") {
+		t.Errorf("The block page did not name the URL, got \"%s\".", body)
+	}
+}
+
+func TestProxyPolicy(t *testing.T) {
+	proxyURL := StartTestProxy(t, handlers.NewPolicy("staff", []string{"malware"}))
+
+	// Nothing listens on the flagged host, so an allowed request can't be forwarded.
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	response, err := client.Get("http://www.facebook.com.invalid/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadGateway {
+		t.Errorf("URL \"www.facebook.com.invalid/\" returned %d under the staff policy when it should have been forwarded.", response.StatusCode)
+	}
+}
+
+func TestProxyLookupError(t *testing.T) {
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(StartTestProxy(t, nil))}}
+	response, err := client.Get("http://www.bookface.com/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("A failed lookup returned %d when 500 was expected.", response.StatusCode)
+	}
+
+	if strings.Contains(string(body), "Bad things happened!") {
+		t.Errorf("A failed lookup returned the internal error \"%s\".", body)
+	}
+}
+
+func TestProxyRejectsOriginRequests(t *testing.T) {
+	response, err := http.Get(StartTestProxy(t, nil).String() + "/a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("A request that wasn't for the proxy returned %d when 400 was expected.", response.StatusCode)
+	}
+}
+
+func TestProxyTunnel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+
+	// Echo the first line back over the tunnel.
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, line)
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	conn, response := Connect(t, StartTestProxyPorts(t, nil, []int{port}), listener.Addr().String())
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("The tunnel returned %d when 200 was expected.", response.StatusCode)
+	}
+
+	io.WriteString(conn, "hello\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Errorf("The tunnel echoed \"%s\" when \"hello\" was expected.", line)
+	}
+}
+
+func TestProxyTunnelBlocked(t *testing.T) {
+	_, response := Connect(t, StartTestProxy(t, nil), "www.facebook.com:443")
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("The tunnel to \"www.facebook.com:443\" returned %d when 403 was expected.", response.StatusCode)
+	}
+}
+
+func TestProxyTunnelPortNotAllowed(t *testing.T) {
+	_, response := Connect(t, StartTestProxy(t, nil), "www.google.com:25")
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("The tunnel to \"www.google.com:25\" returned %d when 403 was expected.", response.StatusCode)
+	}
+}
+
+// An audit sink that hands each line to the test once it's written, so
+// the test doesn't share a buffer with the server goroutine.
+type TestSink struct {
+	lines chan []byte
+}
+
+func NewTestSink() *TestSink {
+	return &TestSink{lines: make(chan []byte, 1)}
+}
+
+func (s *TestSink) Write(line []byte) error {
+	s.lines <- line
+	return nil
+}
+
+func (s *TestSink) Close() error {
+	return nil
+}
+
+func TestProxyAudit(t *testing.T) {
+	sink := NewTestSink()
+	proxy := httptest.NewServer(NewProxyServer(filters.NewFake(), nil, []int{443}, audit.NewLogger([]audit.Sink{sink}, 1)))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, response := Connect(t, proxyURL, "www.facebook.com:443")
+	response.Body.Close()
+
+	line := <-sink.lines
+	record := &audit.Record{}
+	if err := json.Unmarshal(line, record); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if record.URL != "www.facebook.com:443" || record.Verdict != handlers.VERDICT_BLOCKED || record.Client != "127.0.0.1" ||
+		record.RequestID == "" || record.Handler != PROXY_HANDLER {
+		t.Errorf("The lookup was audited as \"%s\".", line)
+	}
+}
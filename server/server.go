@@ -2,8 +2,15 @@
 package server
 
 import (
+	"context"
 	"github.com/tmortimer/urlfilter/handlers"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 // HTTP Server Interface, backs the main server instance.
@@ -12,7 +19,29 @@ type HTTPServer interface {
 	ListenAndServe() error
 }
 
-// Initializes REST API handlers and launch the server.
+// Listener Server Interface, backs the gRPC and ICAP server instances.
+type ListenerServer interface {
+	// Serve requests on the listener.
+	Serve(listener net.Listener) error
+}
+
+// A server that can be stopped gracefully, ie: an http.Server.
+type Shutdowner interface {
+	// Stop accepting connections and wait for the requests being handled
+	// to finish, giving up when the context is done.
+	Shutdown(ctx context.Context) error
+}
+
+// Adapts a function to a Shutdowner, ie: the DNS server's ShutdownContext.
+type ShutdownFunc func(ctx context.Context) error
+
+// Call the function.
+func (f ShutdownFunc) Shutdown(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Initializes REST API handlers and launch the server. Returns once the
+// server has been shut down.
 func Run(handlers []handlers.Handler, s HTTPServer) {
 	for _, handler := range handlers {
 		handler.Init()
@@ -21,7 +50,47 @@ func Run(handlers []handlers.Handler, s HTTPServer) {
 	// ListenAndServe launches a goroutine for each connection,
 	// so no additional handling necessary to get some concurrency.
 	err := s.ListenAndServe()
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Launch a gRPC or ICAP server on the listener, alongside the REST API.
+// Returns once the server has been shut down.
+func RunListener(s ListenerServer, listener net.Listener) {
+	err := s.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
+
+// Block until the process is asked to stop with SIGTERM or SIGINT, and
+// return the signal.
+func WaitForSignal() os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	return <-signals
+}
+
+// Shut the servers down together, giving them until the context is done
+// to finish the requests they're handling. Returns the first error.
+func Shutdown(ctx context.Context, servers []Shutdowner) error {
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, s Shutdowner) {
+			defer wg.Done()
+			errs[i] = s.Shutdown(ctx)
+		}(i, s)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"context"
 	"github.com/tmortimer/urlfilter/handlers"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type TestHandler struct {
@@ -22,6 +26,15 @@ func (s *TestServer) ListenAndServe() error {
 	return nil
 }
 
+type TestListenerServer struct {
+	listener net.Listener
+}
+
+func (s *TestListenerServer) Serve(listener net.Listener) error {
+	s.listener = listener
+	return nil
+}
+
 func TestRunCallsHandlersStartsServer(t *testing.T) {
 	h := &TestHandler{}
 	h2 := &TestHandler{}
@@ -46,3 +59,49 @@ func TestRunCallsHandlersStartsServer(t *testing.T) {
 		t.Errorf("The TestServer ListenAndServe function was called %d time(s).", s.called)
 	}
 }
+
+func TestRunListenerServesListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+
+	s := &TestListenerServer{}
+
+	RunListener(s, listener)
+
+	if s.listener != listener {
+		t.Error("The TestListenerServer Serve function was not called with the listener.")
+	}
+}
+
+func TestShutdownStopsServers(t *testing.T) {
+	var stopped int32
+	stop := ShutdownFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&stopped, 1)
+		return nil
+	})
+
+	if err := Shutdown(context.Background(), []Shutdowner{stop, stop}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if stopped != 2 {
+		t.Errorf("%d of the 2 servers were shut down.", stopped)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	slow := ShutdownFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := Shutdown(ctx, []Shutdowner{slow}); err != context.DeadlineExceeded {
+		t.Errorf("Shutting down a slow server returned %v when the deadline was expected.", err)
+	}
+}
@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/miekg/dns"
+	"github.com/tmortimer/urlfilter/audit"
 	"github.com/tmortimer/urlfilter/config"
+	"github.com/tmortimer/urlfilter/dnsserver"
+	"github.com/tmortimer/urlfilter/extauthz"
 	"github.com/tmortimer/urlfilter/filters"
+	"github.com/tmortimer/urlfilter/grpcserver"
 	"github.com/tmortimer/urlfilter/handlers"
+	"github.com/tmortimer/urlfilter/helper"
+	"github.com/tmortimer/urlfilter/notify"
 	"github.com/tmortimer/urlfilter/server"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"time"
 )
 
 // Conifgure and launch URL filtering service which can be used
@@ -25,9 +37,205 @@ func main() {
 		log.Fatalf("Unable to configure filter chain: %s", err)
 	}
 
+	policies := handlers.NewPolicies(config.Policies, config.DefaultPolicy)
+
+	auditor, err := audit.CreateLogger(config.Audit)
+	if err != nil {
+		log.Fatalf("Unable to configure audit log: %s", err)
+	}
+
+	// Run as a Squid external ACL helper on stdin and stdout instead of
+	// launching the servers.
+	if flag.Arg(0) == "helper" {
+		runHelper(filter, policies, auditor, config.Audit.Sinks, flag.Args()[1:])
+		cleanup(context.Background(), filter, nil, nil, auditor)
+		return
+	}
+
+	// The admin API is only enabled if it has API keys.
+	var admin *handlers.AdminHandler
+	if len(config.Admin.APIKeys) > 0 {
+		admin, err = handlers.CreateAdminHandler(config)
+		if err != nil {
+			log.Fatalf("Unable to configure admin API: %s", err)
+		}
+	}
+
+	blockPage, err := handlers.NewBlockPage(config.BlockPage)
+	if err != nil {
+		log.Fatalf("Unable to configure block page: %s", err)
+	}
+
+	// Blocked URLs are only posted to webhooks if some are configured.
+	var notifier *notify.Notifier
+	if len(config.Webhook.URLs) > 0 {
+		notifier = notify.NewNotifier(config.Webhook)
+	}
+
+	failure := handlers.NewFailurePolicy(config)
+
+	lookups := handlers.NewFilterHandler(filter, handlers.FilterHandlerOptions{
+		Policies:  policies,
+		BlockPage: blockPage,
+		Notifier:  notifier,
+		Auditor:   auditor,
+		Failure:   failure,
+	})
 	handlers := []handlers.Handler{
-		handlers.NewFilterHandler(filter),
+		lookups,
+		handlers.NewBatchHandler(filter, config.Batch.MaxURLs, config.Batch.Workers, handlers.BatchHandlerOptions{
+			Lookups:  lookups,
+			Policies: policies,
+			Auditor:  auditor,
+			Failure:  failure,
+		}),
+		handlers.NewHealthHandler(filter),
+		handlers.NewMetricsHandler(),
+	}
+
+	if admin != nil {
+		handlers = append(handlers, admin)
+	}
+
+	// Servers stopped gracefully on SIGTERM or SIGINT.
+	shutdowns := []server.Shutdowner{}
+
+	// The gRPC server is only enabled if it has a port.
+	if config.GRPC.Port != "" {
+		listener, err := net.Listen("tcp", config.Host+":"+config.GRPC.Port)
+		if err != nil {
+			log.Fatalf("Unable to listen for gRPC: %s", err)
+		}
+
+		service := grpcserver.NewServer(filter, config.Batch.MaxURLs, config.Batch.Workers, policies, auditor)
+		grpcServer := grpcserver.NewGRPCServer(service)
+		if config.ExtAuthz.Enabled {
+			authz := extauthz.NewServer(filter, policies, config.ExtAuthz.DeniedStatus, config.ExtAuthz.DeniedBody, auditor)
+			authv3.RegisterAuthorizationServer(grpcServer, authz)
+		}
+		go server.RunListener(grpcServer, listener)
+		shutdowns = append(shutdowns, server.ShutdownFunc(func(ctx context.Context) error {
+			return grpcserver.Shutdown(ctx, grpcServer)
+		}))
+	}
+
+	// The ICAP server is only enabled if it has a port.
+	if config.ICAP.Port != "" {
+		listener, err := net.Listen("tcp", config.Host+":"+config.ICAP.Port)
+		if err != nil {
+			log.Fatalf("Unable to listen for ICAP: %s", err)
+		}
+
+		icapServer := server.NewICAPServer(filter, policies, auditor)
+		go server.RunListener(icapServer, listener)
+		shutdowns = append(shutdowns, icapServer)
+	}
+
+	// The DNS resolver is only enabled if it has a port.
+	if config.DNS.Port != "" {
+		policy, err := policies.Choose("", config.DNS.Policy)
+		if err != nil {
+			log.Fatalf("Unable to select DNS policy %s: %s", config.DNS.Policy, err)
+		}
+
+		resolver := dnsserver.NewServer(filter, policy, config.DNS, auditor)
+		for _, s := range dnsserver.NewDNSServers(config.Host+":"+config.DNS.Port, resolver) {
+			go func(s *dns.Server) {
+				if err := s.ListenAndServe(); err != nil {
+					log.Fatalf("Unable to serve DNS over %s: %s", s.Net, err)
+				}
+			}(s)
+			shutdowns = append(shutdowns, server.ShutdownFunc(s.ShutdownContext))
+		}
 	}
 
-	server.Run(handlers, &http.Server{Addr: config.Host + ":" + config.Port})
+	// The forward proxy is only enabled if it has a port.
+	if config.Proxy.Port != "" {
+		policy, err := policies.Choose("", config.Proxy.Policy)
+		if err != nil {
+			log.Fatalf("Unable to select proxy policy %s: %s", config.Proxy.Policy, err)
+		}
+
+		listener, err := net.Listen("tcp", config.Proxy.Host+":"+config.Proxy.Port)
+		if err != nil {
+			log.Fatalf("Unable to listen for proxy requests: %s", err)
+		}
+
+		proxy := server.NewProxyServer(filter, policy, config.Proxy.ConnectPorts, auditor)
+		proxyServer := server.NewProxyHTTPServer(proxy)
+		go server.RunListener(proxyServer, listener)
+		shutdowns = append(shutdowns, proxyServer)
+	}
+
+	httpServer := &http.Server{Addr: config.Host + ":" + config.Port}
+	go server.Run(handlers, httpServer)
+	shutdowns = append(shutdowns, httpServer)
+
+	// Stop accepting requests and let the ones in flight finish before the
+	// filter chain's connections are closed.
+	sig := server.WaitForSignal()
+	log.Printf("Received %s, shutting down.", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeouts.Shutdown)*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx, shutdowns); err != nil {
+		// Requests still running keep using the filter chain and the admin
+		// API's connections, so they're left open until the process exits.
+		log.Printf("Failed to finish every request before shutting down: %s.", err)
+		cleanup(ctx, nil, nil, notifier, auditor)
+		return
+	}
+	cleanup(ctx, filter, admin, notifier, auditor)
+}
+
+// Release everything the servers were using once they've stopped. Queued
+// webhook events are posted first, until the context is done. The filter
+// chain is only closed if it's set.
+func cleanup(ctx context.Context, filter filters.Filter, admin *handlers.AdminHandler, notifier *notify.Notifier, auditor *audit.Logger) {
+	if notifier != nil {
+		notifier.Close(ctx)
+	}
+
+	if auditor != nil {
+		if err := auditor.Close(); err != nil {
+			log.Printf("Failed to close the audit log: %s.", err)
+		}
+	}
+
+	if admin != nil {
+		if err := admin.Close(); err != nil {
+			log.Printf("Failed to close the admin API's connections: %s.", err)
+		}
+	}
+
+	if filter == nil {
+		return
+	}
+
+	if err := filter.Close(); err != nil {
+		log.Printf("Failed to close the filter chain: %s.", err)
+	}
+}
+
+// Answer Squid external_acl_type lookups until stdin is closed. Every URL is
+// checked under the -policy flag's policy, or the default policy. Squid
+// reads the answers from stdout, so the audit log can't be written there.
+func runHelper(filter filters.Filter, policies *handlers.Policies, auditor *audit.Logger, sinks []string, args []string) {
+	flags := flag.NewFlagSet("helper", flag.ExitOnError)
+	name := flags.String("policy", "", "Policy to check URLs under.")
+	flags.Parse(args)
+
+	for _, sink := range sinks {
+		if sink == audit.SINK_STDOUT {
+			log.Fatalf("Unable to write the %s audit log sink in helper mode", sink)
+		}
+	}
+
+	policy, err := policies.Choose("", *name)
+	if err != nil {
+		log.Fatalf("Unable to select policy %s: %s", *name, err)
+	}
+
+	if err := helper.NewHelper(filter, policy, auditor).Run(os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("Failed to read from Squid: %s", err)
+	}
 }
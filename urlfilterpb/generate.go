@@ -0,0 +1,4 @@
+// Generated gRPC bindings for the urlfilter API.
+package urlfilterpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative urlfilter.proto
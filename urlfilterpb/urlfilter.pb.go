@@ -0,0 +1,467 @@
+// gRPC API for the urlfilter service. It checks URLs against the same
+// filter chain as the REST API, and returns the same verdict information.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: urlfilter.proto
+
+package urlfilterpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Decision made for a URL, the same as the verdict in the REST API.
+type Verdict int32
+
+const (
+	Verdict_VERDICT_UNSPECIFIED Verdict = 0
+	Verdict_VERDICT_ALLOWED     Verdict = 1
+	Verdict_VERDICT_BLOCKED     Verdict = 2
+	Verdict_VERDICT_ERROR       Verdict = 3
+)
+
+// Enum value maps for Verdict.
+var (
+	Verdict_name = map[int32]string{
+		0: "VERDICT_UNSPECIFIED",
+		1: "VERDICT_ALLOWED",
+		2: "VERDICT_BLOCKED",
+		3: "VERDICT_ERROR",
+	}
+	Verdict_value = map[string]int32{
+		"VERDICT_UNSPECIFIED": 0,
+		"VERDICT_ALLOWED":     1,
+		"VERDICT_BLOCKED":     2,
+		"VERDICT_ERROR":       3,
+	}
+)
+
+func (x Verdict) Enum() *Verdict {
+	p := new(Verdict)
+	*p = x
+	return p
+}
+
+func (x Verdict) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Verdict) Descriptor() protoreflect.EnumDescriptor {
+	return file_urlfilter_proto_enumTypes[0].Descriptor()
+}
+
+func (Verdict) Type() protoreflect.EnumType {
+	return &file_urlfilter_proto_enumTypes[0]
+}
+
+func (x Verdict) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Verdict.Descriptor instead.
+func (Verdict) EnumDescriptor() ([]byte, []int) {
+	return file_urlfilter_proto_rawDescGZIP(), []int{0}
+}
+
+type CheckRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The URL to check, in the same form as the REST API path.
+	Url string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	// The policy to check the URL under, if not selected by API key.
+	Policy        string `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckRequest) Reset() {
+	*x = CheckRequest{}
+	mi := &file_urlfilter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckRequest) ProtoMessage() {}
+
+func (x *CheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_urlfilter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckRequest.ProtoReflect.Descriptor instead.
+func (*CheckRequest) Descriptor() ([]byte, []int) {
+	return file_urlfilter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CheckRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+type CheckManyRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The URLs to check.
+	Urls []string `protobuf:"bytes,1,rep,name=urls,proto3" json:"urls,omitempty"`
+	// The policy to check every URL under, if not selected by API key.
+	Policy        string `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckManyRequest) Reset() {
+	*x = CheckManyRequest{}
+	mi := &file_urlfilter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckManyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckManyRequest) ProtoMessage() {}
+
+func (x *CheckManyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_urlfilter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckManyRequest.ProtoReflect.Descriptor instead.
+func (*CheckManyRequest) Descriptor() ([]byte, []int) {
+	return file_urlfilter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckManyRequest) GetUrls() []string {
+	if x != nil {
+		return x.Urls
+	}
+	return nil
+}
+
+func (x *CheckManyRequest) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+type CheckManyResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One response for each URL, in request order.
+	Responses     []*CheckResponse `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckManyResponse) Reset() {
+	*x = CheckManyResponse{}
+	mi := &file_urlfilter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckManyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckManyResponse) ProtoMessage() {}
+
+func (x *CheckManyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_urlfilter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckManyResponse.ProtoReflect.Descriptor instead.
+func (*CheckManyResponse) Descriptor() ([]byte, []int) {
+	return file_urlfilter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CheckManyResponse) GetResponses() []*CheckResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+// Mirrors the JSON response body of the REST API.
+type CheckResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One of allowed, blocked or error.
+	Verdict Verdict `protobuf:"varint,1,opt,name=verdict,proto3,enum=urlfilter.v1.Verdict" json:"verdict,omitempty"`
+	// The URL that was checked by the filter chain.
+	Url string `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// The filter in the chain that made the decision.
+	Filter string `protobuf:"bytes,3,opt,name=filter,proto3" json:"filter,omitempty"`
+	// The stored entry that was found, if it isn't the URL itself.
+	Matched string `protobuf:"bytes,4,opt,name=matched,proto3" json:"matched,omitempty"`
+	// The category of the entry that was found, if the list records one.
+	Category string `protobuf:"bytes,5,opt,name=category,proto3" json:"category,omitempty"`
+	// The policy the decision was made under, if any.
+	Policy string `protobuf:"bytes,6,opt,name=policy,proto3" json:"policy,omitempty"`
+	// The list that made the decision.
+	Source string `protobuf:"bytes,7,opt,name=source,proto3" json:"source,omitempty"`
+	// True if the decision came from a cache rather than the authoritative list.
+	Cached bool `protobuf:"varint,8,opt,name=cached,proto3" json:"cached,omitempty"`
+	// How long the decision is expected to hold in seconds, 0 if unknown.
+	TtlSeconds float64 `protobuf:"fixed64,9,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"`
+	// The error text if an error was generated during the lookup.
+	Error string `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	// Time spent checking the filter chain in milliseconds.
+	DurationMs    float64 `protobuf:"fixed64,11,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckResponse) Reset() {
+	*x = CheckResponse{}
+	mi := &file_urlfilter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckResponse) ProtoMessage() {}
+
+func (x *CheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_urlfilter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckResponse.ProtoReflect.Descriptor instead.
+func (*CheckResponse) Descriptor() ([]byte, []int) {
+	return file_urlfilter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CheckResponse) GetVerdict() Verdict {
+	if x != nil {
+		return x.Verdict
+	}
+	return Verdict_VERDICT_UNSPECIFIED
+}
+
+func (x *CheckResponse) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetMatched() string {
+	if x != nil {
+		return x.Matched
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *CheckResponse) GetTtlSeconds() float64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+var File_urlfilter_proto protoreflect.FileDescriptor
+
+const file_urlfilter_proto_rawDesc = "" +
+	"\n" +
+	"\x0furlfilter.proto\x12\furlfilter.v1\"8\n" +
+	"\fCheckRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\">\n" +
+	"\x10CheckManyRequest\x12\x12\n" +
+	"\x04urls\x18\x01 \x03(\tR\x04urls\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\"N\n" +
+	"\x11CheckManyResponse\x129\n" +
+	"\tresponses\x18\x01 \x03(\v2\x1b.urlfilter.v1.CheckResponseR\tresponses\"\xc0\x02\n" +
+	"\rCheckResponse\x12/\n" +
+	"\averdict\x18\x01 \x01(\x0e2\x15.urlfilter.v1.VerdictR\averdict\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06filter\x18\x03 \x01(\tR\x06filter\x12\x18\n" +
+	"\amatched\x18\x04 \x01(\tR\amatched\x12\x1a\n" +
+	"\bcategory\x18\x05 \x01(\tR\bcategory\x12\x16\n" +
+	"\x06policy\x18\x06 \x01(\tR\x06policy\x12\x16\n" +
+	"\x06source\x18\a \x01(\tR\x06source\x12\x16\n" +
+	"\x06cached\x18\b \x01(\bR\x06cached\x12\x1f\n" +
+	"\vttl_seconds\x18\t \x01(\x01R\n" +
+	"ttlSeconds\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error\x12\x1f\n" +
+	"\vduration_ms\x18\v \x01(\x01R\n" +
+	"durationMs*_\n" +
+	"\aVerdict\x12\x17\n" +
+	"\x13VERDICT_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fVERDICT_ALLOWED\x10\x01\x12\x13\n" +
+	"\x0fVERDICT_BLOCKED\x10\x02\x12\x11\n" +
+	"\rVERDICT_ERROR\x10\x032\xe7\x01\n" +
+	"\tURLFilter\x12@\n" +
+	"\x05Check\x12\x1a.urlfilter.v1.CheckRequest\x1a\x1b.urlfilter.v1.CheckResponse\x12L\n" +
+	"\tCheckMany\x12\x1e.urlfilter.v1.CheckManyRequest\x1a\x1f.urlfilter.v1.CheckManyResponse\x12J\n" +
+	"\vCheckStream\x12\x1a.urlfilter.v1.CheckRequest\x1a\x1b.urlfilter.v1.CheckResponse(\x010\x01B,Z*github.com/tmortimer/urlfilter/urlfilterpbb\x06proto3"
+
+var (
+	file_urlfilter_proto_rawDescOnce sync.Once
+	file_urlfilter_proto_rawDescData []byte
+)
+
+func file_urlfilter_proto_rawDescGZIP() []byte {
+	file_urlfilter_proto_rawDescOnce.Do(func() {
+		file_urlfilter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_urlfilter_proto_rawDesc), len(file_urlfilter_proto_rawDesc)))
+	})
+	return file_urlfilter_proto_rawDescData
+}
+
+var file_urlfilter_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_urlfilter_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_urlfilter_proto_goTypes = []any{
+	(Verdict)(0),              // 0: urlfilter.v1.Verdict
+	(*CheckRequest)(nil),      // 1: urlfilter.v1.CheckRequest
+	(*CheckManyRequest)(nil),  // 2: urlfilter.v1.CheckManyRequest
+	(*CheckManyResponse)(nil), // 3: urlfilter.v1.CheckManyResponse
+	(*CheckResponse)(nil),     // 4: urlfilter.v1.CheckResponse
+}
+var file_urlfilter_proto_depIdxs = []int32{
+	4, // 0: urlfilter.v1.CheckManyResponse.responses:type_name -> urlfilter.v1.CheckResponse
+	0, // 1: urlfilter.v1.CheckResponse.verdict:type_name -> urlfilter.v1.Verdict
+	1, // 2: urlfilter.v1.URLFilter.Check:input_type -> urlfilter.v1.CheckRequest
+	2, // 3: urlfilter.v1.URLFilter.CheckMany:input_type -> urlfilter.v1.CheckManyRequest
+	1, // 4: urlfilter.v1.URLFilter.CheckStream:input_type -> urlfilter.v1.CheckRequest
+	4, // 5: urlfilter.v1.URLFilter.Check:output_type -> urlfilter.v1.CheckResponse
+	3, // 6: urlfilter.v1.URLFilter.CheckMany:output_type -> urlfilter.v1.CheckManyResponse
+	4, // 7: urlfilter.v1.URLFilter.CheckStream:output_type -> urlfilter.v1.CheckResponse
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_urlfilter_proto_init() }
+func file_urlfilter_proto_init() {
+	if File_urlfilter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_urlfilter_proto_rawDesc), len(file_urlfilter_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_urlfilter_proto_goTypes,
+		DependencyIndexes: file_urlfilter_proto_depIdxs,
+		EnumInfos:         file_urlfilter_proto_enumTypes,
+		MessageInfos:      file_urlfilter_proto_msgTypes,
+	}.Build()
+	File_urlfilter_proto = out.File
+	file_urlfilter_proto_goTypes = nil
+	file_urlfilter_proto_depIdxs = nil
+}
@@ -0,0 +1,207 @@
+// gRPC API for the urlfilter service. It checks URLs against the same
+// filter chain as the REST API, and returns the same verdict information.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: urlfilter.proto
+
+package urlfilterpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	URLFilter_Check_FullMethodName       = "/urlfilter.v1.URLFilter/Check"
+	URLFilter_CheckMany_FullMethodName   = "/urlfilter.v1.URLFilter/CheckMany"
+	URLFilter_CheckStream_FullMethodName = "/urlfilter.v1.URLFilter/CheckStream"
+)
+
+// URLFilterClient is the client API for URLFilter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Checks URLs against the filter chain. The policy is selected by the
+// x-api-key metadata, which takes precedence, or the request's policy.
+type URLFilterClient interface {
+	// Check a single URL.
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	// Check many URLs, the responses are in the same order as the URLs.
+	CheckMany(ctx context.Context, in *CheckManyRequest, opts ...grpc.CallOption) (*CheckManyResponse, error)
+	// Check each URL as it's received, responses are sent in the same order.
+	CheckStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CheckRequest, CheckResponse], error)
+}
+
+type uRLFilterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewURLFilterClient(cc grpc.ClientConnInterface) URLFilterClient {
+	return &uRLFilterClient{cc}
+}
+
+func (c *uRLFilterClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckResponse)
+	err := c.cc.Invoke(ctx, URLFilter_Check_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLFilterClient) CheckMany(ctx context.Context, in *CheckManyRequest, opts ...grpc.CallOption) (*CheckManyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckManyResponse)
+	err := c.cc.Invoke(ctx, URLFilter_CheckMany_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLFilterClient) CheckStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CheckRequest, CheckResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &URLFilter_ServiceDesc.Streams[0], URLFilter_CheckStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CheckRequest, CheckResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLFilter_CheckStreamClient = grpc.BidiStreamingClient[CheckRequest, CheckResponse]
+
+// URLFilterServer is the server API for URLFilter service.
+// All implementations must embed UnimplementedURLFilterServer
+// for forward compatibility.
+//
+// Checks URLs against the filter chain. The policy is selected by the
+// x-api-key metadata, which takes precedence, or the request's policy.
+type URLFilterServer interface {
+	// Check a single URL.
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	// Check many URLs, the responses are in the same order as the URLs.
+	CheckMany(context.Context, *CheckManyRequest) (*CheckManyResponse, error)
+	// Check each URL as it's received, responses are sent in the same order.
+	CheckStream(grpc.BidiStreamingServer[CheckRequest, CheckResponse]) error
+	mustEmbedUnimplementedURLFilterServer()
+}
+
+// UnimplementedURLFilterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedURLFilterServer struct{}
+
+func (UnimplementedURLFilterServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedURLFilterServer) CheckMany(context.Context, *CheckManyRequest) (*CheckManyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckMany not implemented")
+}
+func (UnimplementedURLFilterServer) CheckStream(grpc.BidiStreamingServer[CheckRequest, CheckResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CheckStream not implemented")
+}
+func (UnimplementedURLFilterServer) mustEmbedUnimplementedURLFilterServer() {}
+func (UnimplementedURLFilterServer) testEmbeddedByValue()                   {}
+
+// UnsafeURLFilterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to URLFilterServer will
+// result in compilation errors.
+type UnsafeURLFilterServer interface {
+	mustEmbedUnimplementedURLFilterServer()
+}
+
+func RegisterURLFilterServer(s grpc.ServiceRegistrar, srv URLFilterServer) {
+	// If the following call pancis, it indicates UnimplementedURLFilterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&URLFilter_ServiceDesc, srv)
+}
+
+func _URLFilter_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLFilterServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLFilter_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLFilterServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLFilter_CheckMany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckManyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLFilterServer).CheckMany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLFilter_CheckMany_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLFilterServer).CheckMany(ctx, req.(*CheckManyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLFilter_CheckStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(URLFilterServer).CheckStream(&grpc.GenericServerStream[CheckRequest, CheckResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLFilter_CheckStreamServer = grpc.BidiStreamingServer[CheckRequest, CheckResponse]
+
+// URLFilter_ServiceDesc is the grpc.ServiceDesc for URLFilter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var URLFilter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "urlfilter.v1.URLFilter",
+	HandlerType: (*URLFilterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    _URLFilter_Check_Handler,
+		},
+		{
+			MethodName: "CheckMany",
+			Handler:    _URLFilter_CheckMany_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CheckStream",
+			Handler:       _URLFilter_CheckStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "urlfilter.proto",
+}